@@ -0,0 +1,313 @@
+package ast
+
+import "fmt"
+
+// ApplyFunc is called by Apply for every node of the tree. It receives a Cursor
+// describing the node and offering operations to rewrite it.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses the tree rooted at root depth-first, calling pre before and
+// post after the children of each node are visited. Nil children are skipped.
+//
+// If pre returns false the children of the node and post are skipped.
+// If post returns false the traversal stops and Apply returns immediately.
+// Either function may be nil.
+//
+// pre and post may rewrite the tree through the Cursor. When pre replaces a
+// node, the children of the new node are traversed. Nodes inserted with
+// InsertBefore or InsertAfter are not traversed.
+//
+// Apply returns the possibly replaced root.
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	a := &application{pre: pre, post: post}
+	result = root
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+	}()
+	a.apply(nil, "Root", func(n Node) { result = n }, nil, nil, root)
+	return result
+}
+
+var abort = new(int) // sentinel panic value used to stop the traversal
+
+// Cursor describes a node encountered during Apply.
+type Cursor struct {
+	parent Node
+	name   string
+	node   Node
+	set    func(Node) // replaces node when it is held in a plain field
+	list   nodeList   // the containing list, if node is a list element
+	iter   *iterator  // position in list, if node is a list element
+}
+
+// Node returns the current node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current node, or nil for the root.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent field that holds the current node,
+// e.g. "Statements", "Left" or "Body". The root is named "Root".
+func (c *Cursor) Name() string { return c.name }
+
+// Index returns the position of the current node in its containing list,
+// or -1 if the node is not part of a list.
+func (c *Cursor) Index() int {
+	if c.iter == nil {
+		return -1
+	}
+	return c.iter.index
+}
+
+// Replace replaces the current node with n. It panics if n does not have a
+// type the parent field can hold.
+func (c *Cursor) Replace(n Node) {
+	if c.list != nil {
+		c.list.set(c.iter.index, n)
+	} else {
+		c.set(n)
+	}
+	c.node = n
+}
+
+// Delete removes the current node from its containing list.
+// It panics if the current node is not part of a list.
+func (c *Cursor) Delete() {
+	c.mustBeInList("Delete")
+	c.list.delete(c.iter.index)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current node in its containing list.
+// It panics if the current node is not part of a list.
+func (c *Cursor) InsertAfter(n Node) {
+	c.mustBeInList("InsertAfter")
+	c.list.insert(c.iter.index+1, n)
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current node in its containing list.
+// It panics if the current node is not part of a list.
+func (c *Cursor) InsertBefore(n Node) {
+	c.mustBeInList("InsertBefore")
+	c.list.insert(c.iter.index, n)
+	c.iter.index++
+}
+
+func (c *Cursor) mustBeInList(op string) {
+	if c.list == nil {
+		panic(fmt.Sprintf("ast: %s called on %T which is not part of a list", op, c.node))
+	}
+}
+
+// iterator tracks the traversal position inside a list while it is being edited.
+type iterator struct {
+	index, step int
+}
+
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+}
+
+func (a *application) apply(parent Node, name string, set func(Node), list nodeList, it *iterator, n Node) {
+	saved := a.cursor
+	a.cursor = Cursor{parent: parent, name: name, node: n, set: set, list: list, iter: it}
+	defer func() { a.cursor = saved }()
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		return
+	}
+
+	switch n := a.cursor.node.(type) {
+	case *Program:
+		a.applyList(n, "Statements", (*statementList)(&n.Statements))
+	case *LetStatement:
+		a.field(n, "Name", n.Name, func(c Node) { n.Name = c.(*Identifier) })
+		a.field(n, "Pattern", n.Pattern, func(c Node) { n.Pattern = c.(Pattern) })
+		a.field(n, "Value", n.Value, func(c Node) { n.Value = c.(Expression) })
+	case *ReturnStatement:
+		a.field(n, "ReturnValue", n.ReturnValue, func(c Node) { n.ReturnValue = c.(Expression) })
+	case *ThrowStatement:
+		a.field(n, "Value", n.Value, func(c Node) { n.Value = c.(Expression) })
+	case *ImportStatement:
+		a.field(n, "Path", n.Path, func(c Node) { n.Path = c.(*StringLiteral) })
+		a.field(n, "Name", n.Name, func(c Node) { n.Name = c.(*Identifier) })
+	case *ExportStatement:
+		a.field(n, "Statement", n.Statement, func(c Node) { n.Statement = c.(*LetStatement) })
+	case *ExpressionStatement:
+		a.field(n, "Expression", n.Expression, func(c Node) { n.Expression = c.(Expression) })
+	case *BlockStatement:
+		a.applyList(n, "Statements", (*statementList)(&n.Statements))
+	case *PrefixExpression:
+		a.field(n, "Right", n.Right, func(c Node) { n.Right = c.(Expression) })
+	case *InfixExpression:
+		a.field(n, "Left", n.Left, func(c Node) { n.Left = c.(Expression) })
+		a.field(n, "Right", n.Right, func(c Node) { n.Right = c.(Expression) })
+	case *PipeExpression:
+		a.field(n, "Left", n.Left, func(c Node) { n.Left = c.(Expression) })
+		a.field(n, "Right", n.Right, func(c Node) { n.Right = c.(Expression) })
+	case *TemplateLiteral:
+		a.applyList(n, "Expressions", (*expressionList)(&n.Expressions))
+	case *ConditionalExpression:
+		a.field(n, "Condition", n.Condition, func(c Node) { n.Condition = c.(Expression) })
+		a.field(n, "Consequence", n.Consequence, func(c Node) { n.Consequence = c.(Expression) })
+		a.field(n, "Alternative", n.Alternative, func(c Node) { n.Alternative = c.(Expression) })
+	case *CoalesceExpression:
+		a.field(n, "Left", n.Left, func(c Node) { n.Left = c.(Expression) })
+		a.field(n, "Right", n.Right, func(c Node) { n.Right = c.(Expression) })
+	case *IfExpression:
+		a.field(n, "Condition", n.Condition, func(c Node) { n.Condition = c.(Expression) })
+		a.field(n, "Consequence", n.Consequence, func(c Node) { n.Consequence = c.(*BlockStatement) })
+		a.field(n, "Alternative", n.Alternative, func(c Node) { n.Alternative = c.(*BlockStatement) })
+	case *TryExpression:
+		a.field(n, "Block", n.Block, func(c Node) { n.Block = c.(*BlockStatement) })
+		a.field(n, "Parameter", n.Parameter, func(c Node) { n.Parameter = c.(*Identifier) })
+		a.field(n, "Catch", n.Catch, func(c Node) { n.Catch = c.(*BlockStatement) })
+		a.field(n, "Finally", n.Finally, func(c Node) { n.Finally = c.(*BlockStatement) })
+	case *MatchExpression:
+		a.field(n, "Subject", n.Subject, func(c Node) { n.Subject = c.(Expression) })
+		for i := range n.Arms {
+			arm := &n.Arms[i]
+			a.field(n, "Pattern", arm.Pattern, func(c Node) { arm.Pattern = c.(Pattern) })
+			a.field(n, "Guard", arm.Guard, func(c Node) { arm.Guard = c.(Expression) })
+			a.field(n, "Body", arm.Body, func(c Node) { arm.Body = c.(Expression) })
+		}
+	case *FunctionLiteral:
+		a.applyList(n, "Parameters", (*parameterList)(&n.Parameters))
+		a.field(n, "Rest", n.Rest, func(c Node) { n.Rest = c.(*Identifier) })
+		a.field(n, "Body", n.Body, func(c Node) { n.Body = c.(*BlockStatement) })
+	case *Parameter:
+		a.field(n, "Name", n.Name, func(c Node) { n.Name = c.(*Identifier) })
+		a.field(n, "Default", n.Default, func(c Node) { n.Default = c.(Expression) })
+	case *CallExpression:
+		a.field(n, "Function", n.Function, func(c Node) { n.Function = c.(Expression) })
+		a.applyList(n, "Arguments", (*expressionList)(&n.Arguments))
+	case *ArrayLiteral:
+		a.applyList(n, "Elements", (*expressionList)(&n.Elements))
+	case *SpreadElement:
+		a.field(n, "Value", n.Value, func(c Node) { n.Value = c.(Expression) })
+	case *HashLiteral:
+		for i := range n.Pairs {
+			pair := &n.Pairs[i]
+			a.field(n, "Key", pair.Key, func(c Node) { pair.Key = c.(Expression) })
+			a.field(n, "Value", pair.Value, func(c Node) { pair.Value = c.(Expression) })
+		}
+	case *IndexExpression:
+		a.field(n, "Left", n.Left, func(c Node) { n.Left = c.(Expression) })
+		a.field(n, "Index", n.Index, func(c Node) { n.Index = c.(Expression) })
+	case *MemberExpression:
+		a.field(n, "Object", n.Object, func(c Node) { n.Object = c.(Expression) })
+		a.field(n, "Member", n.Member, func(c Node) { n.Member = c.(*Identifier) })
+	case *ArrayPattern:
+		a.applyList(n, "Elements", (*patternList)(&n.Elements))
+		a.field(n, "Rest", n.Rest, func(c Node) { n.Rest = c.(*Identifier) })
+	case *HashPattern:
+		for i := range n.Pairs {
+			pair := &n.Pairs[i]
+			a.field(n, "Key", pair.Key, func(c Node) { pair.Key = c.(Expression) })
+			a.field(n, "Value", pair.Value, func(c Node) { pair.Value = c.(Pattern) })
+		}
+	case *Identifier, *IntegerLiteral, *Boolean, *NullLiteral, *StringLiteral, *WildcardPattern, nil:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast: Apply: unexpected node type %T", n))
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+}
+
+// field visits a child held in a plain field of parent, skipping nil children.
+func (a *application) field(parent Node, name string, child Node, set func(Node)) {
+	if isNil(child) {
+		return
+	}
+	a.apply(parent, name, set, nil, nil, child)
+}
+
+// applyList visits every element of list, allowing the callbacks to edit
+// the list while it is being traversed.
+func (a *application) applyList(parent Node, name string, list nodeList) {
+	it := &iterator{}
+	for it.index < list.len() {
+		it.step = 1
+		if child := list.at(it.index); !isNil(child) {
+			a.apply(parent, name, nil, list, it, child)
+		}
+		it.index += it.step
+	}
+}
+
+// isNil reports whether n is nil or a typed nil pointer to a node.
+func isNil(n Node) bool {
+	switch n := n.(type) {
+	case nil:
+		return true
+	case *Identifier:
+		return n == nil
+	case *BlockStatement:
+		return n == nil
+	}
+	return false
+}
+
+// nodeList abstracts over the slices of nodes found in the tree.
+type nodeList interface {
+	len() int
+	at(i int) Node
+	set(i int, n Node)
+	insert(i int, n Node)
+	delete(i int)
+}
+
+type statementList []Statement
+
+func (l *statementList) len() int          { return len(*l) }
+func (l *statementList) at(i int) Node     { return (*l)[i] }
+func (l *statementList) set(i int, n Node) { (*l)[i] = n.(Statement) }
+func (l *statementList) delete(i int)      { *l = append((*l)[:i], (*l)[i+1:]...) }
+func (l *statementList) insert(i int, n Node) {
+	*l = append(*l, nil)
+	copy((*l)[i+1:], (*l)[i:])
+	(*l)[i] = n.(Statement)
+}
+
+type expressionList []Expression
+
+func (l *expressionList) len() int          { return len(*l) }
+func (l *expressionList) at(i int) Node     { return (*l)[i] }
+func (l *expressionList) set(i int, n Node) { (*l)[i] = n.(Expression) }
+func (l *expressionList) delete(i int)      { *l = append((*l)[:i], (*l)[i+1:]...) }
+func (l *expressionList) insert(i int, n Node) {
+	*l = append(*l, nil)
+	copy((*l)[i+1:], (*l)[i:])
+	(*l)[i] = n.(Expression)
+}
+
+type parameterList []*Parameter
+
+func (l *parameterList) len() int          { return len(*l) }
+func (l *parameterList) at(i int) Node     { return (*l)[i] }
+func (l *parameterList) set(i int, n Node) { (*l)[i] = n.(*Parameter) }
+func (l *parameterList) delete(i int)      { *l = append((*l)[:i], (*l)[i+1:]...) }
+func (l *parameterList) insert(i int, n Node) {
+	*l = append(*l, nil)
+	copy((*l)[i+1:], (*l)[i:])
+	(*l)[i] = n.(*Parameter)
+}
+
+type patternList []Pattern
+
+func (l *patternList) len() int          { return len(*l) }
+func (l *patternList) at(i int) Node     { return (*l)[i] }
+func (l *patternList) set(i int, n Node) { (*l)[i] = n.(Pattern) }
+func (l *patternList) delete(i int)      { *l = append((*l)[:i], (*l)[i+1:]...) }
+func (l *patternList) insert(i int, n Node) {
+	*l = append(*l, nil)
+	copy((*l)[i+1:], (*l)[i:])
+	(*l)[i] = n.(Pattern)
+}
@@ -0,0 +1,173 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/parser"
+	"github.com/kellemNegasi/monkeylang/token"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestApplyReplace(t *testing.T) {
+	program := parse(t, "let x = 1 + 2; fn(a) { a * 3 }(4);")
+	ast.Apply(program, nil, func(c *ast.Cursor) bool {
+		if il, ok := c.Node().(*ast.IntegerLiteral); ok {
+			c.Replace(&ast.IntegerLiteral{
+				Token: token.Token{Type: token.INT, Literal: "10"},
+				Value: il.Value * 10,
+			})
+		}
+		return true
+	})
+	expected := "let x = (10 + 10);fn(a) (a * 10)(10)"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. want=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestApplyReplaceRoot(t *testing.T) {
+	program := parse(t, "-a")
+	expr := program.Statements[0].(*ast.ExpressionStatement).Expression
+	result := ast.Apply(expr, func(c *ast.Cursor) bool {
+		if pe, ok := c.Node().(*ast.PrefixExpression); ok && c.Parent() == nil {
+			c.Replace(pe.Right)
+		}
+		return true
+	}, nil)
+	if result.String() != "a" {
+		t.Errorf("result.String() wrong. want=%q, got=%q", "a", result.String())
+	}
+}
+
+func TestApplyDeleteAndInsert(t *testing.T) {
+	program := parse(t, `
+	let a = 1;
+	let debug = 0;
+	fn() { let debug = 2; return a; };
+	`)
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.LetStatement:
+			if n.Name.Value == "debug" {
+				c.Delete()
+				return false
+			}
+		case *ast.ReturnStatement:
+			c.InsertBefore(&ast.ExpressionStatement{
+				Token:      token.Token{Type: token.IDENT, Literal: "trace"},
+				Expression: ident("trace"),
+			})
+			c.InsertAfter(&ast.ExpressionStatement{
+				Token:      token.Token{Type: token.IDENT, Literal: "unreachable"},
+				Expression: ident("unreachable"),
+			})
+		}
+		return true
+	}, nil)
+
+	handBuilt := &ast.Program{Statements: []ast.Statement{
+		&ast.LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  ident("a"),
+			Value: &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1},
+		},
+		&ast.ExpressionStatement{
+			Token: token.Token{Type: token.FUNCTION, Literal: "fn"},
+			Expression: &ast.FunctionLiteral{
+				Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+				Parameters: []*ast.Parameter{},
+				Body: &ast.BlockStatement{
+					Token: token.Token{Type: token.LBRACE, Literal: "{"},
+					Statements: []ast.Statement{
+						&ast.ExpressionStatement{Expression: ident("trace")},
+						&ast.ReturnStatement{
+							Token:       token.Token{Type: token.RETURN, Literal: "return"},
+							ReturnValue: ident("a"),
+						},
+						&ast.ExpressionStatement{Expression: ident("unreachable")},
+					},
+				},
+			},
+		},
+	}}
+	if program.String() != handBuilt.String() {
+		t.Errorf("program.String() wrong. want=%q, got=%q", handBuilt.String(), program.String())
+	}
+	body := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral).Body
+	if len(body.Statements) != 3 {
+		t.Errorf("body has wrong number of statements. want=3, got=%d", len(body.Statements))
+	}
+}
+
+func TestApplyCursorInfo(t *testing.T) {
+	program := parse(t, "a; b + c;")
+	var got []string
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		if id, ok := c.Node().(*ast.Identifier); ok {
+			got = append(got, id.Value+":"+c.Name())
+		}
+		if _, ok := c.Node().(*ast.ExpressionStatement); ok && c.Index() < 0 {
+			t.Errorf("statement has no index in Program.Statements")
+		}
+		return true
+	}, nil)
+	expected := []string{"a:Expression", "b:Left", "c:Right"}
+	if len(got) != len(expected) {
+		t.Fatalf("visited wrong nodes. want=%v, got=%v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("visit %d wrong. want=%q, got=%q", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestApplySkipAndAbort(t *testing.T) {
+	program := parse(t, "a + b; c; d;")
+	var visited []string
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		if _, ok := c.Node().(*ast.InfixExpression); ok {
+			return false
+		}
+		return true
+	}, func(c *ast.Cursor) bool {
+		if id, ok := c.Node().(*ast.Identifier); ok {
+			visited = append(visited, id.Value)
+			return id.Value != "c"
+		}
+		return true
+	})
+	if len(visited) != 1 || visited[0] != "c" {
+		t.Errorf("wrong nodes visited. want=[c], got=%v", visited)
+	}
+}
+
+func TestDeleteOutsideListPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Delete outside of a list did not panic")
+		}
+	}()
+	program := parse(t, "-a;")
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		if _, ok := c.Node().(*ast.Identifier); ok {
+			c.Delete()
+		}
+		return true
+	}, nil)
+}
+
+func ident(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
@@ -3,6 +3,8 @@ package ast
 
 import (
 	"bytes"
+	"strconv"
+	"strings"
 
 	"github.com/kellemNegasi/monkeylang/token"
 )
@@ -28,6 +30,9 @@ type Expression interface {
 // Program defines a type that represents source code program which is made up of one or more statements.
 type Program struct {
 	Statements []Statement
+	// File is the name of the file the program was read from, if any. It
+	// is reported in the stack traces of runtime errors.
+	File string
 }
 
 // TokenLiteral is a method that returns the litral value of the token the node is associated with.
@@ -54,11 +59,13 @@ type Identifier struct {
 	Value string
 }
 
-// LetStatement represents a node for let statement binding.
+// LetStatement represents a node for let statement binding. A destructuring
+// let such as `let [a, b] = pair;` binds Pattern instead of Name.
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Pattern // an *ArrayPattern or *HashPattern, or nil
+	Value   Expression
 }
 
 type IntegerLiteral struct {
@@ -80,7 +87,11 @@ func (letStmnt *LetStatement) TokenLiteral() string {
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -89,6 +100,14 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// Names returns the identifiers ls binds, in source order.
+func (ls *LetStatement) Names() []*Identifier {
+	if ls.Pattern != nil {
+		return PatternNames(ls.Pattern)
+	}
+	return []*Identifier{ls.Name}
+}
+
 // ExpressionNode makes Identifier implement the Expression interface.
 func (id *Identifier) ExpressionNode() {
 
@@ -127,6 +146,45 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// ThrowStatement represents a `throw <expression>;` statement.
+type ThrowStatement struct {
+	Token token.Token // the `throw` token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// ImportStatement represents an `import "path" as name;` statement, which
+// binds name to the module read from the file at path.
+type ImportStatement struct {
+	Token token.Token // the `import` token
+	Path  *StringLiteral
+	Name  *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " " + strconv.Quote(is.Path.Value) + " as " + is.Name.String() + ";"
+}
+
+// ExportStatement represents an `export let name = value;` statement, which
+// makes name part of the module importing the file sees.
+type ExportStatement struct {
+	Token     token.Token // the `export` token
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
 // Expression statement represents an expression statement.
 type ExpressionStatement struct {
 	Token      token.Token // The first token of the expression
@@ -180,3 +238,574 @@ func (oe *InfixExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+
+// PipeExpression represents `left |> right`, which calls right with the value
+// of left inserted as its first argument: `x |> f(y)` is `f(x, y)`, and
+// `x |> f` is `f(x)`.
+type PipeExpression struct {
+	Token token.Token // the '|>' token
+	Left  Expression
+	Right Expression
+}
+
+func (pe *PipeExpression) ExpressionNode()      {}
+func (pe *PipeExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PipeExpression) String() string {
+	return "(" + pe.Left.String() + " |> " + pe.Right.String() + ")"
+}
+
+// Call returns the function the pipe calls and the arguments it calls it
+// with, in the order they are evaluated.
+func (pe *PipeExpression) Call() (Expression, []Expression) {
+	if call, ok := pe.Right.(*CallExpression); ok {
+		return call.Function, append([]Expression{pe.Left}, call.Arguments...)
+	}
+	return pe.Right, []Expression{pe.Left}
+}
+
+// ConditionalExpression represents `condition ? consequence : alternative`,
+// which evaluates only the branch the condition picks.
+type ConditionalExpression struct {
+	Token       token.Token // the '?' token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) ExpressionNode()      {}
+func (ce *ConditionalExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ConditionalExpression) String() string {
+	return "(" + ce.Condition.String() + " ? " + ce.Consequence.String() + " : " + ce.Alternative.String() + ")"
+}
+
+// CoalesceExpression represents `left ?? right`, which is left unless it is
+// null, and only then evaluates right.
+type CoalesceExpression struct {
+	Token token.Token // the '??' token
+	Left  Expression
+	Right Expression
+}
+
+func (ce *CoalesceExpression) ExpressionNode()      {}
+func (ce *CoalesceExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CoalesceExpression) String() string {
+	return "(" + ce.Left.String() + " ?? " + ce.Right.String() + ")"
+}
+
+// Boolean represents the boolean literals `true` and `false`.
+type Boolean struct {
+	Token token.Token
+	Value bool
+}
+
+func (b *Boolean) ExpressionNode()      {}
+func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) String() string       { return b.Token.Literal }
+
+// NullLiteral represents the literal `null`.
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (nl *NullLiteral) ExpressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) String() string       { return nl.Token.Literal }
+
+// StringLiteral represents a string literal such as "hello".
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) ExpressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+
+// TemplateLiteral represents a template literal such as `x is ${x}`. Its
+// value is the text of Strings with the values of Expressions, converted as
+// by str, in the holes between them.
+type TemplateLiteral struct {
+	Token       token.Token  // the TEMPLATE or TEMPLATE_HEAD token
+	Strings     []string     // the text around the holes, one more than Expressions
+	Expressions []Expression // the expressions of the holes
+}
+
+func (tl *TemplateLiteral) ExpressionNode()      {}
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TemplateLiteral) String() string {
+	var out bytes.Buffer
+	out.WriteString("`")
+	for i, s := range tl.Strings {
+		out.WriteString(s)
+		if i < len(tl.Expressions) {
+			out.WriteString("${" + tl.Expressions[i].String() + "}")
+		}
+	}
+	out.WriteString("`")
+	return out.String()
+}
+
+// BlockStatement represents a sequence of statements enclosed in braces.
+type BlockStatement struct {
+	Token      token.Token // the { token
+	Statements []Statement
+}
+
+func (bs *BlockStatement) statementNode()       {}
+func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+	}
+	return out.String()
+}
+
+// IfExpression represents an `if (condition) { ... } else { ... }` expression.
+type IfExpression struct {
+	Token       token.Token // The 'if' token
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) ExpressionNode()      {}
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("if")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ie.Consequence.String())
+	if ie.Alternative != nil {
+		out.WriteString("else ")
+		out.WriteString(ie.Alternative.String())
+	}
+	return out.String()
+}
+
+// TryExpression represents a `try { ... } catch (e) { ... } finally { ... }`
+// expression. At least one of Catch and Finally is set; Parameter is set
+// with Catch.
+type TryExpression struct {
+	Token     token.Token // the 'try' token
+	Block     *BlockStatement
+	Parameter *Identifier
+	Catch     *BlockStatement
+	Finally   *BlockStatement
+}
+
+func (te *TryExpression) ExpressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch(" + te.Parameter.String() + ") ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
+// MatchExpression represents a `match (subject) { pattern => body, ... }`
+// expression. It evaluates to the body of the first arm whose pattern matches
+// the subject and whose guard, if any, is truthy.
+type MatchExpression struct {
+	Token   token.Token // the 'match' token
+	Subject Expression
+	Arms    []MatchArm
+}
+
+// MatchArm is one `pattern if guard => body` arm of a MatchExpression. Guard
+// is nil for an arm without one.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    Expression
+}
+
+func (me *MatchExpression) ExpressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		s := arm.Pattern.String()
+		if arm.Guard != nil {
+			s += " if " + arm.Guard.String()
+		}
+		arms = append(arms, s+" => "+arm.Body.String())
+	}
+	if len(arms) == 0 {
+		return "match (" + me.Subject.String() + ") {}"
+	}
+	return "match (" + me.Subject.String() + ") { " + strings.Join(arms, ", ") + " }"
+}
+
+// FunctionLiteral represents a function definition such as `fn(x, y) { x + y; }`.
+// If Rest is set, as in `fn(x, ...rest) { rest }`, the function takes any
+// number of arguments after its parameters and Rest binds them as an array.
+// An arrow function such as `(x) => x * 2` is a function literal whose body
+// is a single expression statement.
+type FunctionLiteral struct {
+	Token      token.Token // The 'fn' token, or the '=>' of an arrow function
+	Parameters []*Parameter
+	Rest       *Identifier
+	Body       *BlockStatement
+	Arrow      bool // whether the function was written as `(params) => expression`
+}
+
+func (fl *FunctionLiteral) ExpressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
+	if fl.Arrow {
+		out.WriteString("(" + strings.Join(params, ", ") + ") => ")
+		out.WriteString(fl.Body.String())
+		return out.String()
+	}
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+	return out.String()
+}
+
+// Parameter represents a parameter of a function literal: a name such as `b`
+// or, for a parameter with a default value, `b = 2`. The default is evaluated
+// when a call passes no argument for the parameter. Parameters with defaults
+// come after those without.
+type Parameter struct {
+	Name    *Identifier
+	Default Expression // nil for a parameter without a default
+}
+
+func (p *Parameter) TokenLiteral() string { return p.Name.TokenLiteral() }
+func (p *Parameter) String() string {
+	if p.Default == nil {
+		return p.Name.String()
+	}
+	return p.Name.String() + " = " + p.Default.String()
+}
+
+// CallExpression represents a function call such as `add(1, 2)`. An
+// optional call such as `f?.(1)` is null, without evaluating its arguments,
+// when the function is null.
+type CallExpression struct {
+	Token     token.Token // The '(' token, or '?.' for an optional call
+	Function  Expression  // Identifier or FunctionLiteral
+	Arguments []Expression
+	Optional  bool
+}
+
+func (ce *CallExpression) ExpressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+	out.WriteString(ce.Function.String())
+	if ce.Optional {
+		out.WriteString("?.")
+	}
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+
+// ArrayLiteral represents an array literal such as `[1, 2 * 2, x]`.
+type ArrayLiteral struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) ExpressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// SpreadElement represents an array spread into the arguments of a call or
+// the elements of an array literal, such as `...xs` in `f(a, ...xs)`.
+type SpreadElement struct {
+	Token token.Token // the '...' token
+	Value Expression
+}
+
+func (se *SpreadElement) ExpressionNode()      {}
+func (se *SpreadElement) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadElement) String() string       { return "..." + se.Value.String() }
+
+// HashLiteral represents a hash literal such as `{"one": 1, two: 2}`.
+type HashLiteral struct {
+	Token token.Token // the '{' token
+	Pairs []HashPair  // in source order
+}
+
+// HashPair is a key and its value in a HashLiteral.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) ExpressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// IndexExpression represents an index operation such as `array[1]`. An
+// optional index such as `array?.[1]` is null, without evaluating the index,
+// when the value indexed is null.
+type IndexExpression struct {
+	Token    token.Token // the '[' token, or '?.' for an optional index
+	Left     Expression
+	Index    Expression
+	Optional bool
+}
+
+func (ie *IndexExpression) ExpressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?.")
+	}
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+	return out.String()
+}
+
+// MemberExpression represents a member access such as `lib.name`. An
+// optional member access such as `lib?.name` is null when the object is null.
+// Each `?.` only guards its own step: in `a?.b.c`, `.c` still fails on a null
+// `a?.b`.
+type MemberExpression struct {
+	Token    token.Token // the '.' token, or '?.' for an optional access
+	Object   Expression
+	Member   *Identifier
+	Optional bool
+}
+
+func (me *MemberExpression) ExpressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	if me.Optional {
+		return "(" + me.Object.String() + "?." + me.Member.String() + ")"
+	}
+	return "(" + me.Object.String() + "." + me.Member.String() + ")"
+}
+
+// Pattern is the target of a destructuring binding: an *Identifier, which
+// binds the whole value, a *WildcardPattern, an *ArrayPattern or a
+// *HashPattern. The patterns of a match arm may also be an *IntegerLiteral,
+// *StringLiteral, *Boolean or *NullLiteral, which match values equal to the
+// literal.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+func (id *Identifier) patternNode()     {}
+func (il *IntegerLiteral) patternNode() {}
+func (sl *StringLiteral) patternNode()  {}
+func (b *Boolean) patternNode()         {}
+func (nl *NullLiteral) patternNode()    {}
+
+// WildcardPattern represents the `_` pattern, which matches any value
+// without binding it.
+type WildcardPattern struct {
+	Token token.Token // the '_' token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// ArrayPattern represents an array pattern such as `[a, [b, c], ...rest]`.
+// It matches an array with one element for each of Elements; if Rest is set,
+// the array may have more, which Rest binds as a new array.
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Pattern
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, e := range ap.Elements {
+		elements = append(elements, e.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern represents a hash pattern such as `{name, "age": years}`. It
+// matches a hash holding every key of Pairs.
+type HashPattern struct {
+	Token token.Token // the '{' token
+	Pairs []HashPatternPair
+}
+
+// HashPatternPair is a key and the pattern its value must match in a
+// HashPattern. An *Identifier key stands for the string key of its name; a
+// pair written as just `name` has an identifier of that name as its value.
+type HashPatternPair struct {
+	Key   Expression // an *Identifier, *StringLiteral, *IntegerLiteral or *Boolean
+	Value Pattern
+}
+
+// Shorthand reports whether the pair is written as just the name it binds.
+func (p HashPatternPair) Shorthand() bool {
+	key, ok := p.Key.(*Identifier)
+	value, isIdentifier := p.Value.(*Identifier)
+	return ok && isIdentifier && key.Value == value.Value
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		if pair.Shorthand() {
+			pairs = append(pairs, pair.Value.String())
+		} else {
+			pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+		}
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// PatternNames returns the identifiers p binds, in source order.
+func PatternNames(p Pattern) []*Identifier {
+	switch p := p.(type) {
+	case *Identifier:
+		return []*Identifier{p}
+	case *ArrayPattern:
+		var names []*Identifier
+		for _, e := range p.Elements {
+			names = append(names, PatternNames(e)...)
+		}
+		if p.Rest != nil {
+			names = append(names, p.Rest)
+		}
+		return names
+	case *HashPattern:
+		var names []*Identifier
+		for _, pair := range p.Pairs {
+			names = append(names, PatternNames(pair.Value)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// TokenOf returns the token a node is positioned at, or the zero token for
+// nodes without one.
+func TokenOf(node Node) token.Token {
+	switch node := node.(type) {
+	case *LetStatement:
+		return node.Token
+	case *ReturnStatement:
+		return node.Token
+	case *ThrowStatement:
+		return node.Token
+	case *ImportStatement:
+		return node.Token
+	case *ExportStatement:
+		return node.Token
+	case *ExpressionStatement:
+		return node.Token
+	case *BlockStatement:
+		return node.Token
+	case *Identifier:
+		return node.Token
+	case *IntegerLiteral:
+		return node.Token
+	case *StringLiteral:
+		return node.Token
+	case *TemplateLiteral:
+		return node.Token
+	case *Boolean:
+		return node.Token
+	case *NullLiteral:
+		return node.Token
+	case *PrefixExpression:
+		return node.Token
+	case *InfixExpression:
+		return node.Token
+	case *PipeExpression:
+		return node.Token
+	case *ConditionalExpression:
+		return node.Token
+	case *CoalesceExpression:
+		return node.Token
+	case *IfExpression:
+		return node.Token
+	case *TryExpression:
+		return node.Token
+	case *MatchExpression:
+		return node.Token
+	case *FunctionLiteral:
+		return node.Token
+	case *Parameter:
+		return node.Name.Token
+	case *CallExpression:
+		return node.Token
+	case *ArrayLiteral:
+		return node.Token
+	case *SpreadElement:
+		return node.Token
+	case *HashLiteral:
+		return node.Token
+	case *IndexExpression:
+		return node.Token
+	case *MemberExpression:
+		return node.Token
+	case *ArrayPattern:
+		return node.Token
+	case *HashPattern:
+		return node.Token
+	case *WildcardPattern:
+		return node.Token
+	}
+	return token.Token{}
+}
@@ -0,0 +1,31 @@
+package ast
+
+// BoundNames returns the identifiers node binds as it runs: the names of its
+// let and import statements, the parameters of its catch blocks and the names
+// of the patterns of its match arms, in the order Apply reaches the
+// statements and expressions binding them. A name bound several times
+// appears each time. Function literals nested in node are not
+// searched, and neither are the parameters of node itself if it is one.
+func BoundNames(node Node) []*Identifier {
+	var names []*Identifier
+	Apply(node, func(c *Cursor) bool {
+		switch n := c.Node().(type) {
+		case *FunctionLiteral:
+			return n == node
+		case *LetStatement:
+			names = append(names, n.Names()...)
+		case *ImportStatement:
+			names = append(names, n.Name)
+		case *TryExpression:
+			if n.Parameter != nil {
+				names = append(names, n.Parameter)
+			}
+		case *MatchExpression:
+			for _, arm := range n.Arms {
+				names = append(names, PatternNames(arm.Pattern)...)
+			}
+		}
+		return true
+	}, nil)
+	return names
+}
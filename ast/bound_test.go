@@ -0,0 +1,50 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+)
+
+func TestBoundNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn(a) { a }", nil},
+		{"fn(a) { let b = a; let [c, ...d] = b; let {e: f} = c; b }", []string{"b", "c", "d", "f"}},
+		{"fn() { if (x) { let a = 1 } else { let b = 2 } }", []string{"a", "b"}},
+		{"fn() { try { let a = 1 } catch (e) { let b = e } finally { let c = 3 } }", []string{"e", "a", "b", "c"}},
+		{"fn() { match (x) { [a, _] if (let_ok) => a, {k: b} => b, _ => 0 } }", []string{"a", "b"}},
+		{"fn() { let f = fn(a) { let b = a; b }; f }", []string{"f"}},
+		{"fn(a = match (x) { y => y }) { let a = 1; a }", []string{"y", "a"}},
+		{"fn() { let a = 1; let a = 2; a }", []string{"a", "a"}},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		var got []string
+		for _, name := range ast.BoundNames(fn) {
+			got = append(got, name.Value)
+		}
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: wrong names. want=%q, got=%q", tt.input, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%q: wrong names. want=%q, got=%q", tt.input, tt.expected, got)
+				break
+			}
+		}
+	}
+
+	program := parse(t, `import "m" as m; let a = 1; export let b = 2; fn() { let c = 3 }`)
+	var got []string
+	for _, name := range ast.BoundNames(program) {
+		got = append(got, name.Value)
+	}
+	if len(got) != 3 || got[0] != "m" || got[1] != "a" || got[2] != "b" {
+		t.Errorf("wrong names of a program. want=[m a b], got=%q", got)
+	}
+}
@@ -0,0 +1,835 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kellemNegasi/monkeylang/token"
+)
+
+// The JSON form of a node is an object whose "kind" member names the node type
+// (e.g. "InfixExpression"). Every node carries its token as an object holding
+// the token type, literal, line and column. The remaining members mirror the
+// node's fields in lower camel case. Nil children are encoded as null.
+
+// MarshalJSON encodes any node of the tree as JSON.
+func MarshalJSON(n Node) ([]byte, error) {
+	v, err := encodeNode(n)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a node previously encoded with MarshalJSON.
+func UnmarshalJSON(data []byte) (Node, error) {
+	return decodeNode(data)
+}
+
+// MarshalJSON makes Program implement json.Marshaler.
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return MarshalJSON(p)
+}
+
+// UnmarshalJSON makes Program implement json.Unmarshaler.
+func (p *Program) UnmarshalJSON(data []byte) error {
+	n, err := decodeNode(data)
+	if err != nil {
+		return err
+	}
+	program, ok := n.(*Program)
+	if !ok {
+		return fmt.Errorf("ast: expected Program, got %T", n)
+	}
+	*p = *program
+	return nil
+}
+
+// object is a JSON object that keeps its members in insertion order.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, m := range o {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		key, _ := json.Marshal(m.key)
+		out.Write(key)
+		out.WriteString(":")
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(value)
+	}
+	out.WriteString("}")
+	return out.Bytes(), nil
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Line    int             `json:"line"`
+	Column  int             `json:"column"`
+}
+
+func encodeToken(t token.Token) jsonToken {
+	return jsonToken{Type: t.Type, Literal: t.Literal, Line: t.Line, Column: t.Column}
+}
+
+func (t jsonToken) token() token.Token {
+	return token.Token{Type: t.Type, Literal: t.Literal, Line: t.Line, Column: t.Column}
+}
+
+// encodeNode converts n into a value encoding/json can marshal.
+func encodeNode(n Node) (interface{}, error) {
+	if isNil(n) {
+		return nil, nil
+	}
+	o := object{{"kind", kindOf(n)}}
+	add := func(key string, value interface{}) { o = append(o, member{key, value}) }
+	addNode := func(key string, child Node) error {
+		v, err := encodeNode(child)
+		if err != nil {
+			return err
+		}
+		add(key, v)
+		return nil
+	}
+	addList := func(key string, children []Node, isNilSlice bool) error {
+		if isNilSlice {
+			add(key, nil)
+			return nil
+		}
+		list := make([]interface{}, len(children))
+		for i, child := range children {
+			v, err := encodeNode(child)
+			if err != nil {
+				return err
+			}
+			list[i] = v
+		}
+		add(key, list)
+		return nil
+	}
+
+	var err error
+	switch n := n.(type) {
+	case *Program:
+		if n.File != "" {
+			add("file", n.File)
+		}
+		err = addList("statements", statementNodes(n.Statements), n.Statements == nil)
+	case *LetStatement:
+		add("token", encodeToken(n.Token))
+		if err = addNode("name", n.Name); err == nil {
+			if err = addNode("pattern", n.Pattern); err == nil {
+				err = addNode("value", n.Value)
+			}
+		}
+	case *ReturnStatement:
+		add("token", encodeToken(n.Token))
+		err = addNode("returnValue", n.ReturnValue)
+	case *ThrowStatement:
+		add("token", encodeToken(n.Token))
+		err = addNode("value", n.Value)
+	case *ImportStatement:
+		add("token", encodeToken(n.Token))
+		if err = addNode("path", n.Path); err == nil {
+			err = addNode("name", n.Name)
+		}
+	case *ExportStatement:
+		add("token", encodeToken(n.Token))
+		err = addNode("statement", n.Statement)
+	case *ExpressionStatement:
+		add("token", encodeToken(n.Token))
+		err = addNode("expression", n.Expression)
+	case *BlockStatement:
+		add("token", encodeToken(n.Token))
+		err = addList("statements", statementNodes(n.Statements), n.Statements == nil)
+	case *Identifier:
+		add("token", encodeToken(n.Token))
+		add("value", n.Value)
+	case *IntegerLiteral:
+		add("token", encodeToken(n.Token))
+		add("value", n.Value)
+	case *Boolean:
+		add("token", encodeToken(n.Token))
+		add("value", n.Value)
+	case *NullLiteral:
+		add("token", encodeToken(n.Token))
+	case *TemplateLiteral:
+		add("token", encodeToken(n.Token))
+		add("strings", n.Strings)
+		err = addList("expressions", expressionNodes(n.Expressions), n.Expressions == nil)
+	case *StringLiteral:
+		add("token", encodeToken(n.Token))
+		add("value", n.Value)
+	case *PrefixExpression:
+		add("token", encodeToken(n.Token))
+		add("operator", n.Operator)
+		err = addNode("right", n.Right)
+	case *InfixExpression:
+		add("token", encodeToken(n.Token))
+		add("operator", n.Operator)
+		if err = addNode("left", n.Left); err == nil {
+			err = addNode("right", n.Right)
+		}
+	case *PipeExpression:
+		add("token", encodeToken(n.Token))
+		if err = addNode("left", n.Left); err == nil {
+			err = addNode("right", n.Right)
+		}
+	case *ConditionalExpression:
+		add("token", encodeToken(n.Token))
+		if err = addNode("condition", n.Condition); err == nil {
+			if err = addNode("consequence", n.Consequence); err == nil {
+				err = addNode("alternative", n.Alternative)
+			}
+		}
+	case *CoalesceExpression:
+		add("token", encodeToken(n.Token))
+		if err = addNode("left", n.Left); err == nil {
+			err = addNode("right", n.Right)
+		}
+	case *IfExpression:
+		add("token", encodeToken(n.Token))
+		if err = addNode("condition", n.Condition); err == nil {
+			if err = addNode("consequence", n.Consequence); err == nil {
+				err = addNode("alternative", n.Alternative)
+			}
+		}
+	case *TryExpression:
+		add("token", encodeToken(n.Token))
+		if err = addNode("block", n.Block); err == nil {
+			if err = addNode("parameter", n.Parameter); err == nil {
+				if err = addNode("catch", n.Catch); err == nil {
+					err = addNode("finally", n.Finally)
+				}
+			}
+		}
+	case *MatchExpression:
+		// Arms are not nodes: each is an object holding a pattern, a guard
+		// and a body.
+		add("token", encodeToken(n.Token))
+		if err = addNode("subject", n.Subject); err != nil {
+			break
+		}
+		if n.Arms == nil {
+			add("arms", nil)
+			break
+		}
+		arms := make([]interface{}, len(n.Arms))
+		for i, arm := range n.Arms {
+			pattern, err := encodeNode(arm.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			guard, err := encodeNode(arm.Guard)
+			if err != nil {
+				return nil, err
+			}
+			body, err := encodeNode(arm.Body)
+			if err != nil {
+				return nil, err
+			}
+			arms[i] = object{{"pattern", pattern}, {"guard", guard}, {"body", body}}
+		}
+		add("arms", arms)
+	case *FunctionLiteral:
+		add("token", encodeToken(n.Token))
+		params := make([]Node, len(n.Parameters))
+		for i, p := range n.Parameters {
+			params[i] = p
+		}
+		if err = addList("parameters", params, n.Parameters == nil); err == nil {
+			if err = addNode("rest", n.Rest); err == nil {
+				err = addNode("body", n.Body)
+			}
+		}
+		add("arrow", n.Arrow)
+	case *Parameter:
+		// Parameters have no token of their own: theirs is that of the name.
+		if err = addNode("name", n.Name); err == nil {
+			err = addNode("default", n.Default)
+		}
+	case *CallExpression:
+		add("token", encodeToken(n.Token))
+		if err = addNode("function", n.Function); err == nil {
+			err = addList("arguments", expressionNodes(n.Arguments), n.Arguments == nil)
+		}
+		add("optional", n.Optional)
+	case *ArrayLiteral:
+		add("token", encodeToken(n.Token))
+		err = addList("elements", expressionNodes(n.Elements), n.Elements == nil)
+	case *SpreadElement:
+		add("token", encodeToken(n.Token))
+		err = addNode("value", n.Value)
+	case *HashLiteral:
+		// Pairs are not nodes: each is an object holding a key and a value.
+		add("token", encodeToken(n.Token))
+		if n.Pairs == nil {
+			add("pairs", nil)
+			break
+		}
+		pairs := make([]interface{}, len(n.Pairs))
+		for i, pair := range n.Pairs {
+			key, err := encodeNode(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := encodeNode(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			pairs[i] = object{{"key", key}, {"value", value}}
+		}
+		add("pairs", pairs)
+	case *IndexExpression:
+		add("token", encodeToken(n.Token))
+		if err = addNode("left", n.Left); err == nil {
+			err = addNode("index", n.Index)
+		}
+		add("optional", n.Optional)
+	case *MemberExpression:
+		add("token", encodeToken(n.Token))
+		if err = addNode("object", n.Object); err == nil {
+			err = addNode("member", n.Member)
+		}
+		add("optional", n.Optional)
+	case *ArrayPattern:
+		add("token", encodeToken(n.Token))
+		elements := make([]Node, len(n.Elements))
+		for i, e := range n.Elements {
+			elements[i] = e
+		}
+		if err = addList("elements", elements, n.Elements == nil); err == nil {
+			err = addNode("rest", n.Rest)
+		}
+	case *HashPattern:
+		// Like those of a HashLiteral, pairs are objects holding a key and a
+		// value.
+		add("token", encodeToken(n.Token))
+		if n.Pairs == nil {
+			add("pairs", nil)
+			break
+		}
+		pairs := make([]interface{}, len(n.Pairs))
+		for i, pair := range n.Pairs {
+			key, err := encodeNode(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := encodeNode(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			pairs[i] = object{{"key", key}, {"value", value}}
+		}
+		add("pairs", pairs)
+	case *WildcardPattern:
+		add("token", encodeToken(n.Token))
+	default:
+		return nil, fmt.Errorf("ast: cannot encode node of type %T", n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func statementNodes(statements []Statement) []Node {
+	nodes := make([]Node, len(statements))
+	for i, s := range statements {
+		nodes[i] = s
+	}
+	return nodes
+}
+
+func expressionNodes(expressions []Expression) []Node {
+	nodes := make([]Node, len(expressions))
+	for i, e := range expressions {
+		nodes[i] = e
+	}
+	return nodes
+}
+
+// kindOf returns the discriminator used for n in the JSON form.
+func kindOf(n Node) string {
+	return fmt.Sprintf("%T", n)[len("*ast."):]
+}
+
+// fields holds the undecoded members of a JSON node object.
+type fields map[string]json.RawMessage
+
+func (f fields) token() (token.Token, error) {
+	var t jsonToken
+	raw, ok := f["token"]
+	if !ok {
+		return token.Token{}, fmt.Errorf("ast: %s node has no token", f.kind())
+	}
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return token.Token{}, fmt.Errorf("ast: bad token in %s node: %w", f.kind(), err)
+	}
+	return t.token(), nil
+}
+
+func (f fields) kind() string {
+	var kind string
+	_ = json.Unmarshal(f["kind"], &kind)
+	return kind
+}
+
+func (f fields) value(key string, v interface{}) error {
+	if err := json.Unmarshal(f[key], v); err != nil {
+		return fmt.Errorf("ast: bad %q in %s node: %w", key, f.kind(), err)
+	}
+	return nil
+}
+
+func (f fields) node(key string) (Node, error) {
+	raw, ok := f[key]
+	if !ok {
+		return nil, nil
+	}
+	return decodeNode(raw)
+}
+
+func (f fields) expression(key string) (Expression, error) {
+	n, err := f.node(key)
+	if n == nil || err != nil {
+		return nil, err
+	}
+	e, ok := n.(Expression)
+	if !ok {
+		return nil, fmt.Errorf("ast: %q in %s node must be an expression, got %s", key, f.kind(), kindOf(n))
+	}
+	return e, nil
+}
+
+func (f fields) identifier(key string) (*Identifier, error) {
+	n, err := f.node(key)
+	if n == nil || err != nil {
+		return nil, err
+	}
+	id, ok := n.(*Identifier)
+	if !ok {
+		return nil, fmt.Errorf("ast: %q in %s node must be an Identifier, got %s", key, f.kind(), kindOf(n))
+	}
+	return id, nil
+}
+
+func (f fields) stringLiteral(key string) (*StringLiteral, error) {
+	n, err := f.node(key)
+	if n == nil || err != nil {
+		return nil, err
+	}
+	s, ok := n.(*StringLiteral)
+	if !ok {
+		return nil, fmt.Errorf("ast: %q in %s node must be a StringLiteral, got %s", key, f.kind(), kindOf(n))
+	}
+	return s, nil
+}
+
+func (f fields) pattern(key string) (Pattern, error) {
+	n, err := f.node(key)
+	if n == nil || err != nil {
+		return nil, err
+	}
+	p, ok := n.(Pattern)
+	if !ok {
+		return nil, fmt.Errorf("ast: %q in %s node must be a pattern, got %s", key, f.kind(), kindOf(n))
+	}
+	return p, nil
+}
+
+func (f fields) let(key string) (*LetStatement, error) {
+	n, err := f.node(key)
+	if n == nil || err != nil {
+		return nil, err
+	}
+	s, ok := n.(*LetStatement)
+	if !ok {
+		return nil, fmt.Errorf("ast: %q in %s node must be a LetStatement, got %s", key, f.kind(), kindOf(n))
+	}
+	return s, nil
+}
+
+func (f fields) block(key string) (*BlockStatement, error) {
+	n, err := f.node(key)
+	if n == nil || err != nil {
+		return nil, err
+	}
+	b, ok := n.(*BlockStatement)
+	if !ok {
+		return nil, fmt.Errorf("ast: %q in %s node must be a BlockStatement, got %s", key, f.kind(), kindOf(n))
+	}
+	return b, nil
+}
+
+// list decodes the array stored under key. A null or missing member yields
+// a nil slice so that nil and empty lists survive the round trip.
+func (f fields) list(key string) ([]Node, error) {
+	var raws []json.RawMessage
+	if err := f.value(key, &raws); err != nil || raws == nil {
+		return nil, err
+	}
+	nodes := make([]Node, len(raws))
+	for i, raw := range raws {
+		n, err := decodeNode(raw)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
+
+func (f fields) statements(key string) ([]Statement, error) {
+	nodes, err := f.list(key)
+	if nodes == nil || err != nil {
+		return nil, err
+	}
+	statements := make([]Statement, len(nodes))
+	for i, n := range nodes {
+		s, ok := n.(Statement)
+		if !ok {
+			return nil, fmt.Errorf("ast: %q in %s node must hold statements, got %s", key, f.kind(), kindOf(n))
+		}
+		statements[i] = s
+	}
+	return statements, nil
+}
+
+func (f fields) expressions(key string) ([]Expression, error) {
+	nodes, err := f.list(key)
+	if nodes == nil || err != nil {
+		return nil, err
+	}
+	expressions := make([]Expression, len(nodes))
+	for i, n := range nodes {
+		e, ok := n.(Expression)
+		if !ok {
+			return nil, fmt.Errorf("ast: %q in %s node must hold expressions, got %s", key, f.kind(), kindOf(n))
+		}
+		expressions[i] = e
+	}
+	return expressions, nil
+}
+
+// decodeNode rebuilds a node from its JSON form.
+func decodeNode(data []byte) (Node, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil
+	}
+	var f fields
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("ast: %w", err)
+	}
+	kind := f.kind()
+	if kind == "Program" {
+		statements, err := f.statements("statements")
+		if err != nil {
+			return nil, err
+		}
+		program := &Program{Statements: statements}
+		if _, ok := f["file"]; ok {
+			err = f.value("file", &program.File)
+		}
+		return program, err
+	}
+	if kind == "Parameter" {
+		param := &Parameter{}
+		name, err := f.identifier("name")
+		if err != nil {
+			return nil, err
+		}
+		if name == nil {
+			return nil, fmt.Errorf("ast: Parameter node has no name")
+		}
+		param.Name = name
+		param.Default, err = f.expression("default")
+		return param, err
+	}
+	tok, err := f.token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "LetStatement":
+		n := &LetStatement{Token: tok}
+		if n.Name, err = f.identifier("name"); err != nil {
+			return nil, err
+		}
+		if n.Pattern, err = f.pattern("pattern"); err != nil {
+			return nil, err
+		}
+		n.Value, err = f.expression("value")
+		return n, err
+	case "ReturnStatement":
+		n := &ReturnStatement{Token: tok}
+		n.ReturnValue, err = f.expression("returnValue")
+		return n, err
+	case "ThrowStatement":
+		n := &ThrowStatement{Token: tok}
+		n.Value, err = f.expression("value")
+		return n, err
+	case "ImportStatement":
+		n := &ImportStatement{Token: tok}
+		if n.Path, err = f.stringLiteral("path"); err != nil {
+			return nil, err
+		}
+		n.Name, err = f.identifier("name")
+		return n, err
+	case "ExportStatement":
+		n := &ExportStatement{Token: tok}
+		n.Statement, err = f.let("statement")
+		return n, err
+	case "ExpressionStatement":
+		n := &ExpressionStatement{Token: tok}
+		n.Expression, err = f.expression("expression")
+		return n, err
+	case "BlockStatement":
+		n := &BlockStatement{Token: tok}
+		n.Statements, err = f.statements("statements")
+		return n, err
+	case "Identifier":
+		n := &Identifier{Token: tok}
+		return n, f.value("value", &n.Value)
+	case "IntegerLiteral":
+		n := &IntegerLiteral{Token: tok}
+		return n, f.value("value", &n.Value)
+	case "Boolean":
+		n := &Boolean{Token: tok}
+		return n, f.value("value", &n.Value)
+	case "NullLiteral":
+		return &NullLiteral{Token: tok}, nil
+	case "TemplateLiteral":
+		n := &TemplateLiteral{Token: tok}
+		if err = f.value("strings", &n.Strings); err != nil {
+			return nil, err
+		}
+		if n.Expressions, err = f.expressions("expressions"); err != nil {
+			return nil, err
+		}
+		if len(n.Strings) != len(n.Expressions)+1 {
+			return nil, fmt.Errorf("ast: TemplateLiteral has %d strings for %d expressions", len(n.Strings), len(n.Expressions))
+		}
+		return n, nil
+	case "StringLiteral":
+		n := &StringLiteral{Token: tok}
+		return n, f.value("value", &n.Value)
+	case "PrefixExpression":
+		n := &PrefixExpression{Token: tok}
+		if err = f.value("operator", &n.Operator); err != nil {
+			return nil, err
+		}
+		n.Right, err = f.expression("right")
+		return n, err
+	case "InfixExpression":
+		n := &InfixExpression{Token: tok}
+		if err = f.value("operator", &n.Operator); err != nil {
+			return nil, err
+		}
+		if n.Left, err = f.expression("left"); err != nil {
+			return nil, err
+		}
+		n.Right, err = f.expression("right")
+		return n, err
+	case "PipeExpression":
+		n := &PipeExpression{Token: tok}
+		if n.Left, err = f.expression("left"); err != nil {
+			return nil, err
+		}
+		n.Right, err = f.expression("right")
+		return n, err
+	case "ConditionalExpression":
+		n := &ConditionalExpression{Token: tok}
+		if n.Condition, err = f.expression("condition"); err != nil {
+			return nil, err
+		}
+		if n.Consequence, err = f.expression("consequence"); err != nil {
+			return nil, err
+		}
+		n.Alternative, err = f.expression("alternative")
+		return n, err
+	case "CoalesceExpression":
+		n := &CoalesceExpression{Token: tok}
+		if n.Left, err = f.expression("left"); err != nil {
+			return nil, err
+		}
+		n.Right, err = f.expression("right")
+		return n, err
+	case "IfExpression":
+		n := &IfExpression{Token: tok}
+		if n.Condition, err = f.expression("condition"); err != nil {
+			return nil, err
+		}
+		if n.Consequence, err = f.block("consequence"); err != nil {
+			return nil, err
+		}
+		n.Alternative, err = f.block("alternative")
+		return n, err
+	case "TryExpression":
+		n := &TryExpression{Token: tok}
+		if n.Block, err = f.block("block"); err != nil {
+			return nil, err
+		}
+		if n.Parameter, err = f.identifier("parameter"); err != nil {
+			return nil, err
+		}
+		if n.Catch, err = f.block("catch"); err != nil {
+			return nil, err
+		}
+		n.Finally, err = f.block("finally")
+		return n, err
+	case "MatchExpression":
+		n := &MatchExpression{Token: tok}
+		if n.Subject, err = f.expression("subject"); err != nil {
+			return nil, err
+		}
+		var arms []fields
+		if err := f.value("arms", &arms); err != nil || arms == nil {
+			return n, err
+		}
+		n.Arms = make([]MatchArm, len(arms))
+		for i, arm := range arms {
+			arm["kind"] = f["kind"] // names the node in errors
+			if n.Arms[i].Pattern, err = arm.pattern("pattern"); err != nil {
+				return nil, err
+			}
+			if n.Arms[i].Guard, err = arm.expression("guard"); err != nil {
+				return nil, err
+			}
+			if n.Arms[i].Body, err = arm.expression("body"); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	case "FunctionLiteral":
+		n := &FunctionLiteral{Token: tok}
+		params, err := f.list("parameters")
+		if err != nil {
+			return nil, err
+		}
+		if params != nil {
+			n.Parameters = make([]*Parameter, len(params))
+			for i, p := range params {
+				param, ok := p.(*Parameter)
+				if !ok {
+					return nil, fmt.Errorf("ast: FunctionLiteral parameters must be Parameters, got %s", kindOf(p))
+				}
+				n.Parameters[i] = param
+			}
+		}
+		if n.Rest, err = f.identifier("rest"); err != nil {
+			return nil, err
+		}
+		if n.Body, err = f.block("body"); err != nil {
+			return nil, err
+		}
+		return n, f.value("arrow", &n.Arrow)
+	case "CallExpression":
+		n := &CallExpression{Token: tok}
+		if n.Function, err = f.expression("function"); err != nil {
+			return nil, err
+		}
+		if n.Arguments, err = f.expressions("arguments"); err != nil {
+			return nil, err
+		}
+		return n, f.value("optional", &n.Optional)
+	case "ArrayLiteral":
+		n := &ArrayLiteral{Token: tok}
+		n.Elements, err = f.expressions("elements")
+		return n, err
+	case "SpreadElement":
+		n := &SpreadElement{Token: tok}
+		n.Value, err = f.expression("value")
+		return n, err
+	case "HashLiteral":
+		n := &HashLiteral{Token: tok}
+		var pairs []fields
+		if err := f.value("pairs", &pairs); err != nil || pairs == nil {
+			return n, err
+		}
+		n.Pairs = make([]HashPair, len(pairs))
+		for i, pair := range pairs {
+			pair["kind"] = f["kind"] // names the node in errors
+			if n.Pairs[i].Key, err = pair.expression("key"); err != nil {
+				return nil, err
+			}
+			if n.Pairs[i].Value, err = pair.expression("value"); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	case "IndexExpression":
+		n := &IndexExpression{Token: tok}
+		if n.Left, err = f.expression("left"); err != nil {
+			return nil, err
+		}
+		if n.Index, err = f.expression("index"); err != nil {
+			return nil, err
+		}
+		return n, f.value("optional", &n.Optional)
+	case "MemberExpression":
+		n := &MemberExpression{Token: tok}
+		if n.Object, err = f.expression("object"); err != nil {
+			return nil, err
+		}
+		if n.Member, err = f.identifier("member"); err != nil {
+			return nil, err
+		}
+		return n, f.value("optional", &n.Optional)
+	case "ArrayPattern":
+		n := &ArrayPattern{Token: tok}
+		elements, err := f.list("elements")
+		if err != nil {
+			return nil, err
+		}
+		if elements != nil {
+			n.Elements = make([]Pattern, len(elements))
+			for i, e := range elements {
+				p, ok := e.(Pattern)
+				if !ok {
+					return nil, fmt.Errorf("ast: ArrayPattern elements must be patterns, got %s", kindOf(e))
+				}
+				n.Elements[i] = p
+			}
+		}
+		n.Rest, err = f.identifier("rest")
+		return n, err
+	case "HashPattern":
+		n := &HashPattern{Token: tok}
+		var pairs []fields
+		if err := f.value("pairs", &pairs); err != nil || pairs == nil {
+			return n, err
+		}
+		n.Pairs = make([]HashPatternPair, len(pairs))
+		for i, pair := range pairs {
+			pair["kind"] = f["kind"] // names the node in errors
+			if n.Pairs[i].Key, err = pair.expression("key"); err != nil {
+				return nil, err
+			}
+			if n.Pairs[i].Value, err = pair.pattern("value"); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	case "WildcardPattern":
+		return &WildcardPattern{Token: tok}, nil
+	case "":
+		return nil, fmt.Errorf("ast: node has no kind")
+	default:
+		return nil, fmt.Errorf("ast: unknown node kind %q", kind)
+	}
+}
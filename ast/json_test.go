@@ -0,0 +1,192 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"let x = 5;",
+		"return -a * (b + c);",
+		"let add = fn(a, b) { return a + b; }; add(1, 2 * 3);",
+		"if (x < y) { x } else { y }",
+		"if (!true) { fn() {} }",
+		"fn(x) { fn(y) { x == y } }(1)(2) != false",
+		`let greeting = "hello \"world\"";`,
+		"[]; [1, [2]][0][x + 1]; f(a)[0](b);",
+		`{}; {"a": 1, 2: {true: [x]}}["a"];`,
+		`try { throw f(1); } catch (e) { e } finally { g() }; try {} finally {}`,
+		`import "lib.mk" as lib; export let x = lib.f(1).y;`,
+		`let [a, [b], {c, "d": e, f: {g}}, ...rest] = x; let [] = y; let {} = z;`,
+		`match (x) { 0 => "zero", [a, _] if a > 1 => a, {"k": true} => k, _ => "other" }`,
+		"let f = fn(a, b = a + 1, ...rest) { [...rest, b] }; f(...xs, 1);",
+		"xs |> filter((x) => x > 1) |> map(() => 1) |> (a, ...b) => b;",
+		"a ? b ?? null : c?.d?.[e]?.(f).g;",
+		"`plain`; `a ${x} b ${`c${y}`} d`; ``;",
+	}
+	for _, input := range inputs {
+		checkRoundTrip(t, input)
+	}
+}
+
+// TestJSONRoundTripProperty checks the round trip on randomly generated programs.
+func TestJSONRoundTripProperty(t *testing.T) {
+	r := rand.New(rand.NewSource(26))
+	for i := 0; i < 300; i++ {
+		checkRoundTrip(t, randomProgram(r))
+	}
+}
+
+func checkRoundTrip(t *testing.T, input string) {
+	t.Helper()
+	program := parse(t, input)
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("json.Marshal(%q) failed: %v", input, err)
+	}
+	var decoded ast.Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal failed for %q: %v\n%s", input, err, data)
+	}
+	if decoded.String() != program.String() {
+		t.Errorf("String() mismatch for %q. want=%q, got=%q", input, program.String(), decoded.String())
+	}
+	if !reflect.DeepEqual(&decoded, program) {
+		t.Errorf("decoded tree differs from the original for %q\n%s", input, data)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	program := parse(t, "-x")
+	data, err := ast.MarshalJSON(program.Statements[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"kind":"ExpressionStatement","token":{"type":"-","literal":"-","line":1,"column":1},` +
+		`"expression":{"kind":"PrefixExpression","token":{"type":"-","literal":"-","line":1,"column":1},"operator":"-",` +
+		`"right":{"kind":"Identifier","token":{"type":"IDENT","literal":"x","line":1,"column":2},"value":"x"}}}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot= %s", expected, data)
+	}
+	node, err := ast.UnmarshalJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(node, program.Statements[0]) {
+		t.Errorf("decoded node differs from the original")
+	}
+
+	program = &ast.Program{Statements: []ast.Statement{}, File: "main.mk"}
+	data, err = ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"kind":"Program","file":"main.mk","statements":[]}`; string(data) != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot= %s", expected, data)
+	}
+	if node, err = ast.UnmarshalJSON(data); err != nil || !reflect.DeepEqual(node, program) {
+		t.Errorf("decoded program differs from the original: %#v (%v)", node, err)
+	}
+}
+
+func TestJSONDecodeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Nope","token":{}}`, `unknown node kind "Nope"`},
+		{`{"token":{}}`, "node has no kind"},
+		{`{"kind":"Identifier","value":"x"}`, "Identifier node has no token"},
+		{`{"kind":"LetStatement","token":{},"name":{"kind":"Boolean","token":{},"value":true}}`,
+			`"name" in LetStatement node must be an Identifier`},
+		{`{"kind":"Program","statements":[{"kind":"Identifier","token":{},"value":"x"}]}`,
+			`must hold statements`},
+		{`[1]`, "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		_, err := ast.UnmarshalJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("UnmarshalJSON(%s) error wrong. want containing %q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// randomProgram generates the source of a small random Monkey program.
+func randomProgram(r *rand.Rand) string {
+	var statements []string
+	for i := r.Intn(4); i >= 0; i-- {
+		statements = append(statements, randomStatement(r, 3))
+	}
+	return strings.Join(statements, "\n")
+}
+
+func randomStatement(r *rand.Rand, depth int) string {
+	switch r.Intn(3) {
+	case 0:
+		return fmt.Sprintf("let %s = %s;", randomName(r), randomExpression(r, depth))
+	case 1:
+		return fmt.Sprintf("return %s;", randomExpression(r, depth))
+	default:
+		return randomExpression(r, depth) + ";"
+	}
+}
+
+func randomBlock(r *rand.Rand, depth int) string {
+	var statements []string
+	for i := r.Intn(3); i > 0; i-- {
+		statements = append(statements, randomStatement(r, depth-1))
+	}
+	return "{ " + strings.Join(statements, " ") + " }"
+}
+
+func randomExpression(r *rand.Rand, depth int) string {
+	if depth <= 0 {
+		switch r.Intn(3) {
+		case 0:
+			return randomName(r)
+		case 1:
+			return fmt.Sprint(r.Intn(1000))
+		default:
+			return []string{"true", "false"}[r.Intn(2)]
+		}
+	}
+	operators := []string{"+", "-", "*", "/", "<", ">", "==", "!="}
+	switch r.Intn(7) {
+	case 0:
+		return []string{"-", "!"}[r.Intn(2)] + randomExpression(r, depth-1)
+	case 1, 2:
+		return randomExpression(r, depth-1) + " " + operators[r.Intn(len(operators))] + " " + randomExpression(r, depth-1)
+	case 3:
+		return "(" + randomExpression(r, depth-1) + ")"
+	case 4:
+		s := "if (" + randomExpression(r, depth-1) + ") " + randomBlock(r, depth)
+		if r.Intn(2) == 0 {
+			s += " else " + randomBlock(r, depth)
+		}
+		return s
+	case 5:
+		var params []string
+		for i := r.Intn(3); i > 0; i-- {
+			params = append(params, randomName(r))
+		}
+		return "fn(" + strings.Join(params, ", ") + ") " + randomBlock(r, depth)
+	default:
+		var args []string
+		for i := r.Intn(3); i > 0; i-- {
+			args = append(args, randomExpression(r, depth-1))
+		}
+		return randomName(r) + "(" + strings.Join(args, ", ") + ")"
+	}
+}
+
+func randomName(r *rand.Rand) string {
+	return []string{"a", "b", "foo", "bar", "add"}[r.Intn(5)]
+}
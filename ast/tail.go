@@ -0,0 +1,55 @@
+package ast
+
+// TailCalls returns the calls and pipes in tail position in fn: calls whose
+// value is returned by fn as soon as they complete. These are the calls made by return
+// statements, in the body or the parameter defaults, the call the body ends
+// with, and, when an if, conditional or match expression is in tail position,
+// the calls its branches or arms end with, as well as the right side of a `??`
+// in tail position. Calls in function literals nested in fn are not
+// included, nor are calls in try expressions, which must stay on the stack to
+// have their errors caught and their finally blocks run.
+func TailCalls(fn *FunctionLiteral) map[Expression]bool {
+	calls := map[Expression]bool{}
+	markTail(fn.Body, calls)
+	Apply(fn, func(c *Cursor) bool {
+		switch n := c.Node().(type) {
+		case *FunctionLiteral:
+			return n == fn
+		case *TryExpression:
+			return false
+		case *ReturnStatement:
+			markTail(n.ReturnValue, calls)
+		}
+		return true
+	}, nil)
+	return calls
+}
+
+// markTail records the calls made in tail position by node, which is itself
+// in tail position.
+func markTail(node Node, calls map[Expression]bool) {
+	switch n := node.(type) {
+	case *BlockStatement:
+		if n != nil && len(n.Statements) > 0 {
+			markTail(n.Statements[len(n.Statements)-1], calls)
+		}
+	case *ExpressionStatement:
+		markTail(n.Expression, calls)
+	case *IfExpression:
+		markTail(n.Consequence, calls)
+		markTail(n.Alternative, calls)
+	case *ConditionalExpression:
+		markTail(n.Consequence, calls)
+		markTail(n.Alternative, calls)
+	case *CoalesceExpression:
+		markTail(n.Right, calls)
+	case *MatchExpression:
+		for _, arm := range n.Arms {
+			markTail(arm.Body, calls)
+		}
+	case *CallExpression:
+		calls[n] = true
+	case *PipeExpression:
+		calls[n] = true
+	}
+}
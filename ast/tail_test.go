@@ -0,0 +1,56 @@
+package ast_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+)
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn(n) { f(n) }", []string{"f(n)"}},
+		{"fn(n) { return f(n); }", []string{"f(n)"}},
+		{"fn(n) { f(n); g(n) }", []string{"g(n)"}},
+		{"fn(n) { f(n) + 1 }", nil},
+		{"fn(n) { g(f(n)) }", []string{"g(f(n))"}},
+		{"fn(n) { let x = f(n); x }", nil},
+		{"fn(n) { if (a(n)) { b(n) } else { c(n) } }", []string{"b(n)", "c(n)"}},
+		{"fn(n) { if (a(n)) { b(n) }; c(n) }", []string{"c(n)"}},
+		{"fn(n) { if (n) { return a(n); } b(n) + 1 }", []string{"a(n)"}},
+		{"fn(n) { -if (n) { return a(n); } else { b(n) } }", []string{"a(n)"}},
+		{"fn(n) { fn() { a(n) } }", nil},
+		{"fn(n) { fn() { a(n) }() }", []string{"fn() a(n)()"}},
+		{"fn(n) { try { return a(n); } catch (e) { b(n) } }", nil},
+		{"fn(n) { try { a(n) } finally { b(n) }; c(n) }", []string{"c(n)"}},
+		{"fn(n) { match (a(n)) { 0 => b(n), x if c(x) => d(x) } }", []string{"b(n)", "d(x)"}},
+		{"fn(n) { match (n) { _ => a(n) } + 1 }", nil},
+		{"fn(n) { n |> f |> g(1) }", []string{"((n |> f) |> g(1))"}},
+		{"fn(n) { (n |> f) + 1 }", nil},
+		{"fn(n) { (x) => f(x) }", nil},
+		{"fn(n) { a(n) ? b(n) : c(n) ?? d(n) }", []string{"b(n)", "d(n)"}},
+		{"fn(n) { a(n) ?? b(n) ? c(n) : d?.(n) }", []string{"c(n)", "d?.(n)"}},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		var got []string
+		for call := range ast.TailCalls(fn) {
+			got = append(got, call.String())
+		}
+		sort.Strings(got)
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: wrong tail calls. want=%q, got=%q", tt.input, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%q: wrong tail calls. want=%q, got=%q", tt.input, tt.expected, got)
+				break
+			}
+		}
+	}
+}
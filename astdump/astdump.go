@@ -0,0 +1,109 @@
+// Package astdump renders syntax trees as Graphviz DOT graphs and as indented
+// S-expressions, to make the shape of a parse visible.
+package astdump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+)
+
+// SExpr writes node as an indented S-expression. Each node is printed as
+// `(Kind detail` followed by its children, one per line, indented by two
+// spaces.
+func SExpr(w io.Writer, node ast.Node) error {
+	var out bytes.Buffer
+	depth := 0
+	ast.Apply(node, func(c *ast.Cursor) bool {
+		if depth > 0 {
+			out.WriteString("\n" + strings.Repeat("  ", depth))
+		}
+		out.WriteString("(" + kind(c.Node()))
+		if d := detail(c.Node()); d != "" {
+			out.WriteString(" " + d)
+		}
+		depth++
+		return true
+	}, func(c *ast.Cursor) bool {
+		out.WriteString(")")
+		depth--
+		return true
+	})
+	out.WriteString("\n")
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// DOT writes node as a Graphviz digraph. Nodes are labelled with their kind and
+// detail, and edges with the parent field holding the child. Edges leaving a
+// node are emitted in field order so `dot` lays children out left to right.
+func DOT(w io.Writer, node ast.Node) error {
+	var out bytes.Buffer
+	ids := map[ast.Node]int{}
+	out.WriteString("digraph ast {\n")
+	out.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	out.WriteString("\tordering=out;\n")
+	ast.Apply(node, func(c *ast.Cursor) bool {
+		id := len(ids)
+		ids[c.Node()] = id
+		label := kind(c.Node())
+		if d := detail(c.Node()); d != "" {
+			label += "\n" + d
+		}
+		fmt.Fprintf(&out, "\tn%d [label=%s];\n", id, quote(label))
+		if c.Parent() != nil {
+			edge := c.Name()
+			if c.Index() >= 0 {
+				edge += "[" + strconv.Itoa(c.Index()) + "]"
+			}
+			fmt.Fprintf(&out, "\tn%d -> n%d [label=%s];\n", ids[c.Parent()], id, quote(edge))
+		}
+		return true
+	}, nil)
+	out.WriteString("}\n")
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// kind returns the type name of n without its package qualifier.
+func kind(n ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+}
+
+// detail returns the data a node holds besides its children.
+func detail(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Identifier:
+		return n.Value
+	case *ast.IntegerLiteral:
+		return n.Token.Literal
+	case *ast.Boolean:
+		return strconv.FormatBool(n.Value)
+	case *ast.StringLiteral:
+		return strconv.Quote(n.Value)
+	case *ast.TemplateLiteral:
+		// The text around the holes, whose expressions are the children.
+		parts := make([]string, len(n.Strings))
+		for i, s := range n.Strings {
+			parts[i] = strconv.Quote(s)
+		}
+		return strings.Join(parts, " ")
+	case *ast.PrefixExpression:
+		return n.Operator
+	case *ast.InfixExpression:
+		return n.Operator
+	}
+	return ""
+}
+
+// quote returns s as a DOT string literal.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
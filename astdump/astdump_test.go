@@ -0,0 +1,102 @@
+package astdump
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func TestSExpr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * x", `(Program
+  (ExpressionStatement
+    (InfixExpression +
+      (IntegerLiteral 1)
+      (InfixExpression *
+        (IntegerLiteral 2)
+        (Identifier x)))))
+`},
+		{"let f = fn(a) { -a }; f(true)", `(Program
+  (LetStatement
+    (Identifier f)
+    (FunctionLiteral
+      (Parameter
+        (Identifier a))
+      (BlockStatement
+        (ExpressionStatement
+          (PrefixExpression -
+            (Identifier a))))))
+  (ExpressionStatement
+    (CallExpression
+      (Identifier f)
+      (Boolean true))))
+`},
+		{"`a ${x} b`", `(Program
+  (ExpressionStatement
+    (TemplateLiteral "a " " b"
+      (Identifier x))))
+`},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := SExpr(&out, parse(t, tt.input)); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("SExpr(%q) wrong.\nwant:\n%s\ngot:\n%s", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestDOT(t *testing.T) {
+	program := parse(t, "f(a, 1 - 2)")
+	var out bytes.Buffer
+	if err := DOT(&out, program); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph ast {
+	node [shape=box, fontname="monospace"];
+	ordering=out;
+	n0 [label="Program"];
+	n1 [label="ExpressionStatement"];
+	n0 -> n1 [label="Statements[0]"];
+	n2 [label="CallExpression"];
+	n1 -> n2 [label="Expression"];
+	n3 [label="Identifier\nf"];
+	n2 -> n3 [label="Function"];
+	n4 [label="Identifier\na"];
+	n2 -> n4 [label="Arguments[0]"];
+	n5 [label="InfixExpression\n-"];
+	n2 -> n5 [label="Arguments[1]"];
+	n6 [label="IntegerLiteral\n1"];
+	n5 -> n6 [label="Left"];
+	n7 [label="IntegerLiteral\n2"];
+	n5 -> n7 [label="Right"];
+}
+`
+	if out.String() != expected {
+		t.Errorf("DOT wrong.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := quote("a\"b\\c\nd"); got != `"a\"b\\c\nd"` {
+		t.Errorf("quote wrong. got=%s", got)
+	}
+}
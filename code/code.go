@@ -0,0 +1,392 @@
+// Package code defines the bytecode instruction set of the Monkey virtual
+// machine and its encoding.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Instructions is a sequence of encoded instructions.
+type Instructions []byte
+
+// Opcode identifies an instruction. It is the first byte of its encoding and
+// is followed by the instruction's operands in big-endian order.
+type Opcode byte
+
+// Definitions of opcodes.
+const (
+	// OpConstant pushes the constant whose index is the operand.
+	OpConstant Opcode = iota
+	// OpPop discards the top of the stack.
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	OpMinus
+	OpBang
+
+	// OpJumpNotTruthy pops the condition and jumps to the operand offset if it is falsy.
+	OpJumpNotTruthy
+	// OpJump jumps to the operand offset.
+	OpJump
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+
+	// OpCall calls the function below its operand count of arguments.
+	OpCall
+	// OpReturnValue returns the top of the stack from the current function.
+	OpReturnValue
+	// OpReturn returns null from the current function.
+	OpReturn
+
+	// OpGetBuiltin pushes the builtin function whose index is the operand.
+	OpGetBuiltin
+	// OpClosure pushes a closure over the function constant named by its
+	// first operand, capturing as many values from the stack as its second.
+	OpClosure
+	// OpGetFree pushes a free variable captured by the current closure.
+	OpGetFree
+	// OpCurrentClosure pushes the closure being executed, for recursion.
+	// The compiler no longer emits it: a function refers to itself by the
+	// name it is bound to, like to any other variable.
+	OpCurrentClosure
+
+	// OpTailCall is OpCall for a call in tail position. A closure called
+	// this way takes over the frame of the calling function, whose remaining
+	// instructions only return the result of the call.
+	OpTailCall
+
+	// OpArray pushes an array of the operand count of values on top of the stack.
+	OpArray
+	// OpIndex pops an index and the value it indexes and pushes the element.
+	OpIndex
+	// OpHash pushes a hash of the operand count of values on top of the
+	// stack, which alternate between keys and values.
+	OpHash
+
+	// OpTry installs a handler for the runtime errors raised until the
+	// matching OpEndTry. On an error the handler restores the stack to its
+	// height at OpTry, pushes the caught value and jumps to the operand
+	// offset.
+	OpTry
+	// OpTryFinally is OpTry for a finally block: its handler pushes the
+	// error itself, which OpThrow raises again unchanged.
+	OpTryFinally
+	// OpEndTry removes the handler installed last.
+	OpEndTry
+	// OpThrow pops a value and throws it.
+	OpThrow
+
+	// OpImport pushes the module loaded by the function constant named by
+	// the operand, calling the function the first time the module is
+	// imported.
+	OpImport
+	// OpModule pushes a module of the operand count of exports, whose names
+	// and values alternate on top of the stack, and records it as the
+	// module of the current function.
+	OpModule
+	// OpMember pops a value and pushes its member named by the string
+	// constant whose index is the operand.
+	OpMember
+
+	// OpArrayPattern pops an array with the first operand count of elements,
+	// or at least that many if the second operand is 1, and pushes its
+	// elements in reverse order, so that the first ends up on top. With a
+	// second operand of 1 it first pushes an array of the remaining elements.
+	OpArrayPattern
+	// OpHashPattern pops the operand count of keys and the hash below them,
+	// which must hold every key, and pushes their values in reverse order.
+	OpHashPattern
+
+	// OpMatchLiteral pops a literal and a value below it, and pushes whether
+	// the value equals the literal. Values of different types are not equal.
+	OpMatchLiteral
+	// OpMatchArray is OpArrayPattern for the pattern of a match arm: instead
+	// of failing, it pushes as many nulls if the value popped is not an
+	// array of the right length, and then whether it is.
+	OpMatchArray
+	// OpMatchHash is OpHashPattern for the pattern of a match arm: instead
+	// of failing, it pushes as many nulls if the value popped is not a hash
+	// holding every key, and then whether it is.
+	OpMatchHash
+	// OpNoMatch pops the subject of a match expression no arm matches and
+	// raises an error.
+	OpNoMatch
+
+	// OpJumpIfPassed jumps to the first operand offset if the call of the
+	// current function passed the parameter whose index is the second
+	// operand, skipping the code computing its default.
+	OpJumpIfPassed
+	// OpSpread raises an error unless the top of the stack is an array
+	// whose elements can be spread.
+	OpSpread
+	// OpConcat pops the operand count of arrays and pushes their
+	// concatenation.
+	OpConcat
+	// OpCallSpread is OpCall with the arguments in an array on top of the
+	// stack instead of on the stack.
+	OpCallSpread
+	// OpTailCallSpread is OpTailCall with the arguments in an array on top
+	// of the stack instead of on the stack.
+	OpTailCallSpread
+
+	// OpJumpIfNull jumps to the operand offset if the top of the stack is
+	// null. Unlike OpJumpNotTruthy it leaves the value on the stack.
+	OpJumpIfNull
+
+	// OpTemplate pops the operand count of values and pushes the string
+	// joining them, each converted as by the str builtin.
+	OpTemplate
+
+	// OpGetLateGlobal pushes the global at the first operand, which code
+	// refers to before its let statement. If the global is not set yet it
+	// fails, naming the identifier in the string constant at the second
+	// operand.
+	OpGetLateGlobal
+
+	// OpGetLocalIfSet pushes the local at the second operand and jumps to
+	// the first operand offset if the local is set. Otherwise it does
+	// nothing, and the instructions after it look the name up further out.
+	OpGetLocalIfSet
+	// OpGetFreeIfSet is OpGetLocalIfSet for a free variable of the current
+	// closure.
+	OpGetFreeIfSet
+	// OpGetGlobalIfSet is OpGetLocalIfSet for a global.
+	OpGetGlobalIfSet
+
+	// OpGetLocalCell pushes the cell holding the local at the operand, for
+	// OpClosure to capture, first moving the local into a new cell if it is
+	// not in one. The function and the closure then see the values each
+	// other sets.
+	OpGetLocalCell
+	// OpGetFreeCell pushes the cell holding a free variable of the current
+	// closure, for OpClosure to capture.
+	OpGetFreeCell
+)
+
+// Definition describes an opcode: its readable name and the width in bytes
+// of each of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	OpGetLocal:  {"OpGetLocal", []int{1}},
+	OpSetLocal:  {"OpSetLocal", []int{1}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpTailCall: {"OpTailCall", []int{1}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	OpHash:  {"OpHash", []int{2}},
+
+	OpTry:        {"OpTry", []int{2}},
+	OpTryFinally: {"OpTryFinally", []int{2}},
+	OpEndTry:     {"OpEndTry", []int{}},
+	OpThrow:      {"OpThrow", []int{}},
+
+	OpImport: {"OpImport", []int{2}},
+	OpModule: {"OpModule", []int{2}},
+	OpMember: {"OpMember", []int{2}},
+
+	OpArrayPattern: {"OpArrayPattern", []int{2, 1}},
+	OpHashPattern:  {"OpHashPattern", []int{2}},
+
+	OpMatchLiteral: {"OpMatchLiteral", []int{}},
+	OpMatchArray:   {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:    {"OpMatchHash", []int{2}},
+	OpNoMatch:      {"OpNoMatch", []int{}},
+
+	OpJumpIfPassed:   {"OpJumpIfPassed", []int{2, 1}},
+	OpSpread:         {"OpSpread", []int{}},
+	OpConcat:         {"OpConcat", []int{2}},
+	OpCallSpread:     {"OpCallSpread", []int{}},
+	OpTailCallSpread: {"OpTailCallSpread", []int{}},
+
+	OpJumpIfNull: {"OpJumpIfNull", []int{2}},
+
+	OpTemplate: {"OpTemplate", []int{2}},
+
+	OpGetLateGlobal: {"OpGetLateGlobal", []int{2, 2}},
+
+	OpGetLocalIfSet:  {"OpGetLocalIfSet", []int{2, 1}},
+	OpGetFreeIfSet:   {"OpGetFreeIfSet", []int{2, 1}},
+	OpGetGlobalIfSet: {"OpGetGlobalIfSet", []int{2, 2}},
+
+	OpGetLocalCell: {"OpGetLocalCell", []int{1}},
+	OpGetFreeCell:  {"OpGetFreeCell", []int{1}},
+}
+
+// Lookup returns the definition of op.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes the instruction op with the given operands. It returns an
+// empty slice for an unknown opcode.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction defined by def from
+// ins, which starts right after the opcode. It returns the operands and the
+// number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+// ReadUint16 decodes a two-byte operand.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one-byte operand.
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// String returns the instructions one per line, each prefixed with its offset.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// LineEntry maps the instructions starting at Offset to the source position
+// they were compiled from.
+type LineEntry struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// LineTable is the debug information of a sequence of instructions. Entries
+// are sorted by offset and each one covers the instructions up to the next.
+type LineTable []LineEntry
+
+// Lookup returns the source position of the instruction at offset, or zeros
+// if the table does not cover it.
+func (lt LineTable) Lookup(offset int) (line, column int) {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return 0, 0
+	}
+	return lt[i-1].Line, lt[i-1].Column
+}
@@ -0,0 +1,104 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpArray, []int{3}, []byte{byte(OpArray), 0, 3}},
+		{OpHash, []int{4}, []byte{byte(OpHash), 0, 4}},
+		{OpTry, []int{513}, []byte{byte(OpTry), 2, 1}},
+	}
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d", len(tt.expected), len(instruction))
+		}
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpCall, 3),
+		Make(OpClosure, 65535, 255),
+	}
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpCall 3
+0011 OpClosure 65535 255
+`
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestLineTableLookup(t *testing.T) {
+	lines := LineTable{{Offset: 0, Line: 1, Column: 1}, {Offset: 4, Line: 2, Column: 5}, {Offset: 9, Line: 4, Column: 1}}
+	tests := []struct {
+		offset       int
+		line, column int
+	}{
+		{0, 1, 1},
+		{3, 1, 1},
+		{4, 2, 5},
+		{8, 2, 5},
+		{20, 4, 1},
+		{-1, 0, 0},
+	}
+	for _, tt := range tests {
+		line, column := lines.Lookup(tt.offset)
+		if line != tt.line || column != tt.column {
+			t.Errorf("Lookup(%d) = %d:%d, want %d:%d", tt.offset, line, column, tt.line, tt.column)
+		}
+	}
+}
@@ -0,0 +1,1166 @@
+// Package compiler translates Monkey syntax trees into bytecode for the
+// virtual machine.
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/code"
+	"github.com/kellemNegasi/monkeylang/modules"
+	"github.com/kellemNegasi/monkeylang/object"
+	"github.com/kellemNegasi/monkeylang/token"
+)
+
+// Compiler compiles a syntax tree into instructions and a constant pool.
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	globals     *SymbolTable // the global table of the program, enclosing symbolTable outside imported files
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	position token.Token // token of the node being compiled
+	file     string      // file of the program being compiled
+
+	loader  *modules.Loader // set by the first program compiled
+	modules map[string]int  // the constant index of each module compiled, by path
+
+	// link is set while the object of a member access, index or call is
+	// about to be compiled and is itself such a link of the same chain.
+	// skips holds the jumps of the optional links of the chain being
+	// compiled, which land after its last link.
+	link  bool
+	skips []int
+}
+
+// CompilationScope holds the instructions emitted for one function body, or
+// for the top level of the program.
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	lines               code.LineTable
+	tailCalls           map[ast.Expression]bool // calls and pipes of the function in tail position
+	tries               []tryBlock              // the try expressions being compiled, innermost last
+}
+
+// tryBlock is a try expression being compiled, as a return statement in it
+// sees it.
+type tryBlock struct {
+	handlers int                 // the handlers of the expression the statement is covered by
+	finally  *ast.BlockStatement // the finally block, if any
+}
+
+// EmittedInstruction records an instruction emitted into a scope.
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// Bytecode is the output of the compiler: the instructions of the program's
+// top level, their source positions and the constants they refer to.
+type Bytecode struct {
+	Instructions code.Instructions
+	Lines        code.LineTable
+	File         string // the file the program was compiled from, if any
+	Constants    []object.Object
+}
+
+// New returns a compiler with a global scope holding only the builtins.
+func New() *Compiler {
+	symbolTable := NewSymbolTableWithBuiltins()
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		globals:     symbolTable,
+		scopes:      []CompilationScope{{instructions: code.Instructions{}}},
+		modules:     map[string]int{},
+	}
+}
+
+// NewWithState returns a compiler continuing from the symbols and constants
+// of earlier compilations, as the REPL does between lines. A fresh s must
+// define the builtins; see NewSymbolTableWithBuiltins. The globals of earlier
+// compilations may not be set, as running them may have failed first.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	s.set = map[string]bool{}
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.globals = s
+	compiler.constants = constants
+	return compiler
+}
+
+// Compile compiles node into the current scope. The instructions emitted for
+// node are attributed to the position of its token.
+func (c *Compiler) Compile(node ast.Node) error {
+	if tok := ast.TokenOf(node); tok.Line > 0 {
+		outer := c.position
+		c.position = tok
+		defer func() { c.position = outer }()
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		c.file = node.File
+		if c.loader == nil {
+			c.loader = modules.NewLoader(node.File)
+		}
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			if err := c.Compile(node.Value); err != nil {
+				return err
+			}
+			c.compilePattern(node.Pattern)
+			break
+		}
+		var err error
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			err = c.compileFunctionLiteral(fn, node.Name.Value)
+		} else {
+			err = c.Compile(node.Value)
+		}
+		if err != nil {
+			return err
+		}
+		c.define(node.Name.Value)
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveTries(); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.ImportStatement:
+		index, err := c.compileModule(node.Path.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpImport, index)
+		c.define(node.Name.Value)
+	case *ast.ExportStatement:
+		return c.Compile(node.Statement)
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.TemplateLiteral:
+		// The text around the holes is pushed as string constants, leaving
+		// out empty ones, and joined with the values of the holes.
+		count := 0
+		for i, s := range node.Strings {
+			if s != "" {
+				c.emit(code.OpConstant, c.addConstant(&object.String{Value: s}))
+				count++
+			}
+			if i < len(node.Expressions) {
+				if err := c.Compile(node.Expressions[i]); err != nil {
+					return err
+				}
+				count++
+			}
+		}
+		c.emit(code.OpTemplate, count)
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.ConditionalExpression:
+		return c.compileConditionalExpression(node)
+	case *ast.CoalesceExpression:
+		return c.compileCoalesceExpression(node)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+	case *ast.Identifier:
+		c.loadName(node.Value)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
+	case *ast.CallExpression:
+		return c.compileCall(node, node.Function, node.Arguments)
+	case *ast.PipeExpression:
+		function, arguments := node.Call()
+		return c.compileCall(node, function, arguments)
+	case *ast.ArrayLiteral:
+		if hasSpread(node.Elements) {
+			return c.compileSpreadList(node.Elements)
+		}
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.SpreadElement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpSpread)
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, 2*len(node.Pairs))
+	case *ast.IndexExpression:
+		inner, outer := c.enterLink()
+		defer c.endLink(inner, outer)
+		if err := c.compileLinkObject(node.Left, node.Optional); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.MemberExpression:
+		inner, outer := c.enterLink()
+		defer c.endLink(inner, outer)
+		if err := c.compileLinkObject(node.Object, node.Optional); err != nil {
+			return err
+		}
+		name := &object.String{Value: node.Member.Value}
+		c.emit(code.OpMember, c.addConstant(name))
+	}
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	// Emit an `OpJumpNotTruthy` with a bogus value
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBranch(node.Consequence); err != nil {
+		return err
+	}
+	// Emit an `OpJump` with a bogus value
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBranch(node.Alternative); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileConditionalExpression compiles `condition ? consequence :
+// alternative` like an if expression whose branches are single expressions.
+func (c *Compiler) compileConditionalExpression(node *ast.ConditionalExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.Compile(node.Consequence); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	if err := c.Compile(node.Alternative); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileCoalesceExpression compiles `left ?? right` to:
+//
+//	<left>
+//	OpJumpIfNull right
+//	OpJump done
+//	right: OpPop
+//	<right>
+//	done:
+func (c *Compiler) compileCoalesceExpression(node *ast.CoalesceExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	jumpIfNullPos := c.emit(code.OpJumpIfNull, 9999)
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpIfNullPos, len(c.currentInstructions()))
+	c.emit(code.OpPop)
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// enterLink starts compiling a member access, index or call. Unless it is a
+// link inside a longer chain, it is the last link of its chain, and collects
+// the jumps of the chain's optional links while it is compiled; outer holds
+// those of an enclosing chain until endLink.
+func (c *Compiler) enterLink() (inner bool, outer []int) {
+	inner, c.link = c.link, false
+	if !inner {
+		outer, c.skips = c.skips, nil
+	}
+	return inner, outer
+}
+
+// endLink finishes compiling a member access, index or call started with
+// enterLink. At the end of a chain, the jumps of its optional links are made
+// to land here, with the null they found as the value of the chain.
+func (c *Compiler) endLink(inner bool, outer []int) {
+	if inner {
+		return
+	}
+	for _, pos := range c.skips {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.skips = outer
+}
+
+// compileLinkObject compiles node, the value a member access, index or call
+// applies to. For an optional link it then jumps to the end of the chain if
+// the value is null, leaving the null on the stack.
+func (c *Compiler) compileLinkObject(node ast.Expression, optional bool) error {
+	switch node.(type) {
+	case *ast.MemberExpression, *ast.IndexExpression, *ast.CallExpression:
+		c.link = true
+	}
+	if err := c.Compile(node); err != nil {
+		return err
+	}
+	if optional {
+		c.skips = append(c.skips, c.emit(code.OpJumpIfNull, 9999))
+	}
+	return nil
+}
+
+// compileBranch compiles a branch of an if expression so that it leaves
+// exactly one value on the stack: the value of its last expression
+// statement, or null.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	defer c.enterBranch()()
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// compileTryExpression compiles a try expression to:
+//
+//	OpTryFinally finally   if there is a finally block
+//	OpTry catch            if there is a catch block
+//	<block>
+//	OpEndTry
+//	OpJump done
+//	catch: <set parameter> <catch block>
+//	done:
+//	OpEndTry               if there is a finally block, as is the rest
+//	<finally block>
+//	OpJump end
+//	finally: <finally block>
+//	OpThrow
+//	end:
+//
+// Either path leaves the value of the block or of the catch block on the
+// stack. The handler of the finally block receives the pending error, which
+// OpThrow raises again once the block has run.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	try := tryBlock{finally: node.Finally}
+	var finallyPos, catchPos int
+	if node.Finally != nil {
+		finallyPos = c.emit(code.OpTryFinally, 9999)
+		try.handlers++
+	}
+	if node.Catch != nil {
+		catchPos = c.emit(code.OpTry, 9999)
+		try.handlers++
+	}
+	if err := c.compileTryBlock(node.Block, try); err != nil {
+		return err
+	}
+	if node.Catch != nil {
+		c.emit(code.OpEndTry)
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(catchPos, len(c.currentInstructions()))
+		try.handlers--
+		leave := c.enterBranch()
+		c.define(node.Parameter.Value)
+		err := c.compileTryBlock(node.Catch, try)
+		leave()
+		if err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+	if node.Finally == nil {
+		return nil
+	}
+	c.emit(code.OpEndTry)
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(finallyPos, len(c.currentInstructions()))
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileFinally compiles a finally block, which may be left by an error.
+func (c *Compiler) compileFinally(block *ast.BlockStatement) error {
+	defer c.enterBranch()()
+	return c.Compile(block)
+}
+
+// compileTryBlock compiles the block or the catch block of a try expression
+// described by try.
+func (c *Compiler) compileTryBlock(block *ast.BlockStatement, try tryBlock) error {
+	scope := &c.scopes[c.scopeIndex]
+	outer := scope.tries
+	scope.tries = append(outer[:len(outer):len(outer)], try)
+	defer func() { c.scopes[c.scopeIndex].tries = outer }()
+	return c.compileBranch(block)
+}
+
+// leaveTries emits what a return statement does before it leaves the try
+// expressions it is in, innermost first: remove their handlers and run their
+// finally blocks. A finally block is compiled as part of the try expressions
+// around its own.
+func (c *Compiler) leaveTries() error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+	for i := len(tries) - 1; i >= 0; i-- {
+		for j := 0; j < tries[i].handlers; j++ {
+			c.emit(code.OpEndTry)
+		}
+		if tries[i].finally != nil {
+			c.scopes[c.scopeIndex].tries = tries[:i:i]
+			if err := c.Compile(tries[i].finally); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// define defines name in the current scope and emits the instruction
+// binding it to the value on top of the stack. The name is set for the code
+// compiled after it, up to the end of the branch it is in.
+func (c *Compiler) define(name string) Symbol {
+	symbol := c.symbolTable.Define(name)
+	c.symbolTable.markSet(name)
+	c.setSymbol(symbol)
+	return symbol
+}
+
+// defineUnnamed binds the value on top of the stack to a new slot of the
+// current scope that no name refers to.
+func (c *Compiler) defineUnnamed() Symbol {
+	symbol := c.symbolTable.defineUnnamed()
+	c.setSymbol(symbol)
+	return symbol
+}
+
+// setSymbol emits the instruction binding s to the value on top of the
+// stack.
+func (c *Compiler) setSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// enterBranch starts compiling code that may not run, or not to its end: a
+// branch of an if expression, a block of a try expression or an arm of a
+// match expression. It returns the function ending the branch, after which
+// the names the branch set are no longer set.
+func (c *Compiler) enterBranch() func() {
+	table := c.symbolTable
+	set := make(map[string]bool, len(table.set))
+	for name := range table.set {
+		set[name] = true
+	}
+	return func() { table.set = set }
+}
+
+// loadName emits the instructions pushing the value of the identifier name.
+// The evaluator looks names up as the code runs, so each binding of name
+// that may not be set yet is tried in turn, innermost first, until one is.
+func (c *Compiler) loadName(name string) {
+	bindings := c.symbolTable.bindings(name)
+	var found []int
+	for len(bindings) > 0 && !bindings[0].set {
+		if len(bindings) == 1 && bindings[0].Scope == GlobalScope {
+			// OpGetLateGlobal fails, naming the identifier, if the
+			// global is not set.
+			c.emit(code.OpGetLateGlobal, bindings[0].Index, c.addConstant(&object.String{Value: name}))
+			break
+		}
+		found = append(found, c.loadIfSet(bindings[0].Symbol))
+		bindings = bindings[1:]
+	}
+	switch {
+	case len(bindings) == 0:
+		c.loadUnbound(name)
+	case bindings[0].set:
+		c.loadSymbol(bindings[0].Symbol)
+	}
+	for _, pos := range found {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+// loadIfSet emits the instruction pushing the value of s if it is set, and
+// jumping to where the lookup of its name ends, which the caller patches in
+// the instruction at the position returned.
+func (c *Compiler) loadIfSet(s Symbol) int {
+	switch s.Scope {
+	case GlobalScope:
+		return c.emit(code.OpGetGlobalIfSet, 9999, s.Index)
+	case FreeScope:
+		return c.emit(code.OpGetFreeIfSet, 9999, s.Index)
+	default:
+		return c.emit(code.OpGetLocalIfSet, 9999, s.Index)
+	}
+}
+
+// loadUnbound loads name, which no let statement compiled so far defines.
+// The evaluator looks names up as the code runs, so the lookup only fails if
+// it runs before a global of that name is set. Globals are not visible in an
+// imported file, where the lookup always fails.
+func (c *Compiler) loadUnbound(name string) {
+	var index int
+	if c.symbolTable.global() == c.globals {
+		index = c.globals.Reserve(name).Index
+	} else {
+		index = c.globals.defineUnnamed().Index
+	}
+	c.emit(code.OpGetLateGlobal, index, c.addConstant(&object.String{Value: name}))
+}
+
+// compilePattern binds the names of pattern to the parts of the value on top
+// of the stack, which it consumes. The instructions checking the shape of
+// the value are attributed to the pattern they check.
+func (c *Compiler) compilePattern(pattern ast.Pattern) {
+	outer := c.position
+	c.position = ast.TokenOf(pattern)
+	defer func() { c.position = outer }()
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		c.define(pattern.Value)
+	case *ast.WildcardPattern:
+		c.emit(code.OpPop)
+	case *ast.ArrayPattern:
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		c.emit(code.OpArrayPattern, len(pattern.Elements), rest)
+		for _, element := range pattern.Elements {
+			c.compilePattern(element)
+		}
+		if pattern.Rest != nil {
+			c.define(pattern.Rest.Value)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			c.compilePatternKey(pair.Key)
+		}
+		c.emit(code.OpHashPattern, len(pattern.Pairs))
+		for _, pair := range pattern.Pairs {
+			c.compilePattern(pair.Value)
+		}
+	}
+}
+
+// compileMatchExpression compiles a match expression to:
+//
+//	<subject>
+//	<set subject>          in a slot no name refers to
+//	arm: <get subject>
+//	<pattern>              jumping to fail if the subject does not match
+//	<guard>                if there is one
+//	OpJumpNotTruthy fail
+//	<body>
+//	OpJump end
+//	fail: OpPop ...        the values the pattern left on the stack
+//	...                    the next arms
+//	<get subject>
+//	OpNoMatch
+//	end:
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+	subject := c.defineUnnamed()
+	var ends []int
+	for _, arm := range node.Arms {
+		leave := c.enterBranch()
+		c.loadSymbol(subject)
+		names := armNames(arm)
+		scratch, unshadow := c.symbolTable.shadow(names)
+		var fails []matchJump
+		c.compileMatchPattern(arm.Pattern, 0, &fails)
+		if arm.Guard != nil {
+			if err := c.Compile(arm.Guard); err != nil {
+				unshadow()
+				return err
+			}
+			fails = append(fails, matchJump{c.emit(code.OpJumpNotTruthy, 9999), 0})
+		}
+		set := make([]bool, len(names))
+		for i, name := range names {
+			set[i] = c.symbolTable.set[name]
+		}
+		unshadow()
+		for i, name := range names {
+			c.copyScratch(scratch[i], name, set[i])
+		}
+		if err := c.Compile(arm.Body); err != nil {
+			return err
+		}
+		leave()
+		ends = append(ends, c.emit(code.OpJump, 9999))
+
+		// The jumps leaving the most values on the stack land on the first
+		// OpPop, those leaving none after the last.
+		pending := 0
+		for _, fail := range fails {
+			if fail.pending > pending {
+				pending = fail.pending
+			}
+		}
+		for ; pending >= 0; pending-- {
+			for _, fail := range fails {
+				if fail.pending == pending {
+					c.changeOperand(fail.pos, len(c.currentInstructions()))
+				}
+			}
+			if pending > 0 {
+				c.emit(code.OpPop)
+			}
+		}
+	}
+	c.loadSymbol(subject)
+	c.emit(code.OpNoMatch)
+	for _, end := range ends {
+		c.changeOperand(end, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// armNames returns the names the pattern and the guard of arm bind, each
+// once. The arm binds them to scratch slots until the pattern matches and the
+// guard holds, so that an arm not taken leaves them as they were, as in the
+// evaluator.
+func armNames(arm ast.MatchArm) []string {
+	bound := ast.PatternNames(arm.Pattern)
+	if arm.Guard != nil {
+		bound = append(bound, ast.BoundNames(arm.Guard)...)
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range bound {
+		if !seen[name.Value] {
+			seen[name.Value] = true
+			names = append(names, name.Value)
+		}
+	}
+	return names
+}
+
+// copyScratch binds name to the value of its scratch slot of a match arm. A
+// slot that may not be set, as the guard may not run the code binding it,
+// is only copied if it is.
+func (c *Compiler) copyScratch(scratch Symbol, name string, set bool) {
+	if set {
+		c.loadSymbol(scratch)
+		c.define(name)
+		return
+	}
+	found := c.loadIfSet(scratch)
+	skip := c.emit(code.OpJump, 9999)
+	c.changeOperand(found, len(c.currentInstructions()))
+	c.setSymbol(c.symbolTable.Define(name))
+	c.changeOperand(skip, len(c.currentInstructions()))
+}
+
+// matchJump is an OpJumpNotTruthy taken when the pattern of a match arm does
+// not match, with the number of values of the pattern it leaves on the
+// stack.
+type matchJump struct {
+	pos     int
+	pending int
+}
+
+// compileMatchPattern compiles the pattern of a match arm. Like
+// compilePattern it consumes the value on top of the stack, but instead of
+// failing it jumps when the value does not match. pending is the number of
+// values of the enclosing patterns below the value; the jumps are appended
+// to fails.
+func (c *Compiler) compileMatchPattern(pattern ast.Pattern, pending int, fails *[]matchJump) {
+	outer := c.position
+	c.position = ast.TokenOf(pattern)
+	defer func() { c.position = outer }()
+
+	fail := func(pending int) {
+		*fails = append(*fails, matchJump{c.emit(code.OpJumpNotTruthy, 9999), pending})
+	}
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		c.define(pattern.Value)
+	case *ast.WildcardPattern:
+		c.emit(code.OpPop)
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.NullLiteral:
+		_ = c.Compile(pattern.(ast.Expression)) // literals always compile
+		c.emit(code.OpMatchLiteral)
+		fail(pending)
+	case *ast.ArrayPattern:
+		n, rest := len(pattern.Elements), 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		c.emit(code.OpMatchArray, n, rest)
+		fail(pending + n + rest)
+		for i, element := range pattern.Elements {
+			c.compileMatchPattern(element, pending+n+rest-1-i, fails)
+		}
+		if pattern.Rest != nil {
+			c.define(pattern.Rest.Value)
+		}
+	case *ast.HashPattern:
+		n := len(pattern.Pairs)
+		for _, pair := range pattern.Pairs {
+			c.compilePatternKey(pair.Key)
+		}
+		c.emit(code.OpMatchHash, n)
+		fail(pending + n)
+		for i, pair := range pattern.Pairs {
+			c.compileMatchPattern(pair.Value, pending+n-1-i, fails)
+		}
+	}
+}
+
+// compilePatternKey pushes the hash key a key of a hash pattern stands for.
+func (c *Compiler) compilePatternKey(key ast.Expression) {
+	if name, ok := key.(*ast.Identifier); ok {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name.Value}))
+		return
+	}
+	_ = c.Compile(key) // literals always compile
+}
+
+// compileFunctionLiteral compiles node to a closure. A function bound by let
+// is given the name it is bound to, which its stack frames show.
+//
+// Every name the function binds is a local from the start of the function,
+// set once the function binds it, so that closures created earlier see it as
+// they do in the evaluator. Closures capture the cells of the locals of
+// enclosing functions rather than their values for the same reason.
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+	c.scopes[c.scopeIndex].tailCalls = ast.TailCalls(node)
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Name.Value)
+		c.symbolTable.markSet(p.Name.Value)
+	}
+	if node.Rest != nil {
+		c.symbolTable.Define(node.Rest.Value)
+		c.symbolTable.markSet(node.Rest.Value)
+	}
+	for _, name := range ast.BoundNames(node) {
+		c.symbolTable.Define(name.Value)
+	}
+	numDefaults := 0
+	for i, p := range node.Parameters {
+		if p.Default == nil {
+			continue
+		}
+		numDefaults++
+		jumpPos := c.emit(code.OpJumpIfPassed, 9999, i)
+		if err := c.Compile(p.Default); err != nil {
+			return err
+		}
+		c.emit(code.OpSetLocal, i)
+		c.replaceInstruction(jumpPos, code.Make(code.OpJumpIfPassed, len(c.currentInstructions()), i))
+	}
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		if s.Scope == LocalScope {
+			c.emit(code.OpGetLocalCell, s.Index)
+		} else {
+			c.emit(code.OpGetFreeCell, s.Index)
+		}
+	}
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		NumDefaults:   numDefaults,
+		Variadic:      node.Rest != nil,
+		Lines:         lines,
+		Name:          name,
+		File:          c.file,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return nil
+}
+
+// compileCall compiles node, which calls function with arguments.
+func (c *Compiler) compileCall(node ast.Expression, function ast.Expression, arguments []ast.Expression) error {
+	inner, outer := c.enterLink()
+	defer c.endLink(inner, outer)
+	if call, ok := node.(*ast.CallExpression); ok {
+		if err := c.compileLinkObject(function, call.Optional); err != nil {
+			return err
+		}
+	} else if err := c.Compile(function); err != nil {
+		return err
+	}
+	tail := c.scopes[c.scopeIndex].tailCalls[node]
+	if hasSpread(arguments) {
+		if err := c.compileSpreadList(arguments); err != nil {
+			return err
+		}
+		if tail {
+			c.emit(code.OpTailCallSpread)
+		} else {
+			c.emit(code.OpCallSpread)
+		}
+		return nil
+	}
+	for _, a := range arguments {
+		if err := c.Compile(a); err != nil {
+			return err
+		}
+	}
+	if tail {
+		c.emit(code.OpTailCall, len(arguments))
+	} else {
+		c.emit(code.OpCall, len(arguments))
+	}
+	return nil
+}
+
+// hasSpread reports whether exps spread an array.
+func hasSpread(exps []ast.Expression) bool {
+	for _, exp := range exps {
+		if _, ok := exp.(*ast.SpreadElement); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSpreadList pushes an array of the values of exps, with the elements
+// of spread arrays in place of the spreads. Each spread array and each run of
+// other values between them is pushed as an array of its own, and the arrays
+// are concatenated.
+func (c *Compiler) compileSpreadList(exps []ast.Expression) error {
+	segments, run := 0, 0
+	endRun := func() {
+		if run > 0 {
+			c.emit(code.OpArray, run)
+			segments++
+			run = 0
+		}
+	}
+	for _, exp := range exps {
+		_, spread := exp.(*ast.SpreadElement)
+		if spread {
+			endRun()
+		}
+		if err := c.Compile(exp); err != nil {
+			return err
+		}
+		if spread {
+			segments++
+		} else {
+			run++
+		}
+	}
+	endRun()
+	c.emit(code.OpConcat, segments)
+	return nil
+}
+
+// compileModule compiles the file imported as path by the file being
+// compiled to a function that runs the file and returns its module, unless
+// an earlier import compiled it. It returns the constant index of the
+// function. The top level of the file is the body of the function, so its
+// names are locals the importing file does not see.
+func (c *Compiler) compileModule(path string) (int, error) {
+	path = modules.Resolve(c.file, path)
+	if index, ok := c.modules[path]; ok {
+		return index, nil
+	}
+	program, err := c.loader.Enter(path)
+	if err != nil {
+		return 0, err
+	}
+	defer c.loader.Leave()
+
+	symbolTable, file, position := c.symbolTable, c.file, c.position
+	defer func() { c.symbolTable, c.file, c.position = symbolTable, file, position }()
+	c.symbolTable = NewSymbolTableWithBuiltins()
+	c.position = token.Token{}
+	c.enterScope()
+	for _, name := range ast.BoundNames(program) {
+		c.symbolTable.Define(name.Value)
+	}
+	if err := c.Compile(program); err != nil {
+		return 0, err
+	}
+	var exports int
+	for _, s := range program.Statements {
+		if export, ok := s.(*ast.ExportStatement); ok {
+			for _, name := range export.Statement.Names() {
+				symbol, _ := c.symbolTable.Resolve(name.Value)
+				c.emit(code.OpConstant, c.addConstant(&object.String{Value: name.Value}))
+				c.loadSymbol(symbol)
+				exports++
+			}
+		}
+	}
+	c.emit(code.OpModule, exports)
+	c.emit(code.OpReturnValue)
+	numLocals := c.symbolTable.numDefinitions
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.leaveScope()
+
+	compiledFn := &object.CompiledFunction{
+		Instructions: instructions,
+		NumLocals:    numLocals,
+		Lines:        lines,
+		Name:         object.ModuleFunction,
+		File:         path,
+	}
+	index := c.addConstant(compiledFn)
+	c.modules[path] = index
+	return index, nil
+}
+
+// loadSymbol emits the instruction pushing the value of s.
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+// Bytecode returns the compiled top-level instructions and the constant pool.
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		File:         c.file,
+		Constants:    c.constants,
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction to the current scope and returns its position.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+	c.setLastInstruction(op, pos)
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	c.addLine(posNewInstruction)
+	return posNewInstruction
+}
+
+// addLine records the current position as the source of the instruction at
+// pos, unless the instructions before it share that position.
+func (c *Compiler) addLine(pos int) {
+	if c.position.Line == 0 {
+		return
+	}
+	scope := &c.scopes[c.scopeIndex]
+	entry := code.LineEntry{Offset: pos, Line: c.position.Line, Column: c.position.Column}
+	if n := len(scope.lines); n > 0 {
+		last := scope.lines[n-1]
+		if last.Line == entry.Line && last.Column == entry.Column {
+			return
+		}
+	}
+	scope.lines = append(scope.lines, entry)
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	lines := c.scopes[c.scopeIndex].lines
+	for len(lines) > 0 && lines[len(lines)-1].Offset >= last.Position {
+		lines = lines[:len(lines)-1]
+	}
+	c.scopes[c.scopeIndex].lines = lines
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// changeOperand rewrites the first operand of the instruction at opPos,
+// used to back-patch jump targets.
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	def, _ := code.Lookup(byte(op))
+	operands, _ := code.ReadOperands(def, c.currentInstructions()[opPos+1:])
+	operands[0] = operand
+	c.replaceInstruction(opPos, code.Make(op, operands...))
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return instructions
+}
@@ -0,0 +1,1072 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/code"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/object"
+	"github.com/kellemNegasi/monkeylang/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { let x = 10; } else { 20 }",
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 17),
+				// 0014
+				code.Make(code.OpConstant, 1),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "`a ${1} b ${2 + 3}`",
+			expectedConstants: []interface{}{"a ", 1, " b ", 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpAdd),
+				code.Make(code.OpTemplate, 4),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Empty text is left out, but the values are still joined
+			// into a string.
+			input:             "`${1}`; ``",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpTemplate, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpTemplate, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestNullishOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true ? 1 : 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "null ?? 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpNull),
+				// 0001
+				code.Make(code.OpJumpIfNull, 7),
+				// 0004
+				code.Make(code.OpJump, 11),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let a = null; a?.b?.[1]",
+			expectedConstants: []interface{}{"b", 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpNull),
+				// 0001
+				code.Make(code.OpSetGlobal, 0),
+				// 0004
+				code.Make(code.OpGetGlobal, 0),
+				// 0007
+				code.Make(code.OpJumpIfNull, 20),
+				// 0010
+				code.Make(code.OpMember, 0),
+				// 0013
+				code.Make(code.OpJumpIfNull, 20),
+				// 0016
+				code.Make(code.OpConstant, 1),
+				// 0019
+				code.Make(code.OpIndex),
+				// 0020
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let f = null; f?.(1)",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpNull),
+				// 0001
+				code.Make(code.OpSetGlobal, 0),
+				// 0004
+				code.Make(code.OpGetGlobal, 0),
+				// 0007
+				code.Make(code.OpJumpIfNull, 15),
+				// 0010
+				code.Make(code.OpConstant, 0),
+				// 0013
+				code.Make(code.OpCall, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let one = 1; let two = "two"; one;`,
+			expectedConstants: []interface{}{1, "two"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { let b = a; b }(1)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The default of b is computed unless the call passed it, and
+			// rest is the local after the parameters.
+			input: "fn(a, b = 1, ...rest) { rest }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpJumpIfPassed, 9, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// The piped value becomes the first argument, so a pipe
+			// compiles to the same call as f(1, 2).
+			input: "let f = fn(a, b) { a }; 1 |> f(2)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "(x) => x",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// b is free in the middle function only because the innermost
+			// one captures it.
+			input: "fn(a) { fn(b) { fn(c) { a + b + c } } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// f is not set yet when the function is compiled, so the function
+			// looks it up as it runs.
+			input: "let f = fn(x) { f(x) };",
+			expectedConstants: []interface{}{
+				"f",
+				[]code.Instructions{
+					code.Make(code.OpGetLateGlobal, 0, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			// The inner function captures the cell of the local f, which is
+			// set after the closure of f is created, so it looks further out
+			// if the cell is empty.
+			input: "fn() { let f = fn(x) { fn() { f(x) } }; }",
+			expectedConstants: []interface{}{
+				"f",
+				[]code.Instructions{
+					code.Make(code.OpGetFreeIfSet, 9, 0),
+					code.Make(code.OpGetLateGlobal, 0, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 1, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalCell, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(f) { if (f) { return f(1); } 3 + f(2) }",
+			expectedConstants: []interface{}{
+				1,
+				3,
+				2,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 17),
+					// 0005
+					code.Make(code.OpGetLocal, 0),
+					// 0007
+					code.Make(code.OpConstant, 0),
+					// 0010
+					code.Make(code.OpTailCall, 1),
+					// 0012
+					code.Make(code.OpReturnValue),
+					// 0013
+					code.Make(code.OpNull),
+					// 0014
+					code.Make(code.OpJump, 18),
+					// 0017
+					code.Make(code.OpNull),
+					// 0018
+					code.Make(code.OpPop),
+					// 0019
+					code.Make(code.OpConstant, 1),
+					// 0022
+					code.Make(code.OpGetLocal, 0),
+					// 0024
+					code.Make(code.OpConstant, 2),
+					// 0027
+					code.Make(code.OpCall, 1),
+					// 0029
+					code.Make(code.OpAdd),
+					// 0030
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "try { 1 } catch (e) { e } finally { 2 }",
+			// The finally block is compiled once for each way out of the try.
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTryFinally, 27),
+				// 0003
+				code.Make(code.OpTry, 13),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpEndTry),
+				// 0010
+				code.Make(code.OpJump, 19),
+				// 0013
+				code.Make(code.OpSetGlobal, 0),
+				// 0016
+				code.Make(code.OpGetGlobal, 0),
+				// 0019
+				code.Make(code.OpEndTry),
+				// 0020
+				code.Make(code.OpConstant, 1),
+				// 0023
+				code.Make(code.OpPop),
+				// 0024
+				code.Make(code.OpJump, 32),
+				// 0027
+				code.Make(code.OpConstant, 2),
+				// 0030
+				code.Make(code.OpPop),
+				// 0031
+				code.Make(code.OpThrow),
+				// 0032
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { try { return 1; } finally { 2 } }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				2,
+				2,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTryFinally, 21),
+					// 0003
+					code.Make(code.OpConstant, 0),
+					// 0006
+					code.Make(code.OpEndTry),
+					// 0007
+					code.Make(code.OpConstant, 1),
+					// 0010
+					code.Make(code.OpPop),
+					// 0011
+					code.Make(code.OpReturnValue),
+					// 0012
+					code.Make(code.OpNull),
+					// 0013
+					code.Make(code.OpEndTry),
+					// 0014
+					code.Make(code.OpConstant, 2),
+					// 0017
+					code.Make(code.OpPop),
+					// 0018
+					code.Make(code.OpJump, 26),
+					// 0021
+					code.Make(code.OpConstant, 3),
+					// 0024
+					code.Make(code.OpPop),
+					// 0025
+					code.Make(code.OpThrow),
+					// 0026
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `len("ab"); fn() { len }`,
+			expectedConstants: []interface{}{"ab", []code.Instructions{code.Make(code.OpGetBuiltin, 0), code.Make(code.OpReturnValue)}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2 + 3][0]",
+			expectedConstants: []interface{}{1, 2, 3, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, ...[2], 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSpread),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConcat, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "len(...[1])",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSpread),
+				code.Make(code.OpConcat, 1),
+				code.Make(code.OpCallSpread),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{3: 4, 1: 2 + 5}[3]",
+			expectedConstants: []interface{}{3, 4, 1, 2, 5, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpAdd),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let [a, [b], ...c] = []; let {a, \"k\": v} = {};",
+			expectedConstants: []interface{}{"a", "k"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpArrayPattern, 2, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpArrayPattern, 1, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHashPattern, 2),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpSetGlobal, 3),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "match (1) { [a, 2] if a => a, _ => 3 }",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMatchArray, 2, 0),
+				code.Make(code.OpJumpNotTruthy, 44),
+				// 0016: a is bound to a scratch global until the arm is taken
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMatchLiteral),
+				code.Make(code.OpJumpNotTruthy, 46),
+				// 0026
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJumpNotTruthy, 46),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpSetGlobal, 2),
+				// 0038
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpJump, 60),
+				// 0044
+				code.Make(code.OpPop),
+				code.Make(code.OpPop),
+				// 0046
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpJump, 60),
+				// 0056
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpNoMatch),
+				// 0060
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lib.mk"), []byte("export let x = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	program := parse(`import "lib.mk" as a; import "lib.mk" as b; a.x`)
+	program.File = filepath.Join(dir, "main.mk")
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+	// Both imports load the single module function.
+	expectedInstructions := []code.Instructions{
+		code.Make(code.OpImport, 2),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpImport, 2),
+		code.Make(code.OpSetGlobal, 1),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpMember, 3),
+		code.Make(code.OpPop),
+	}
+	if err := testInstructions(expectedInstructions, bytecode.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	expectedConstants := []interface{}{
+		1,
+		"x",
+		[]code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpSetLocal, 0),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpModule, 1),
+			code.Make(code.OpReturnValue),
+		},
+		"x",
+	}
+	if err := testConstants(expectedConstants, bytecode.Constants); err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+	if fn := bytecode.Constants[2].(*object.CompiledFunction); fn.Name != object.ModuleFunction || fn.File != filepath.Join(dir, "lib.mk") {
+		t.Errorf("wrong module function: name=%q, file=%q", fn.Name, fn.File)
+	}
+}
+
+func TestUnboundNames(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let f = fn() { g }; let g = 1;",
+			expectedConstants: []interface{}{
+				"g",
+				[]code.Instructions{
+					code.Make(code.OpGetLateGlobal, 0, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input:             "x; let x = 1; x; let x = 2;",
+			expectedConstants: []interface{}{"x", 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetLateGlobal, 0, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestResolveNested(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	builtin := global.DefineBuiltin(3, "len")
+	firstLocal := NewEnclosedSymbolTable(global)
+	b := firstLocal.Define("b")
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	c := secondLocal.Define("c")
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{global, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{global, "len", Symbol{Name: "len", Scope: BuiltinScope, Index: 3}},
+		{firstLocal, "a", a},
+		{firstLocal, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{secondLocal, "len", builtin},
+		{secondLocal, "b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+		{secondLocal, "c", c},
+		{secondLocal, "b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+	}
+	for _, tt := range tests {
+		result, ok := tt.table.Resolve(tt.name)
+		if !ok || result != tt.expected {
+			t.Errorf("resolving %s: want=%+v, got=%+v", tt.name, tt.expected, result)
+		}
+	}
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0] != b {
+		t.Errorf("wrong free symbols: %+v", secondLocal.FreeSymbols)
+	}
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("local symbol b resolved in the global table")
+	}
+}
+
+func TestBindings(t *testing.T) {
+	global := NewSymbolTableWithBuiltins()
+	global.Define("len")
+	global.Define("a")
+	global.markSet("a")
+	outer := NewEnclosedSymbolTable(global)
+	outer.Define("a")
+	outer.Define("b")
+	outer.markSet("b")
+	inner := NewEnclosedSymbolTable(outer)
+	inner.Define("a")
+	inner.Define("b")
+
+	tests := []struct {
+		name     string
+		expected []binding
+	}{
+		{"a", []binding{
+			{Symbol{Name: "a", Scope: LocalScope, Index: 0}, false},
+			{Symbol{Name: "a", Scope: FreeScope, Index: 0}, false},
+			{Symbol{Name: "a", Scope: GlobalScope, Index: 1}, true},
+		}},
+		{"b", []binding{
+			{Symbol{Name: "b", Scope: LocalScope, Index: 1}, false},
+			{Symbol{Name: "b", Scope: FreeScope, Index: 1}, true},
+		}},
+		{"len", []binding{
+			{Symbol{Name: "len", Scope: GlobalScope, Index: 0}, false},
+			{Symbol{Name: "len", Scope: BuiltinScope, Index: 0}, true},
+		}},
+		{"puts", []binding{{Symbol{Name: "puts", Scope: BuiltinScope, Index: 1}, true}}},
+		{"c", nil},
+	}
+	for _, tt := range tests {
+		if got := inner.bindings(tt.name); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("wrong bindings of %s. want=%+v, got=%+v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestShadow(t *testing.T) {
+	global := NewSymbolTable()
+	x := global.Define("x")
+	global.markSet("x")
+	local := NewEnclosedSymbolTable(global)
+	y := local.Define("y")
+
+	scratch, unshadow := local.shadow([]string{"x", "y"})
+	want := []binding{{scratch[1], false}, {y, false}}
+	if got := local.bindings("y"); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong bindings of shadowed y. want=%+v, got=%+v", want, got)
+	}
+	want = []binding{{scratch[0], false}, {x, true}}
+	if got := local.bindings("x"); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong bindings of shadowed x. want=%+v, got=%+v", want, got)
+	}
+	if defined := local.Define("y"); defined != scratch[1] {
+		t.Errorf("shadowed y defined: want=%+v, got=%+v", scratch[1], defined)
+	}
+	local.markSet("y")
+	unshadow()
+
+	want = []binding{{y, false}}
+	if got := local.bindings("y"); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong bindings of y after shadow. want=%+v, got=%+v", want, got)
+	}
+	if _, ok := local.store["x"]; ok {
+		t.Errorf("x still bound in the local table after shadow")
+	}
+}
+
+func TestDefineAgain(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if again := global.Define("a"); again != a {
+		t.Errorf("global defined again moved: want=%+v, got=%+v", a, again)
+	}
+	b := global.Reserve("b")
+	if !global.Reserved("b") || global.Reserve("b") != b {
+		t.Errorf("reserving b twice gave a new symbol")
+	}
+	if defined := global.Define("b"); defined != b || global.Reserved("b") {
+		t.Errorf("defining reserved b: want=%+v, got=%+v, still reserved=%t", b, defined, global.Reserved("b"))
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	c := local.Define("c")
+	if again := local.Define("c"); again != c {
+		t.Errorf("local defined again moved: want=%+v, got=%+v", c, again)
+	}
+}
+
+func parse(input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	return p.ParseProgram()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := compiler.Bytecode()
+		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != nil {
+			t.Fatalf("%q: testInstructions failed: %s", tt.input, err)
+		}
+		if err := testConstants(tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("%q: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+	if concatted.String() != actual.String() {
+		return fmt.Errorf("wrong instructions.\nwant=%q\ngot =%q", concatted, actual)
+	}
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. want=%d, got=%d", len(expected), len(actual))
+	}
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			result, ok := actual[i].(*object.Integer)
+			if !ok || result.Value != int64(constant) {
+				return fmt.Errorf("constant %d: want integer %d, got=%+v", i, constant, actual[i])
+			}
+		case string:
+			result, ok := actual[i].(*object.String)
+			if !ok || result.Value != constant {
+				return fmt.Errorf("constant %d: want string %q, got=%+v", i, constant, actual[i])
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d: not a function: %T", i, actual[i])
+			}
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d: %s", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func TestLineTable(t *testing.T) {
+	input := `let x = 1;
+if (x) {
+  fn(a) {
+    a * 2
+  }
+}`
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+	expected := code.LineTable{
+		{Offset: 0, Line: 1, Column: 9},  // OpConstant 1
+		{Offset: 3, Line: 1, Column: 1},  // OpSetGlobal
+		{Offset: 6, Line: 2, Column: 5},  // OpGetGlobal
+		{Offset: 9, Line: 2, Column: 1},  // OpJumpNotTruthy
+		{Offset: 12, Line: 3, Column: 3}, // OpClosure
+		{Offset: 16, Line: 2, Column: 1}, // OpJump, OpNull, OpPop
+	}
+	if !reflect.DeepEqual(bytecode.Lines, expected) {
+		t.Errorf("wrong main line table.\nwant=%v\ngot =%v", expected, bytecode.Lines)
+	}
+	fn := bytecode.Constants[2].(*object.CompiledFunction)
+	expected = code.LineTable{
+		{Offset: 0, Line: 4, Column: 5}, // OpGetLocal
+		{Offset: 2, Line: 4, Column: 9}, // OpConstant 2
+		{Offset: 5, Line: 4, Column: 7}, // OpMul
+		{Offset: 6, Line: 4, Column: 5}, // OpReturnValue
+	}
+	if !reflect.DeepEqual(fn.Lines, expected) {
+		t.Errorf("wrong function line table.\nwant=%v\ngot =%v", expected, fn.Lines)
+	}
+}
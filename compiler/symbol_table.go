@@ -0,0 +1,264 @@
+package compiler
+
+import "github.com/kellemNegasi/monkeylang/object"
+
+// SymbolScope tells where the value of a symbol is stored at run time.
+type SymbolScope string
+
+// Definitions of symbol scopes.
+const (
+	// GlobalScope symbols live in the VM's globals store.
+	GlobalScope SymbolScope = "GLOBAL"
+	// LocalScope symbols live in the stack frame of the current function.
+	LocalScope SymbolScope = "LOCAL"
+	// BuiltinScope symbols are the builtin functions of object.Builtins.
+	BuiltinScope SymbolScope = "BUILTIN"
+	// FreeScope symbols are locals of an enclosing function captured by the
+	// current closure.
+	FreeScope SymbolScope = "FREE"
+)
+
+// Symbol is a name bound by a let statement or a function parameter.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable maps names to symbols. Each function body gets its own table
+// enclosed in the table of the surrounding code.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// FreeSymbols are the symbols of enclosing functions this table's
+	// function captures, in the order of their FreeScope indexes.
+	FreeSymbols []Symbol
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// reserved holds the globals code referred to before they were
+	// defined, until they are.
+	reserved map[string]bool
+	// set holds the names whose symbols are set whenever the code compiled
+	// next runs.
+	set map[string]bool
+	// builtins binds the names of the builtin functions, which globals of
+	// the same names shadow once they are set.
+	builtins map[string]Symbol
+	// free maps the symbols of enclosing functions this table's function
+	// captures to its free symbols.
+	free map[Symbol]Symbol
+	// shadowed holds, innermost last, the bindings of the names shadow
+	// binds to scratch slots, until they are restored.
+	shadowed []map[string]binding
+}
+
+// binding is a symbol a name may be bound to, and whether it is set whenever
+// the code compiled next runs.
+type binding struct {
+	Symbol
+	set bool
+}
+
+// NewSymbolTable returns an empty global symbol table.
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		store:    make(map[string]Symbol),
+		set:      make(map[string]bool),
+		builtins: make(map[string]Symbol),
+		free:     make(map[Symbol]Symbol),
+	}
+}
+
+// NewSymbolTableWithBuiltins returns a global symbol table defining the
+// builtin functions.
+func NewSymbolTableWithBuiltins() *SymbolTable {
+	s := NewSymbolTable()
+	for i, v := range object.Builtins {
+		s.DefineBuiltin(i, v.Name)
+	}
+	return s
+}
+
+// NewEnclosedSymbolTable returns an empty local symbol table nested in outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in s and returns its symbol. A name defined again, or a
+// global reserved by Reserve, keeps its index, so that the code compiled
+// earlier sees the value of the latest definition, as it does in the
+// evaluator.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && symbol.Scope != BuiltinScope {
+		delete(s.reserved, name)
+		return symbol
+	}
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// Reserve binds name, in the global table s, to a global that code refers to
+// before a let statement defines it, if one ever does.
+func (s *SymbolTable) Reserve(name string) Symbol {
+	if s.reserved[name] {
+		return s.store[name]
+	}
+	symbol := s.Define(name)
+	if s.reserved == nil {
+		s.reserved = map[string]bool{}
+	}
+	s.reserved[name] = true
+	return symbol
+}
+
+// Reserved reports whether name is a global reserved by Reserve that no let
+// statement has defined yet.
+func (s *SymbolTable) Reserved(name string) bool {
+	return s.reserved[name]
+}
+
+// defineUnnamed binds a new global or local of s that no name refers to.
+func (s *SymbolTable) defineUnnamed() Symbol {
+	symbol := Symbol{Index: s.numDefinitions, Scope: LocalScope}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+	s.numDefinitions++
+	return symbol
+}
+
+// markSet records that the symbol of name is set whenever the code compiled
+// next runs.
+func (s *SymbolTable) markSet(name string) {
+	s.set[name] = true
+}
+
+// shadow binds each of names to a new unnamed global or local of s, not set
+// yet, and returns them with the function binding the names again as they
+// were. While the names are shadowed, lookups that find their scratch slots
+// unset go on to the symbols they were bound to.
+func (s *SymbolTable) shadow(names []string) ([]Symbol, func()) {
+	scratch := make([]Symbol, len(names))
+	shadowed := make(map[string]binding, len(names))
+	reserved := make(map[string]bool, len(names))
+	for i, name := range names {
+		if symbol, ok := s.store[name]; ok {
+			shadowed[name] = binding{symbol, symbol.Scope == BuiltinScope || s.set[name]}
+		}
+		reserved[name] = s.reserved[name]
+		scratch[i] = s.defineUnnamed()
+		s.store[name] = scratch[i]
+		delete(s.set, name)
+	}
+	s.shadowed = append(s.shadowed, shadowed)
+	return scratch, func() {
+		s.shadowed = s.shadowed[:len(s.shadowed)-1]
+		for _, name := range names {
+			delete(s.store, name)
+			delete(s.set, name)
+			if b, ok := shadowed[name]; ok {
+				s.store[name] = b.Symbol
+				if b.set && b.Scope != BuiltinScope {
+					s.set[name] = true
+				}
+			}
+			if reserved[name] {
+				s.reserved[name] = true
+			}
+		}
+	}
+}
+
+// DefineBuiltin binds name to the builtin at index.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	s.builtins[name] = symbol
+	return symbol
+}
+
+// defineFree records that the function of s captures original from an
+// enclosing function, unless it already does.
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	if symbol, ok := s.free[original]; ok {
+		return symbol
+	}
+	s.FreeSymbols = append(s.FreeSymbols, original)
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.free[original] = symbol
+	return symbol
+}
+
+// global returns the outermost table enclosing s.
+func (s *SymbolTable) global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// Resolve looks name up in s and the tables enclosing it. A local of an
+// enclosing function becomes a free symbol of every function in between.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return obj, ok
+	}
+	obj, ok = s.Outer.Resolve(name)
+	if !ok {
+		return obj, ok
+	}
+	if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		return obj, ok
+	}
+	return s.defineFree(obj), true
+}
+
+// bindings returns the symbols name may be bound to in s, innermost first,
+// up to the first one set whenever the code compiled next runs. The symbols
+// before it may not be set then, or ever, and the evaluator, which looks
+// names up as the code runs, goes on to the next one when a symbol is not
+// set. Locals of enclosing functions become free symbols of every function
+// in between, as they do in Resolve.
+func (s *SymbolTable) bindings(name string) []binding {
+	var bindings []binding
+	if symbol, ok := s.store[name]; ok {
+		set := symbol.Scope == BuiltinScope || s.set[name]
+		bindings = append(bindings, binding{symbol, set})
+		if set {
+			return bindings
+		}
+	}
+	for i := len(s.shadowed) - 1; i >= 0; i-- {
+		if b, ok := s.shadowed[i][name]; ok {
+			bindings = append(bindings, b)
+			if b.set {
+				return bindings
+			}
+		}
+	}
+	if s.Outer == nil {
+		if symbol, ok := s.builtins[name]; ok && len(bindings) > 0 {
+			bindings = append(bindings, binding{symbol, true})
+		}
+		return bindings
+	}
+	for _, b := range s.Outer.bindings(name) {
+		if b.Scope == LocalScope || b.Scope == FreeScope {
+			b.Symbol = s.defineFree(b.Symbol)
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings
+}
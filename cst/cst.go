@@ -0,0 +1,208 @@
+// Package cst builds a lossless concrete syntax tree of Monkey source code.
+//
+// The tree keeps every token with its exact spelling together with the
+// whitespace and comments around it, so printing it reproduces the input byte
+// for byte. It follows the green/red design: immutable, position-independent
+// green nodes hold the data, and red nodes add parent links and offsets while
+// navigating. Each node corresponds to the ast node the parser produced for
+// the same tokens.
+package cst
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/parser"
+	"github.com/kellemNegasi/monkeylang/token"
+)
+
+// Kind names the syntax a node represents. It is the name of the matching
+// ast node type, e.g. "LetStatement" or "InfixExpression".
+type Kind string
+
+// Tree is the concrete syntax tree of a source file.
+type Tree struct {
+	// Root is the node for the whole file. Its kind is "Program".
+	Root *Node
+	// Program is the ast the parser produced for the same source.
+	Program *ast.Program
+	// Errors holds the parser errors. The tree is lossless even when there are some.
+	Errors []string
+
+	astOf   map[*GreenNode]ast.Node
+	greenOf map[ast.Node]*GreenNode
+}
+
+// String returns the source text of the tree, identical to the parsed input.
+func (t *Tree) String() string { return t.Root.Text() }
+
+// Find returns the node built from the ast node n, or nil if n is not part
+// of the tree.
+func (t *Tree) Find(n ast.Node) *Node {
+	green, ok := t.greenOf[n]
+	if !ok {
+		return nil
+	}
+	var find func(*Node) *Node
+	find = func(node *Node) *Node {
+		if node.green == green {
+			return node
+		}
+		for _, c := range node.Children() {
+			if c, ok := c.(*Node); ok {
+				if found := find(c); found != nil {
+					return found
+				}
+			}
+		}
+		return nil
+	}
+	return find(t.Root)
+}
+
+// Parse builds the concrete syntax tree of src.
+func Parse(src string) *Tree {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	tree := &Tree{
+		Program: program,
+		Errors:  p.Errors(),
+		astOf:   map[*GreenNode]ast.Node{},
+		greenOf: map[ast.Node]*GreenNode{},
+	}
+	tokens, index := lex(src)
+	root := tree.build(tokens, spans(p, program, index))
+	tree.Root = &Node{tree: tree, green: root}
+	return tree
+}
+
+// lex returns the green tokens of src and the index of each token by position.
+func lex(src string) ([]*GreenToken, map[[2]int]int) {
+	lineStarts := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	type lexed struct {
+		tok        token.Token
+		start, end int
+	}
+	var all []lexed
+	index := map[[2]int]int{}
+	l := lexer.New(src)
+	for {
+		tok := l.NextToken()
+		start := len(src)
+		if tok.Type != token.EOF {
+			start = lineStarts[tok.Line-1] + tok.Column - 1
+		}
+		index[[2]int{tok.Line, tok.Column}] = len(all)
+		all = append(all, lexed{tok: tok, start: start, end: l.Offset()})
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	// The text between two tokens is split after the first line feed: what
+	// comes before it trails the previous token, the rest leads the next one.
+	tokens := make([]*GreenToken, len(all))
+	leading := src[:all[0].start]
+	for i, lx := range all {
+		var trailing, next string
+		if i+1 < len(all) {
+			gap := src[lx.end:all[i+1].start]
+			cut := strings.IndexByte(gap, '\n') + 1
+			if cut == 0 {
+				cut = len(gap)
+			}
+			trailing, next = gap[:cut], gap[cut:]
+		}
+		tokens[i] = NewGreenToken(lx.tok.Type, src[lx.start:lx.end], splitTrivia(leading), splitTrivia(trailing))
+		leading = next
+	}
+	return tokens, index
+}
+
+// entry is an ast node with the range of token indexes it was parsed from.
+type entry struct {
+	node       ast.Node
+	depth      int
+	start, end int
+}
+
+// spans returns the token ranges of the nodes below program, outermost first.
+func spans(p *parser.Parser, program *ast.Program, index map[[2]int]int) []entry {
+	var entries []entry
+	depth := 0
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		depth++
+		span, ok := p.Span(c.Node())
+		if !ok {
+			return true
+		}
+		start, ok1 := index[[2]int{span.Start.Line, span.Start.Column}]
+		end, ok2 := index[[2]int{span.End.Line, span.End.Column}]
+		if ok1 && ok2 && start <= end {
+			entries = append(entries, entry{node: c.Node(), depth: depth, start: start, end: end})
+		}
+		return true
+	}, func(c *ast.Cursor) bool {
+		depth--
+		return true
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		if a.end != b.end {
+			return a.end > b.end
+		}
+		return a.depth < b.depth
+	})
+	return entries
+}
+
+// build nests the tokens under the nodes whose spans cover them.
+func (t *Tree) build(tokens []*GreenToken, entries []entry) *GreenNode {
+	type frame struct {
+		kind     Kind
+		node     ast.Node
+		end      int
+		children []GreenElement
+	}
+	stack := []*frame{{kind: "Program", node: t.Program, end: len(tokens) - 1}}
+	next := 0
+	for i, tok := range tokens {
+		for ; next < len(entries) && entries[next].start <= i; next++ {
+			e := entries[next]
+			top := stack[len(stack)-1]
+			if e.start < i || e.end > top.end {
+				continue // span overlapping its siblings after a parse error
+			}
+			stack = append(stack, &frame{kind: kindOf(e.node), node: e.node, end: e.end})
+		}
+		top := stack[len(stack)-1]
+		top.children = append(top.children, tok)
+		for len(stack) > 1 && stack[len(stack)-1].end == i {
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			green := NewGreenNode(f.kind, f.children...)
+			t.astOf[green], t.greenOf[f.node] = f.node, green
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, green)
+		}
+	}
+	root := NewGreenNode("Program", stack[0].children...)
+	t.astOf[root], t.greenOf[t.Program] = t.Program, root
+	return root
+}
+
+func kindOf(n ast.Node) Kind {
+	return Kind(strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."))
+}
@@ -0,0 +1,147 @@
+package cst
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/token"
+)
+
+var inputs = []string{
+	"",
+	"   \n\t// only a comment\n",
+	"let x = 0x10;",
+	"let  add = fn(a,b) { a + b } ;   // add\r\n\nadd(1, (2 * 3));\n\n// end",
+	"if (x < y) {\n  x\n} else {\n  // nothing\n  y\n}\n",
+	"let = 5; @ fn(x { return",
+	"fn() {}()(((1)))",
+	"let f = fn(a, b = a * 2, ... rest) { [ ...rest, b] };\nf( ...xs, 1)",
+	"xs |>  map( (x)=> x*2 )\n  |> (( y )) => y",
+	"a ?b: null ?? c ?. d?.[ e ]?. ( f )",
+	"`a ${ {\"k\": `}`}[\"k\"] } b\n${ x // note\n}`",
+	"a \x00 b",
+	"\"s\x00\" // c\x00\n`t\x00`\x00",
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, input := range inputs {
+		tree := Parse(input)
+		if tree.String() != input {
+			t.Errorf("round trip failed.\nwant=%q\ngot= %q", input, tree.String())
+		}
+		var text strings.Builder
+		for _, tok := range tree.Root.Tokens() {
+			for _, tr := range tok.Leading() {
+				text.WriteString(tr.Text)
+			}
+			text.WriteString(tok.Text())
+			for _, tr := range tok.Trailing() {
+				text.WriteString(tr.Text)
+			}
+		}
+		if text.String() != input {
+			t.Errorf("tokens do not cover the input.\nwant=%q\ngot= %q", input, text.String())
+		}
+	}
+}
+
+func TestStructure(t *testing.T) {
+	tree := Parse("let x = 0x10 + y; // sum\nf(x)")
+	if len(tree.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", tree.Errors)
+	}
+	root := tree.Root
+	if root.Kind() != "Program" || root.AST() != tree.Program {
+		t.Fatalf("root is not the program. got=%s", root.Kind())
+	}
+	children := root.Children()
+	if len(children) != 3 {
+		t.Fatalf("root has wrong number of children. want 3 (two statements and EOF), got=%d", len(children))
+	}
+
+	let := children[0].(*Node)
+	if let.Kind() != "LetStatement" || let.AST() != tree.Program.Statements[0] {
+		t.Errorf("first child is not the let statement. got=%s", let.Kind())
+	}
+	if let.Text() != "let x = 0x10 + y; // sum\n" {
+		t.Errorf("let statement text wrong. got=%q", let.Text())
+	}
+	var kinds []string
+	for _, c := range let.Children() {
+		switch c := c.(type) {
+		case *Node:
+			kinds = append(kinds, string(c.Kind()))
+		case *Token:
+			kinds = append(kinds, c.Text())
+		}
+	}
+	if strings.Join(kinds, " ") != "let Identifier = InfixExpression ;" {
+		t.Errorf("let statement children wrong. got=%v", kinds)
+	}
+
+	semicolon := let.Children()[4].(*Token)
+	trailing := semicolon.Trailing()
+	if len(trailing) != 3 || trailing[1].Kind != Comment || trailing[1].Text != "// sum" || trailing[2].Kind != Newline {
+		t.Errorf("trailing trivia wrong. got=%+v", trailing)
+	}
+
+	infix := tree.Program.Statements[0].(*ast.LetStatement).Value
+	node := tree.Find(infix)
+	if node == nil || node.Text() != "0x10 + y" {
+		t.Fatalf("Find returned the wrong node: %+v", node)
+	}
+	if node.Parent().AST() != tree.Program.Statements[0] {
+		t.Errorf("parent of the infix node is not the let statement")
+	}
+	literal := node.Children()[0].(*Node)
+	if literal.Text() != "0x10 " || literal.Offset() != 8 {
+		t.Errorf("literal wrong. text=%q offset=%d", literal.Text(), literal.Offset())
+	}
+	if lit, ok := literal.AST().(*ast.IntegerLiteral); !ok || lit.Value != 16 {
+		t.Errorf("literal maps to wrong ast node: %#v", literal.AST())
+	}
+}
+
+func TestParenthesesStayOutsideInnerNode(t *testing.T) {
+	tree := Parse("(a + b) * c")
+	stmt := tree.Root.Children()[0].(*Node)
+	product := stmt.Children()[0].(*Node)
+	if product.Kind() != "InfixExpression" || product.Text() != "(a + b) * c" {
+		t.Fatalf("wrong node. kind=%s text=%q", product.Kind(), product.Text())
+	}
+	children := product.Children()
+	if open, ok := children[0].(*Token); !ok || open.Type() != token.LPAREN {
+		t.Errorf("first child is not the opening parenthesis")
+	}
+	if sum, ok := children[1].(*Node); !ok || sum.Text() != "a + b" {
+		t.Errorf("second child is not the inner sum")
+	}
+}
+
+func TestTokenAt(t *testing.T) {
+	src := "let x =  42;\n"
+	tree := Parse(src)
+	tok := tree.Root.TokenAt(strings.Index(src, "42"))
+	if tok == nil || tok.Text() != "42" || tok.TextOffset() != 9 {
+		t.Fatalf("TokenAt returned the wrong token: %+v", tok)
+	}
+	if tok.Parent().Kind() != "IntegerLiteral" {
+		t.Errorf("token parent wrong. got=%s", tok.Parent().Kind())
+	}
+	if tree.Root.TokenAt(len(src)+1) != nil {
+		t.Errorf("TokenAt past the end should return nil")
+	}
+}
+
+func TestGreenNodesArePositionIndependent(t *testing.T) {
+	a := Parse("x + 1").Root.Children()[0].(*Node).Green()
+	b := Parse("let y = 2;\nx + 1").Root.Children()[1].(*Node).Green()
+	if a.Width() != b.Width() || a.Kind() != b.Kind() {
+		t.Errorf("equal subtrees have different green nodes: %d/%s vs %d/%s", a.Width(), a.Kind(), b.Width(), b.Kind())
+	}
+	n := NewGreenNode("ExpressionStatement", NewGreenToken(token.IDENT, "z", []Trivia{{Whitespace, "  "}}, nil))
+	if n.Width() != 3 {
+		t.Errorf("width wrong. got=%d", n.Width())
+	}
+}
@@ -0,0 +1,141 @@
+package cst
+
+import (
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/token"
+)
+
+// Green nodes are the immutable core of the tree. They know their kind, their
+// children and their width in bytes, but neither their parent nor their
+// position, so a green subtree can be shared and reused by an edited tree.
+
+// GreenElement is either a *GreenNode or a *GreenToken.
+type GreenElement interface {
+	// Width returns the number of source bytes the element covers, trivia included.
+	Width() int
+	writeTo(b *strings.Builder)
+}
+
+// GreenNode is an interior node of the tree.
+type GreenNode struct {
+	kind     Kind
+	width    int
+	children []GreenElement
+}
+
+// NewGreenNode returns a node of the given kind holding children.
+func NewGreenNode(kind Kind, children ...GreenElement) *GreenNode {
+	n := &GreenNode{kind: kind, children: children}
+	for _, c := range children {
+		n.width += c.Width()
+	}
+	return n
+}
+
+// Kind returns the kind of the node.
+func (n *GreenNode) Kind() Kind { return n.kind }
+
+// Width returns the number of source bytes the node covers.
+func (n *GreenNode) Width() int { return n.width }
+
+// Children returns the children of the node.
+func (n *GreenNode) Children() []GreenElement { return n.children }
+
+func (n *GreenNode) writeTo(b *strings.Builder) {
+	for _, c := range n.children {
+		c.writeTo(b)
+	}
+}
+
+// GreenToken is a token with its exact spelling and the trivia around it.
+type GreenToken struct {
+	typ      token.TokenType
+	text     string
+	leading  []Trivia
+	trailing []Trivia
+	width    int
+}
+
+// NewGreenToken returns a token of type typ spelled text, surrounded by the
+// given trivia.
+func NewGreenToken(typ token.TokenType, text string, leading, trailing []Trivia) *GreenToken {
+	t := &GreenToken{typ: typ, text: text, leading: leading, trailing: trailing, width: len(text)}
+	for _, tr := range leading {
+		t.width += len(tr.Text)
+	}
+	for _, tr := range trailing {
+		t.width += len(tr.Text)
+	}
+	return t
+}
+
+// Type returns the token type.
+func (t *GreenToken) Type() token.TokenType { return t.typ }
+
+// Text returns the token exactly as spelled in the source, without trivia.
+func (t *GreenToken) Text() string { return t.text }
+
+// Leading returns the trivia before the token.
+func (t *GreenToken) Leading() []Trivia { return t.leading }
+
+// Trailing returns the trivia after the token, up to and including the end of
+// its line.
+func (t *GreenToken) Trailing() []Trivia { return t.trailing }
+
+// Width returns the number of source bytes the token covers, trivia included.
+func (t *GreenToken) Width() int { return t.width }
+
+func (t *GreenToken) writeTo(b *strings.Builder) {
+	for _, tr := range t.leading {
+		b.WriteString(tr.Text)
+	}
+	b.WriteString(t.text)
+	for _, tr := range t.trailing {
+		b.WriteString(tr.Text)
+	}
+}
+
+// TriviaKind classifies a piece of trivia.
+type TriviaKind int
+
+const (
+	// Whitespace is a run of spaces, tabs and carriage returns.
+	Whitespace TriviaKind = iota
+	// Newline is a single line feed.
+	Newline
+	// Comment is a `//` comment without its line feed.
+	Comment
+)
+
+// Trivia is source text that carries no meaning for the parser.
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+}
+
+// splitTrivia breaks the text between two tokens into trivia pieces.
+func splitTrivia(s string) []Trivia {
+	var pieces []Trivia
+	for len(s) > 0 {
+		var n int
+		var kind TriviaKind
+		switch {
+		case s[0] == '\n':
+			kind, n = Newline, 1
+		case strings.HasPrefix(s, "//"):
+			kind, n = Comment, strings.IndexByte(s, '\n')
+			if n < 0 {
+				n = len(s)
+			}
+		default:
+			kind = Whitespace
+			for n < len(s) && s[n] != '\n' && !strings.HasPrefix(s[n:], "//") {
+				n++
+			}
+		}
+		pieces = append(pieces, Trivia{Kind: kind, Text: s[:n]})
+		s = s[n:]
+	}
+	return pieces
+}
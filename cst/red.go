@@ -0,0 +1,143 @@
+package cst
+
+import (
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/token"
+)
+
+// Red nodes wrap green nodes with the context they lack: their parent and
+// their absolute offset in the source. They are created on demand while the
+// tree is navigated and are cheap to throw away.
+
+// Element is either a *Node or a *Token.
+type Element interface {
+	// Parent returns the enclosing node, or nil for the root.
+	Parent() *Node
+	// Offset returns the byte offset where the element starts, leading trivia included.
+	Offset() int
+	// Width returns the number of bytes the element covers, trivia included.
+	Width() int
+}
+
+// Node is an interior node of the tree at a known position.
+type Node struct {
+	tree   *Tree
+	green  *GreenNode
+	parent *Node
+	offset int
+}
+
+// Kind returns the kind of the node.
+func (n *Node) Kind() Kind { return n.green.kind }
+
+// Green returns the green node underlying n.
+func (n *Node) Green() *GreenNode { return n.green }
+
+// Parent returns the enclosing node, or nil for the root.
+func (n *Node) Parent() *Node { return n.parent }
+
+// Offset returns the byte offset where the node starts, leading trivia included.
+func (n *Node) Offset() int { return n.offset }
+
+// Width returns the number of bytes the node covers, trivia included.
+func (n *Node) Width() int { return n.green.width }
+
+// Text returns the source text of the node, trivia included.
+func (n *Node) Text() string {
+	var b strings.Builder
+	n.green.writeTo(&b)
+	return b.String()
+}
+
+// AST returns the ast node this node was built from, or nil if there is none
+// (for example for the tokens a parse error left unattached).
+func (n *Node) AST() ast.Node { return n.tree.astOf[n.green] }
+
+// Children returns the child nodes and tokens of n in source order.
+func (n *Node) Children() []Element {
+	children := make([]Element, len(n.green.children))
+	offset := n.offset
+	for i, c := range n.green.children {
+		switch c := c.(type) {
+		case *GreenNode:
+			children[i] = &Node{tree: n.tree, green: c, parent: n, offset: offset}
+		case *GreenToken:
+			children[i] = &Token{green: c, parent: n, offset: offset}
+		}
+		offset += c.Width()
+	}
+	return children
+}
+
+// Tokens returns every token below n in source order.
+func (n *Node) Tokens() []*Token {
+	var tokens []*Token
+	for _, c := range n.Children() {
+		switch c := c.(type) {
+		case *Node:
+			tokens = append(tokens, c.Tokens()...)
+		case *Token:
+			tokens = append(tokens, c)
+		}
+	}
+	return tokens
+}
+
+// TokenAt returns the token whose full text, trivia included, contains the
+// byte at offset, or nil if offset lies outside n.
+func (n *Node) TokenAt(offset int) *Token {
+	for _, c := range n.Children() {
+		if offset < c.Offset() || offset >= c.Offset()+c.Width() {
+			continue
+		}
+		switch c := c.(type) {
+		case *Node:
+			return c.TokenAt(offset)
+		case *Token:
+			return c
+		}
+	}
+	return nil
+}
+
+// Token is a token of the tree at a known position.
+type Token struct {
+	green  *GreenToken
+	parent *Node
+	offset int
+}
+
+// Type returns the token type.
+func (t *Token) Type() token.TokenType { return t.green.typ }
+
+// Green returns the green token underlying t.
+func (t *Token) Green() *GreenToken { return t.green }
+
+// Parent returns the node holding t.
+func (t *Token) Parent() *Node { return t.parent }
+
+// Offset returns the byte offset where the token starts, leading trivia included.
+func (t *Token) Offset() int { return t.offset }
+
+// Width returns the number of bytes the token covers, trivia included.
+func (t *Token) Width() int { return t.green.width }
+
+// TextOffset returns the byte offset of the token itself, after its leading trivia.
+func (t *Token) TextOffset() int {
+	offset := t.offset
+	for _, tr := range t.green.leading {
+		offset += len(tr.Text)
+	}
+	return offset
+}
+
+// Text returns the token exactly as spelled in the source.
+func (t *Token) Text() string { return t.green.text }
+
+// Leading returns the trivia before the token.
+func (t *Token) Leading() []Trivia { return t.green.leading }
+
+// Trailing returns the trivia after the token.
+func (t *Token) Trailing() []Trivia { return t.green.trailing }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns the changes turning a into b in unified diff format.
+func unifiedDiff(name string, a, b []byte) string {
+	ops := editScript(splitLines(string(a)), splitLines(string(b)))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+	oldLine, newLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops) && j <= end+2*diffContext; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		end += diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[end]-oldLine[start]),
+			hunkRange(newLine[start], newLine[end]-newLine[start]))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			out.WriteByte('\n')
+		}
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// editScript computes a shortest edit script from x to y. It uses the
+// linear space variant of Myers' algorithm: the middle of an optimal path is
+// found by searching from both ends at once, and the two halves it splits
+// the problem into are solved in turn. Within each run of changed lines the
+// removed ones come first.
+func editScript(x, y []string) []diffOp {
+	var ops []diffOp
+	diffLines(x, y, &ops)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind != ' ' {
+			j++
+		}
+		sort.SliceStable(ops[i:j], func(a, b int) bool {
+			return ops[i+a].kind == '-' && ops[i+b].kind == '+'
+		})
+		i = j
+	}
+	return ops
+}
+
+func diffLines(x, y []string, ops *[]diffOp) {
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix &&
+		x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	for _, line := range x[:prefix] {
+		*ops = append(*ops, diffOp{' ', line})
+	}
+	xs, ys := x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+	switch {
+	case len(xs) == 0:
+		for _, line := range ys {
+			*ops = append(*ops, diffOp{'+', line})
+		}
+	case len(ys) == 0:
+		for _, line := range xs {
+			*ops = append(*ops, diffOp{'-', line})
+		}
+	default:
+		if i, j, ok := middle(xs, ys); ok {
+			diffLines(xs[:i], ys[:j], ops)
+			diffLines(xs[i:], ys[j:], ops)
+			break
+		}
+		for _, line := range xs {
+			*ops = append(*ops, diffOp{'-', line})
+		}
+		for _, line := range ys {
+			*ops = append(*ops, diffOp{'+', line})
+		}
+	}
+	for _, line := range x[len(x)-suffix:] {
+		*ops = append(*ops, diffOp{' ', line})
+	}
+}
+
+// middle finds a point (i, j) on a shortest edit path from x to y, strictly
+// between its ends, by following the furthest reaching paths forward from
+// the start and backward from the end until they overlap. Neither x nor y
+// is empty, and they differ in their first and last lines. It reports false
+// if the paths do not meet, when x and y have no line in common.
+func middle(x, y []string) (int, int, bool) {
+	n, m := len(x), len(y)
+	maxD := (n + m + 1) / 2
+	// forward[maxD+k] is the furthest x reached on diagonal k = x - y from
+	// the start, backward[maxD+k] the furthest distance from the end
+	// reached on diagonal k counted from the end.
+	forward, backward := make([]int, 2*maxD+2), make([]int, 2*maxD+2)
+	for k := range forward {
+		forward[k], backward[k] = -1, -1
+	}
+	forward[maxD+1], backward[maxD+1] = 0, 0
+	delta := n - m
+	odd := delta%2 != 0
+	// Diagonals whose paths have run off the edit graph are skipped.
+	startF, endF, startB, endB := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + startF; k <= d-endF; k += 2 {
+			var i int
+			if k == -d || k != d && forward[maxD+k-1] < forward[maxD+k+1] {
+				i = forward[maxD+k+1]
+			} else {
+				i = forward[maxD+k-1] + 1
+			}
+			j := i - k
+			for i < n && j < m && x[i] == y[j] {
+				i++
+				j++
+			}
+			forward[maxD+k] = i
+			switch {
+			case i > n:
+				endF += 2
+			case j > m:
+				startF += 2
+			case odd:
+				if b := maxD + delta - k; b >= 0 && b < len(backward) && backward[b] != -1 && i >= n-backward[b] {
+					return i, j, true
+				}
+			}
+		}
+		for k := -d + startB; k <= d-endB; k += 2 {
+			var i int
+			if k == -d || k != d && backward[maxD+k-1] < backward[maxD+k+1] {
+				i = backward[maxD+k+1]
+			} else {
+				i = backward[maxD+k-1] + 1
+			}
+			j := i - k
+			for i < n && j < m && x[n-1-i] == y[m-1-j] {
+				i++
+				j++
+			}
+			backward[maxD+k] = i
+			switch {
+			case i > n:
+				endB += 2
+			case j > m:
+				startB += 2
+			case !odd:
+				if f := maxD + delta - k; f >= 0 && f < len(forward) && forward[f] != -1 && forward[f] >= n-i {
+					fi := forward[f]
+					return fi, fi - (delta - k), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{"a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n", "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nL\nm\nn\n",
+			"--- f\n+++ f\n@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n@@ -9,5 +9,6 @@\n i\n j\n k\n-l\n+L\n m\n+n\n"},
+		{"a\nb\nc\nd\n", "a\nB\nc\nD\n", "--- f\n+++ f\n@@ -1,4 +1,4 @@\n a\n-b\n+B\n c\n-d\n+D\n"},
+		{"x\ny\n", "w\nx\ny\n", "--- f\n+++ f\n@@ -1,2 +1,3 @@\n+w\n x\n y\n"},
+		{"", "a\n", "--- f\n+++ f\n@@ -0,0 +1,1 @@\n+a\n"},
+		{"a\nb\n", "", "--- f\n+++ f\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"a\n", "a\n", "--- f\n+++ f\n"},
+	}
+	for _, tt := range tests {
+		if got := unifiedDiff("f", []byte(tt.a), []byte(tt.b)); got != tt.expected {
+			t.Errorf("unifiedDiff(%q, %q) wrong.\nwant=%q\ngot= %q", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+// TestEditScript checks that edit scripts are shortest and turn one input
+// into the other, also for inputs too long for a table of all their pairs
+// of lines.
+func TestEditScript(t *testing.T) {
+	long := make([]string, 200000)
+	for i := range long {
+		long[i] = strconv.Itoa(i)
+	}
+	edited := append(append([]string{"first"}, long[:1000]...), long[1001:]...)
+	tests := []struct {
+		x, y    []string
+		changes int
+	}{
+		{strings.Split("abcabba", ""), strings.Split("cbabac", ""), 5},
+		{strings.Split("abc", ""), strings.Split("xyz", ""), 6},
+		{nil, strings.Split("ab", ""), 2},
+		{long, edited, 2},
+	}
+	for _, tt := range tests {
+		ops := editScript(tt.x, tt.y)
+		var x, y []string
+		changes := 0
+		for _, op := range ops {
+			if op.kind != '+' {
+				x = append(x, op.text)
+			}
+			if op.kind != '-' {
+				y = append(y, op.text)
+			}
+			if op.kind != ' ' {
+				changes++
+			}
+		}
+		if strings.Join(x, "\n") != strings.Join(tt.x, "\n") || strings.Join(y, "\n") != strings.Join(tt.y, "\n") {
+			t.Errorf("edit script does not turn %.20q into %.20q", tt.x, tt.y)
+		}
+		if changes != tt.changes {
+			t.Errorf("wrong number of changes from %.20q to %.20q. want=%d, got=%d", tt.x, tt.y, tt.changes, changes)
+		}
+	}
+}
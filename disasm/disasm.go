@@ -0,0 +1,130 @@
+// Package disasm renders compiled bytecode in readable form, one instruction
+// per line, to make the output of the compiler visible.
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/code"
+	"github.com/kellemNegasi/monkeylang/compiler"
+	"github.com/kellemNegasi/monkeylang/object"
+)
+
+// textWidth is the width the text of an instruction is padded to when it is
+// followed by a comment.
+const textWidth = 18
+
+// Bytecode writes the disassembly of a compiled program to w.
+//
+// Each instruction is printed with its offset, opcode name and decoded
+// operands. The constant loaded by OpConstant is shown in a comment after it,
+// and the body of the function an OpClosure closes over is disassembled below
+// it, indented one level, as is the body of the module an OpImport loads.
+// Whenever the source line changes, a `line N:` annotation precedes the
+// instructions compiled from that line; if src is not nil, the annotation
+// includes the text of the line.
+func Bytecode(w io.Writer, bytecode *compiler.Bytecode, src []byte) error {
+	d := &disassembler{constants: bytecode.Constants, file: bytecode.File}
+	if src != nil {
+		d.lines = strings.Split(string(src), "\n")
+	}
+	d.instructions(bytecode.Instructions, bytecode.Lines)
+	_, err := w.Write(d.out.Bytes())
+	return err
+}
+
+type disassembler struct {
+	out       bytes.Buffer
+	constants []object.Object
+	lines     []string // source lines, if known
+	file      string   // the file of the source lines
+	depth     int      // nesting level of the function being printed
+}
+
+func (d *disassembler) printf(format string, a ...interface{}) {
+	d.out.WriteString(strings.Repeat("    ", d.depth))
+	fmt.Fprintf(&d.out, format, a...)
+}
+
+func (d *disassembler) instructions(ins code.Instructions, lines code.LineTable) {
+	lastLine := 0
+	for i := 0; i < len(ins); {
+		if line, _ := lines.Lookup(i); line > 0 && line != lastLine {
+			d.annotate(line)
+			lastLine = line
+		}
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			d.printf("%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			d.printf("%04d ERROR: truncated %s\n", i, def.Name)
+			return
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		text := def.Name
+		for _, o := range operands {
+			text += " " + strconv.Itoa(o)
+		}
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant, code.OpClosure, code.OpImport, code.OpMember:
+			d.constant(i, text, operands[0])
+		default:
+			d.printf("%04d %s\n", i, text)
+		}
+		i += 1 + read
+	}
+}
+
+// annotate prints the source line that the following instructions were
+// compiled from.
+func (d *disassembler) annotate(line int) {
+	if line <= len(d.lines) {
+		d.printf("line %d: %s\n", line, strings.TrimSpace(d.lines[line-1]))
+	} else {
+		d.printf("line %d:\n", line)
+	}
+}
+
+// constant prints an instruction loading a constant, and the constant.
+func (d *disassembler) constant(offset int, text string, index int) {
+	if index >= len(d.constants) {
+		d.printf("%04d %-*s ; no such constant\n", offset, textWidth, text)
+		return
+	}
+	switch c := d.constants[index].(type) {
+	case *object.String:
+		d.printf("%04d %-*s ; %s\n", offset, textWidth, text, strconv.Quote(c.Value))
+	case *object.CompiledFunction:
+		name := c.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		if name == object.ModuleFunction {
+			d.printf("%04d %-*s ; module %s (%d locals)\n", offset, textWidth, text, c.File, c.NumLocals)
+		} else {
+			d.printf("%04d %-*s ; fn %s(%d params, %d locals)\n", offset, textWidth, text, name, c.NumParameters, c.NumLocals)
+		}
+		// The source lines of other files are not known.
+		lines := d.lines
+		if c.File != d.file {
+			d.lines = nil
+		}
+		d.depth++
+		d.instructions(c.Instructions, c.Lines)
+		d.depth--
+		d.lines = lines
+	default:
+		d.printf("%04d %-*s ; %s\n", offset, textWidth, text, c.Inspect())
+	}
+}
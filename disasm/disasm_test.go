@@ -0,0 +1,91 @@
+package disasm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/code"
+	"github.com/kellemNegasi/monkeylang/compiler"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/object"
+	"github.com/kellemNegasi/monkeylang/parser"
+)
+
+func TestBytecode(t *testing.T) {
+	src := `let greet = fn(greeting) {
+  fn(name) { greeting + name }
+};
+greet("hi ")("bob");`
+	expected := `line 1: let greet = fn(greeting) {
+0000 OpClosure 1 0      ; fn greet(1 params, 1 locals)
+    line 2: fn(name) { greeting + name }
+    0000 OpGetLocalCell 0
+    0002 OpClosure 0 1      ; fn <anonymous>(1 params, 1 locals)
+        line 2: fn(name) { greeting + name }
+        0000 OpGetFree 0
+        0002 OpGetLocal 0
+        0004 OpAdd
+        0005 OpReturnValue
+    0006 OpReturnValue
+0004 OpSetGlobal 0
+line 4: greet("hi ")("bob");
+0007 OpGetGlobal 0
+0010 OpConstant 2       ; "hi "
+0013 OpCall 1
+0015 OpConstant 3       ; "bob"
+0018 OpCall 1
+0020 OpPop
+`
+	if got := disassemble(t, src, []byte(src)); got != expected {
+		t.Errorf("wrong disassembly.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestBytecodeWithoutSource(t *testing.T) {
+	expected := `line 1:
+0000 OpConstant 0       ; 7
+0003 OpMinus
+0004 OpPop
+line 2:
+0005 OpTrue
+0006 OpPop
+`
+	if got := disassemble(t, "-7;\ntrue", nil); got != expected {
+		t.Errorf("wrong disassembly.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestMalformedInstructions(t *testing.T) {
+	ins := append(code.Make(code.OpConstant, 3), 255)
+	ins = append(ins, byte(code.OpJump), 0)
+	bytecode := &compiler.Bytecode{Instructions: ins, Constants: []object.Object{}}
+	expected := `0000 OpConstant 3       ; no such constant
+0003 ERROR: opcode 255 undefined
+0004 ERROR: truncated OpJump
+`
+	var out bytes.Buffer
+	if err := Bytecode(&out, bytecode, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong disassembly.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func disassemble(t *testing.T, input string, src []byte) string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var out bytes.Buffer
+	if err := Bytecode(&out, comp.Bytecode(), src); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
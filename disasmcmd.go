@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kellemNegasi/monkeylang/disasm"
+	"github.com/kellemNegasi/monkeylang/mkc"
+)
+
+// disasmMain implements `monkey disasm [file]`, which prints the bytecode of a
+// source file, a compiled .mkc file or standard input. Source line
+// annotations include the text of the lines only for source input.
+func disasmMain(args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintf(os.Stderr, "usage: monkey disasm [file]\n")
+		return 2
+	}
+	var src []byte
+	var path string
+	var err error
+	if len(args) == 0 {
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		path = args[0]
+		src, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey disasm: %v\n", err)
+		return 1
+	}
+
+	bytecode, err := load(path, src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey disasm: %v\n", err)
+		return 1
+	}
+	if mkc.IsCompiled(src) {
+		src = nil
+	}
+	if err := disasm.Bytecode(os.Stdout, bytecode, src); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey disasm: %v\n", err)
+		return 1
+	}
+	return 0
+}
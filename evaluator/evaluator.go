@@ -0,0 +1,1157 @@
+// Package evaluator implements a tree-walking interpreter for Monkey. It is
+// the reference semantics the bytecode compiler and virtual machine follow.
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/limits"
+	"github.com/kellemNegasi/monkeylang/modules"
+	"github.com/kellemNegasi/monkeylang/object"
+)
+
+// The values of true, false and null are shared singletons.
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+// skipped is the value a link of a member access, index and call chain
+// passes to the next link when an optional link found null. The outermost
+// link turns it into NULL, so it never leaves the chain. It has a type of its
+// own, as pointers to distinct zero-size values such as NULL may be equal.
+var skipped object.Object = &skippedLink{}
+
+type skippedLink struct{ object.Null }
+
+// Eval evaluates node in env and returns its value. Runtime failures are
+// returned as *object.Error values. Statements that produce no value, such as
+// let statements, evaluate to nil.
+//
+// Eval enforces the default limits.Config: calls may nest at most
+// limits.DefaultMaxDepth deep. Exceeding it is a runtime error.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	result, err := EvalContext(context.Background(), node, env, limits.Config{})
+	if err != nil {
+		return newError("%s", err)
+	}
+	return result
+}
+
+// EvalContext is like Eval but stops when ctx is done or the program exceeds
+// one of the limits of config. It then returns one of the error types of
+// package limits; runtime failures of the program are still returned as
+// *object.Error values. A step is the evaluation of one node.
+//
+// The Trace of a runtime failure lists the function calls being evaluated
+// when it occurred. Limit errors carry no trace.
+//
+// Calls nest at most as deep as the Go stack allows, tens of thousands of
+// calls, even if config.MaxDepth is larger; the DepthError of a program
+// nesting deeper gives the depth its calls reached.
+//
+// Imports are resolved relative to the file of node if it is a program, and
+// each imported file is evaluated once per call.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, config limits.Config) (result object.Object, err error) {
+	var root string
+	if program, ok := node.(*ast.Program); ok {
+		root = program.File
+	}
+	e := &interpreter{
+		meter:    limits.NewMeter(ctx, config),
+		function: object.MainFunction,
+		loader:   modules.NewLoader(root),
+		modules:  map[string]*object.Module{},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			exceeded, ok := r.(limitExceeded)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, exceeded.err
+		}
+	}()
+	if err := e.meter.Canceled(); err != nil {
+		return nil, err
+	}
+	return e.eval(node, env), nil
+}
+
+// interpreter holds the state of one evaluation.
+type interpreter struct {
+	meter *limits.Meter
+	// function names the function being evaluated and file the file it was
+	// defined in, for the stack traces of errors.
+	function, file string
+
+	loader  *modules.Loader
+	modules map[string]*object.Module // the modules imported so far, by path
+
+	// link is set while the object of a member access, index or call is
+	// about to be evaluated and is itself such a link of the same chain.
+	link bool
+
+	// nesting is the number of calls to eval being made, nested in each
+	// other.
+	nesting int
+}
+
+// maxNesting bounds the nesting of calls to eval, each of which takes at
+// most a few kilobytes of Go stack, so that the Go stack holds the evaluation
+// whatever the depth limit. A program nesting deeper stops with a
+// *limits.DepthError whose limit is the depth of the calls it was making.
+const maxNesting = 100000
+
+// limitExceeded carries an exceeded limit up to EvalContext, unwinding the
+// evaluation of the program without passing through any Monkey code.
+type limitExceeded struct {
+	err error
+}
+
+// check stops the evaluation if err, returned by the meter, is not nil.
+func (e *interpreter) check(err error) {
+	if err != nil {
+		panic(limitExceeded{err})
+	}
+}
+
+// alloc counts the allocation of obj.
+func (e *interpreter) alloc(obj object.Object) object.Object {
+	e.check(e.meter.Alloc(limits.SizeOf(obj)))
+	return obj
+}
+
+// callBuiltin returns the result of calling builtin with args, passing it
+// the meter if it takes one.
+func (e *interpreter) callBuiltin(builtin *object.Builtin, args []object.Object) object.Object {
+	if builtin.Metered == nil {
+		return builtin.Fn(args...)
+	}
+	result, err := builtin.Metered(e.meter, args...)
+	e.check(err)
+	return result
+}
+
+// inspect returns the text of obj, metering its construction.
+func (e *interpreter) inspect(obj object.Object) string {
+	text, err := object.InspectMetered(obj, e.meter)
+	e.check(err)
+	return text
+}
+
+// frame returns the stack frame of the function being evaluated, positioned
+// at node.
+func (e *interpreter) frame(node ast.Node) object.Frame {
+	tok := ast.TokenOf(node)
+	return object.Frame{Function: e.function, File: e.file, Line: tok.Line, Column: tok.Column}
+}
+
+// eval evaluates node. An error raised by node itself, rather than by the
+// nodes it contains, is given a trace starting at node.
+func (e *interpreter) eval(node ast.Node, env *object.Environment) object.Object {
+	if e.nesting == maxNesting {
+		e.check(&limits.DepthError{Limit: e.meter.Depth()})
+	}
+	e.nesting++
+	result := e.evalNode(node, env)
+	e.nesting--
+	if err, ok := result.(*object.Error); ok && err.Trace == nil {
+		err.Trace = []object.Frame{e.frame(node)}
+	}
+	return result
+}
+
+func (e *interpreter) evalNode(node ast.Node, env *object.Environment) object.Object {
+	e.check(e.meter.Step())
+	switch node := node.(type) {
+	// statements
+	case *ast.Program:
+		return e.evalProgram(node, env)
+	case *ast.BlockStatement:
+		return e.evalBlockStatement(node, env)
+	case *ast.ExpressionStatement:
+		return e.eval(node.Expression, env)
+	case *ast.ReturnStatement:
+		val := e.evalTail(node.ReturnValue, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := e.eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return e.throw(val)
+	case *ast.LetStatement:
+		val := e.eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if node.Pattern != nil {
+			if err := e.bind(node.Pattern, val, env); err != nil {
+				return err
+			}
+			return nil
+		}
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			val.(*object.Function).Name = node.Name.Value
+		}
+		env.Set(node.Name.Value, val)
+	case *ast.ImportStatement:
+		module := e.importModule(node)
+		if isAbrupt(module) {
+			return module
+		}
+		env.Set(node.Name.Value, module)
+	case *ast.ExportStatement:
+		return e.eval(node.Statement, env)
+
+	// expressions
+	case *ast.IntegerLiteral:
+		return e.alloc(&object.Integer{Value: node.Value})
+	case *ast.StringLiteral:
+		return e.alloc(&object.String{Value: node.Value})
+	case *ast.TemplateLiteral:
+		return e.evalTemplateLiteral(node, env)
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.NullLiteral:
+		return NULL
+	case *ast.PrefixExpression:
+		right := e.eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return e.alloc(evalPrefixExpression(node.Operator, right))
+	case *ast.InfixExpression:
+		left := e.eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		right := e.eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return e.alloc(evalInfixExpression(node.Operator, left, right))
+	case *ast.ConditionalExpression:
+		return e.evalConditionalExpression(node, env, false)
+	case *ast.CoalesceExpression:
+		return e.evalCoalesceExpression(node, env, false)
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
+	case *ast.MatchExpression:
+		return e.evalMatchExpression(node, env, false)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.FunctionLiteral:
+		return e.alloc(&object.Function{Parameters: node.Parameters, Rest: node.Rest, Body: node.Body, Env: env, File: e.file})
+	case *ast.CallExpression:
+		return e.evalCall(node, node.Function, node.Arguments, env, false)
+	case *ast.PipeExpression:
+		function, arguments := node.Call()
+		return e.evalCall(node, function, arguments, env, false)
+	case *ast.ArrayLiteral:
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
+			return elements[0]
+		}
+		return e.alloc(&object.Array{Elements: elements})
+	case *ast.HashLiteral:
+		return e.evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		inner := e.enterLink()
+		left := e.evalLinkObject(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		if left == skipped || node.Optional && isNull(left) {
+			return skip(inner)
+		}
+		index := e.eval(node.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	case *ast.MemberExpression:
+		inner := e.enterLink()
+		obj := e.evalLinkObject(node.Object, env)
+		if isAbrupt(obj) {
+			return obj
+		}
+		if obj == skipped || node.Optional && isNull(obj) {
+			return skip(inner)
+		}
+		return evalMemberExpression(obj, node.Member.Value)
+	}
+	return nil
+}
+
+// evalProgram evaluates the statements of a program in order. It stops at a
+// return statement or an error and unwraps returned values.
+func (e *interpreter) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	e.file = program.File
+	var result object.Object
+	for _, statement := range program.Statements {
+		result = e.eval(statement, env)
+		switch r := result.(type) {
+		case *object.ReturnValue:
+			return r.Value
+		case *object.Error:
+			return r
+		case *tailCall:
+			return e.call(r.node, r.fn, r.args)
+		}
+	}
+	return result
+}
+
+// evalBlockStatement evaluates the statements of a block. Unlike evalProgram
+// it leaves return values and tail calls as they are so they keep unwinding
+// enclosing blocks.
+func (e *interpreter) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	return e.evalStatements(block.Statements, env, false)
+}
+
+// evalStatements evaluates statements in order. If tail is set, the last
+// statement is in tail position.
+func (e *interpreter) evalStatements(statements []ast.Statement, env *object.Environment, tail bool) object.Object {
+	var result object.Object
+	for i, statement := range statements {
+		if tail && i == len(statements)-1 {
+			result = e.evalTail(statement, env)
+		} else {
+			result = e.eval(statement, env)
+		}
+		if isAbrupt(result) {
+			return result
+		}
+	}
+	return result
+}
+
+// tailCallObj is the type of tailCall values.
+const tailCallObj = "TAIL_CALL"
+
+// tailCall is a call in tail position waiting to be made. Instead of calling
+// the function, which would nest a Go call for every Monkey call, the
+// evaluator returns a tailCall up to the function being executed, which then
+// makes the call in place of its own.
+type tailCall struct {
+	node ast.Expression // the call or pipe
+	fn   object.Object
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return tailCallObj }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// evalTail evaluates node, which is in tail position: its value is the
+// value of the function being executed. A call there evaluates to a tailCall.
+// The positions are those described by ast.TailCalls.
+func (e *interpreter) evalTail(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		return e.evalTail(node.Expression, env)
+	case *ast.IfExpression:
+		e.check(e.meter.Step())
+		condition := e.eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return e.evalTailBranch(node.Consequence, env)
+		} else if node.Alternative != nil {
+			return e.evalTailBranch(node.Alternative, env)
+		}
+		return NULL
+	case *ast.ConditionalExpression:
+		e.check(e.meter.Step())
+		return e.evalConditionalExpression(node, env, true)
+	case *ast.CoalesceExpression:
+		e.check(e.meter.Step())
+		return e.evalCoalesceExpression(node, env, true)
+	case *ast.MatchExpression:
+		e.check(e.meter.Step())
+		return e.evalMatchExpression(node, env, true)
+	case *ast.CallExpression:
+		e.check(e.meter.Step())
+		return e.evalCall(node, node.Function, node.Arguments, env, true)
+	case *ast.PipeExpression:
+		e.check(e.meter.Step())
+		function, arguments := node.Call()
+		return e.evalCall(node, function, arguments, env, true)
+	}
+	return e.eval(node, env)
+}
+
+// evalCall evaluates node, which calls function with arguments. In tail
+// position the call is left to the function being evaluated to make.
+func (e *interpreter) evalCall(node ast.Expression, function ast.Expression, arguments []ast.Expression, env *object.Environment, tail bool) object.Object {
+	call, isCall := node.(*ast.CallExpression)
+	inner := e.enterLink()
+	var fn object.Object
+	if isCall {
+		fn = e.evalLinkObject(function, env)
+	} else {
+		fn = e.eval(function, env)
+	}
+	if isAbrupt(fn) {
+		return fn
+	}
+	if fn == skipped || isCall && call.Optional && isNull(fn) {
+		return skip(inner)
+	}
+	args := e.evalExpressions(arguments, env)
+	if len(args) == 1 && isAbrupt(args[0]) {
+		return args[0]
+	}
+	if tail {
+		return &tailCall{node: node, fn: fn, args: args}
+	}
+	return e.call(node, fn, args)
+}
+
+func (e *interpreter) evalTailBranch(block *ast.BlockStatement, env *object.Environment) object.Object {
+	result := e.evalStatements(block.Statements, env, true)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return nativeBoolToBooleanObject(!isTruthy(right))
+	case "-":
+		if right.Type() != object.INTEGER_OBJ {
+			return newError("unknown operator: -%s", right.Type())
+		}
+		return &object.Integer{Value: -right.(*object.Integer).Value}
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalTemplateLiteral evaluates the holes of a template literal from left to
+// right and joins their values, converted as by str, with the text around
+// them.
+func (e *interpreter) evalTemplateLiteral(node *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var out strings.Builder
+	for i, s := range node.Strings {
+		out.WriteString(s)
+		if i < len(node.Expressions) {
+			value := e.eval(node.Expressions[i], env)
+			if isAbrupt(value) {
+				return value
+			}
+			out.WriteString(e.inspect(value))
+		}
+	}
+	return e.alloc(&object.String{Value: out.String()})
+}
+
+// evalHashLiteral evaluates the keys and values of a hash literal in source
+// order before checking that the keys are hashable, as the VM does.
+func (e *interpreter) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	elements := make([]object.Object, 0, 2*len(node.Pairs))
+	for _, pair := range node.Pairs {
+		for _, exp := range []ast.Expression{pair.Key, pair.Value} {
+			evaluated := e.eval(exp, env)
+			if isAbrupt(evaluated) {
+				return evaluated
+			}
+			elements = append(elements, evaluated)
+		}
+	}
+	hash := object.NewHash(len(node.Pairs))
+	for i := 0; i < len(elements); i += 2 {
+		key, ok := elements[i].(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", elements[i].Type())
+		}
+		hash.Set(key, elements[i+1])
+	}
+	return e.alloc(hash)
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(elements)) {
+			return NULL
+		}
+		return elements[i]
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		value, ok := left.(*object.Hash).Get(key)
+		if !ok {
+			return NULL
+		}
+		return value
+	case left.Type() == object.ERROR_OBJ && index.Type() == object.STRING_OBJ:
+		value, ok := left.(*object.ErrorValue).Member(index.(*object.String).Value)
+		if !ok {
+			return NULL
+		}
+		return value
+	default:
+		return newError("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+// evalMemberExpression reads the member name of obj: an export of a module,
+// the value of a hash at the string key name, or a field of an error.
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	switch obj := obj.(type) {
+	case *object.Module:
+		value, ok := obj.Member(name)
+		if !ok {
+			return newError("module %s does not export %s", obj.Path, name)
+		}
+		return value
+	case *object.Hash:
+		value, ok := obj.Get(&object.String{Value: name})
+		if !ok {
+			return newError("hash has no member %s", name)
+		}
+		return value
+	case *object.ErrorValue:
+		value, ok := obj.Member(name)
+		if !ok {
+			return newError("error has no member %s", name)
+		}
+		return value
+	default:
+		return newError("member access not supported: %s.%s", obj.Type(), name)
+	}
+}
+
+func (e *interpreter) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.eval(ie.Condition, env)
+	if isAbrupt(condition) {
+		return condition
+	}
+	if isTruthy(condition) {
+		return e.evalBranch(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return e.evalBranch(ie.Alternative, env)
+	}
+	return NULL
+}
+
+// evalConditionalExpression evaluates `condition ? consequence : alternative`.
+// If tail is set, the expression is in tail position and so is the branch
+// taken.
+func (e *interpreter) evalConditionalExpression(node *ast.ConditionalExpression, env *object.Environment, tail bool) object.Object {
+	condition := e.eval(node.Condition, env)
+	if isAbrupt(condition) {
+		return condition
+	}
+	branch := node.Alternative
+	if isTruthy(condition) {
+		branch = node.Consequence
+	}
+	if tail {
+		return e.evalTail(branch, env)
+	}
+	return e.eval(branch, env)
+}
+
+// evalCoalesceExpression evaluates `left ?? right`, evaluating right only if
+// left is null. If tail is set, the expression is in tail position and so is
+// right.
+func (e *interpreter) evalCoalesceExpression(node *ast.CoalesceExpression, env *object.Environment, tail bool) object.Object {
+	left := e.eval(node.Left, env)
+	if isAbrupt(left) || !isNull(left) {
+		return left
+	}
+	if tail {
+		return e.evalTail(node.Right, env)
+	}
+	return e.eval(node.Right, env)
+}
+
+// evalBranch evaluates a branch of an if expression. A branch that produces
+// no value, such as one ending in a let statement, yields null.
+func (e *interpreter) evalBranch(block *ast.BlockStatement, env *object.Environment) object.Object {
+	result := e.evalBlockStatement(block, env)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// evalTryExpression evaluates a try expression. An error raised by its block
+// is caught by the catch block, whose value then replaces the block's. The
+// finally block runs last, however the others end, and its value is
+// discarded unless it returns or raises an error itself. Exceeded limits
+// unwind past try expressions without running any of their blocks.
+func (e *interpreter) evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := e.evalTryBlock(node.Block, env)
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		// Like a let statement, the catch parameter binds its name in the
+		// enclosing scope.
+		env.Set(node.Parameter.Value, caught(err))
+		result = e.evalTryBlock(node.Catch, env)
+	}
+	if node.Finally != nil {
+		if final := e.evalTryBlock(node.Finally, env); isAbrupt(final) {
+			return final
+		}
+	}
+	return result
+}
+
+// evalTryBlock evaluates a block of a try expression. Calls in the block are
+// not tail calls: a return statement making one makes the call here, so
+// that the try expression sees how it ends.
+func (e *interpreter) evalTryBlock(block *ast.BlockStatement, env *object.Environment) object.Object {
+	result := e.evalBranch(block, env)
+	tc, ok := result.(*tailCall)
+	if !ok {
+		return result
+	}
+	result = e.call(tc.node, tc.fn, tc.args)
+	if isAbrupt(result) {
+		return result
+	}
+	return &object.ReturnValue{Value: result}
+}
+
+// evalMatchExpression evaluates the body of the first arm of node whose
+// pattern matches the subject and whose guard is truthy, in tail position if
+// tail is set. Like a let statement, the arm taken binds the names of its
+// pattern and guard in env. The other arms leave env as it was: each binds
+// its names in an environment of its own, whose bindings are copied to env
+// once the pattern matches and the guard holds. A subject no arm matches
+// raises an error positioned at the match.
+func (e *interpreter) evalMatchExpression(node *ast.MatchExpression, env *object.Environment, tail bool) object.Object {
+	subject := e.eval(node.Subject, env)
+	if isAbrupt(subject) {
+		return subject
+	}
+	for _, arm := range node.Arms {
+		scratch := object.NewEnclosedEnvironment(env)
+		if !e.match(arm.Pattern, subject, scratch) {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := e.eval(arm.Guard, scratch)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		env.SetAll(scratch)
+		if tail {
+			return e.evalTail(arm.Body, env)
+		}
+		return e.eval(arm.Body, env)
+	}
+	err := newError("non-exhaustive match: no arm matches %s", e.inspect(subject))
+	err.Trace = []object.Frame{e.frame(node)}
+	return err
+}
+
+// match reports whether value matches pattern, binding the names of pattern
+// in env as it goes. Names bound before a part of the pattern fails to match
+// stay bound in env.
+func (e *interpreter) match(pattern ast.Pattern, value object.Object, env *object.Environment) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		env.Set(pattern.Value, value)
+		return true
+	case *ast.WildcardPattern:
+		return true
+	case *ast.NullLiteral:
+		return value == NULL
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		v, ok := value.(object.Hashable)
+		return ok && v.HashKey() == literalValue(pattern).HashKey()
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		n := len(pattern.Elements)
+		if !ok || len(array.Elements) < n || pattern.Rest == nil && len(array.Elements) != n {
+			return false
+		}
+		for i, element := range pattern.Elements {
+			if !e.match(element, array.Elements[i], env) {
+				return false
+			}
+		}
+		if pattern.Rest != nil {
+			rest := append([]object.Object{}, array.Elements[n:]...)
+			env.Set(pattern.Rest.Value, e.alloc(&object.Array{Elements: rest}))
+		}
+		return true
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false
+		}
+		values := make([]object.Object, len(pattern.Pairs))
+		for i, pair := range pattern.Pairs {
+			if values[i], ok = hash.Get(patternKey(pair.Key)); !ok {
+				return false
+			}
+		}
+		for i, pair := range pattern.Pairs {
+			if !e.match(pair.Value, values[i], env) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// literalValue returns the value of a literal pattern.
+func literalValue(pattern ast.Pattern) object.Hashable {
+	switch pattern := pattern.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: pattern.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: pattern.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(pattern.Value)
+	}
+	return nil
+}
+
+// throw returns the error raised by throwing value. Throwing an ErrorValue
+// raises the error it was caught from again, with the frames it had gone
+// through then.
+func (e *interpreter) throw(value object.Object) *object.Error {
+	if err, ok := value.(*object.ErrorValue); ok {
+		trace := append([]object.Frame{}, err.Trace...)
+		return &object.Error{Message: err.Message, Err: err.Err, Trace: trace}
+	}
+	message, err := object.UncaughtMessage(value, e.meter)
+	e.check(err)
+	return &object.Error{Message: message, Value: value}
+}
+
+// caught returns the value a catch block receives for err: the thrown value,
+// or the error itself as an ErrorValue.
+func caught(err *object.Error) object.Object {
+	if err.Value != nil {
+		return err.Value
+	}
+	return &object.ErrorValue{Message: err.Message, Err: err.Err, Trace: err.Trace}
+}
+
+// importModule returns the module imported by node. The imported file is
+// evaluated the first time it is imported, in an environment of its own,
+// like the body of a function called from node.
+func (e *interpreter) importModule(node *ast.ImportStatement) object.Object {
+	path := modules.Resolve(e.file, node.Path.Value)
+	if module, ok := e.modules[path]; ok {
+		return module
+	}
+	program, err := e.loader.Enter(path)
+	if err != nil {
+		return newError("%s", err)
+	}
+	defer e.loader.Leave()
+
+	e.check(e.meter.Enter())
+	e.check(e.meter.Alloc(limits.EnvironmentSize(0)))
+	caller, file := e.function, e.file
+	e.function = object.ModuleFunction
+	env := object.NewEnvironment()
+	result := e.evalProgram(program, env)
+	e.function, e.file = caller, file
+	e.meter.Leave()
+	if err, ok := result.(*object.Error); ok {
+		err.Trace = append(err.Trace, e.frame(node))
+		return err
+	}
+
+	module := object.NewModule(path)
+	for _, statement := range program.Statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			for _, name := range export.Statement.Names() {
+				value, _ := env.Get(name.Value)
+				module.Exports.Set(&object.String{Value: name.Value}, value)
+			}
+		}
+	}
+	e.modules[path] = module
+	return e.alloc(module)
+}
+
+// bind binds the names of pattern to the parts of value it matches in env.
+// If value does not have the shape of pattern, bind returns an error
+// positioned at the part of the pattern it does not match.
+func (e *interpreter) bind(pattern ast.Pattern, value object.Object, env *object.Environment) *object.Error {
+	mismatch := func(format string, a ...interface{}) *object.Error {
+		err := newError(format, a...)
+		err.Trace = []object.Frame{e.frame(pattern)}
+		return err
+	}
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		env.Set(pattern.Value, value)
+	case *ast.WildcardPattern:
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return mismatch("cannot destructure %s with an array pattern", value.Type())
+		}
+		n := len(pattern.Elements)
+		if pattern.Rest != nil && len(array.Elements) < n {
+			return mismatch("wrong number of array elements: want>=%d, got=%d", n, len(array.Elements))
+		}
+		if pattern.Rest == nil && len(array.Elements) != n {
+			return mismatch("wrong number of array elements: want=%d, got=%d", n, len(array.Elements))
+		}
+		for i, element := range pattern.Elements {
+			if err := e.bind(element, array.Elements[i], env); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := append([]object.Object{}, array.Elements[n:]...)
+			env.Set(pattern.Rest.Value, e.alloc(&object.Array{Elements: rest}))
+		}
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return mismatch("cannot destructure %s with a hash pattern", value.Type())
+		}
+		// Every key is looked up before any is bound, as in the vm.
+		values := make([]object.Object, len(pattern.Pairs))
+		for i, pair := range pattern.Pairs {
+			key := patternKey(pair.Key)
+			if values[i], ok = hash.Get(key); !ok {
+				return mismatch("hash has no key %s", key.Inspect())
+			}
+		}
+		for i, pair := range pattern.Pairs {
+			if err := e.bind(pair.Value, values[i], env); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// patternKey returns the hash key a key of a hash pattern stands for.
+func patternKey(key ast.Expression) object.Hashable {
+	switch key := key.(type) {
+	case *ast.Identifier:
+		return &object.String{Value: key.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: key.Value}
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: key.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(key.Value)
+	}
+	return nil
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
+		return builtin
+	}
+	return newError("identifier not found: " + node.Value)
+}
+
+// evalExpressions evaluates exps from left to right, putting the elements of
+// a spread array in place of the spread. If one of them fails it returns only
+// that error.
+func (e *interpreter) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+	for _, exp := range exps {
+		spread, ok := exp.(*ast.SpreadElement)
+		if ok {
+			exp = spread.Value
+		}
+		evaluated := e.eval(exp, env)
+		if isAbrupt(evaluated) {
+			return []object.Object{evaluated}
+		}
+		if !ok {
+			result = append(result, evaluated)
+			continue
+		}
+		array, isArray := evaluated.(*object.Array)
+		if !isArray {
+			err := newError("cannot spread %s", evaluated.Type())
+			err.Trace = []object.Frame{e.frame(spread)}
+			return []object.Object{err}
+		}
+		result = append(result, array.Elements...)
+	}
+	return result
+}
+
+// call calls fn from node. An error the call fails with is given the frame
+// of the calling function.
+func (e *interpreter) call(node ast.Expression, fn object.Object, args []object.Object) object.Object {
+	result := e.applyFunction(fn, args)
+	if err, ok := result.(*object.Error); ok {
+		err.Trace = append(err.Trace, e.frame(node))
+	}
+	return result
+}
+
+// applyFunction calls fn. Tail calls made by the function are made here in
+// turn, so that tail recursion runs in constant Go stack space and counts
+// as a single level of call depth. A function making a tail call is left
+// out of the stack traces of errors raised by the call.
+func (e *interpreter) applyFunction(fn object.Object, args []object.Object) object.Object {
+	entered := false
+	caller, file := e.function, e.file
+	defer func() {
+		e.function, e.file = caller, file
+		if entered {
+			e.meter.Leave()
+		}
+	}()
+	// site is the tail call being made, whose failure to call fn is raised
+	// in the function making it.
+	var site ast.Expression
+	fail := func(err *object.Error) object.Object {
+		if site != nil {
+			err.Trace = append(err.Trace, e.frame(site))
+		}
+		return err
+	}
+	for {
+		if builtin, ok := fn.(*object.Builtin); ok {
+			switch result := e.callBuiltin(builtin, args).(type) {
+			case nil:
+				return NULL
+			case *object.Error:
+				return fail(result)
+			default:
+				return e.alloc(result)
+			}
+		}
+		function, ok := fn.(*object.Function)
+		if !ok {
+			return fail(newError("not a function: %s", fn.Type()))
+		}
+		required := len(function.Parameters)
+		for required > 0 && function.Parameters[required-1].Default != nil {
+			required--
+		}
+		if len(args) < required || len(args) > len(function.Parameters) && function.Rest == nil {
+			return fail(newError("%s", object.ArityMessage(function.Name, len(function.Parameters),
+				len(function.Parameters)-required, function.Rest != nil, len(args))))
+		}
+		if !entered {
+			e.check(e.meter.Enter())
+			entered = true
+		}
+		e.function, e.file = function.Name, function.File
+		if e.function == "" {
+			e.function = object.AnonymousFunction
+		}
+		extendedEnv, evaluated := e.extendFunctionEnv(function, args)
+		if evaluated == nil {
+			evaluated = e.evalStatements(function.Body.Statements, extendedEnv, true)
+		}
+		tc, ok := evaluated.(*tailCall)
+		if !ok {
+			return unwrapReturnValue(evaluated)
+		}
+		site, fn, args = tc.node, tc.fn, tc.args
+	}
+}
+
+// extendFunctionEnv binds the parameters of fn to args in a new environment.
+// Extra arguments are bound to the rest parameter as an array, and missing
+// ones to their defaults, evaluated from left to right in the new
+// environment, where the parameters after them are still null. If evaluating
+// a default ends abruptly, that result is returned too.
+func (e *interpreter) extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
+	size := len(fn.Parameters)
+	if fn.Rest != nil {
+		size++
+	}
+	e.check(e.meter.Alloc(limits.EnvironmentSize(size)))
+	env := object.NewEnclosedEnvironment(fn.Env)
+	for i, param := range fn.Parameters {
+		if i < len(args) {
+			env.Set(param.Name.Value, args[i])
+		} else {
+			env.Set(param.Name.Value, NULL)
+		}
+	}
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, e.alloc(&object.Array{Elements: rest}))
+	}
+	for _, param := range fn.Parameters {
+		if len(args) > 0 {
+			args = args[1:]
+			continue
+		}
+		value := e.eval(param.Default, env)
+		if isAbrupt(value) {
+			return env, value
+		}
+		env.Set(param.Name.Value, value)
+	}
+	return env, nil
+}
+
+// unwrapReturnValue turns the result of a function body into the value of
+// the call. A body producing no value returns null.
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	if obj == nil {
+		return NULL
+	}
+	return obj
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+// enterLink starts the evaluation of a member access, index or call and
+// reports whether it is a link inside a longer chain rather than the last.
+func (e *interpreter) enterLink() bool {
+	inner := e.link
+	e.link = false
+	return inner
+}
+
+// evalLinkObject evaluates the value a member access, index or call applies
+// to. If that is an earlier link of the same chain cut short by an optional
+// link finding null, it is skipped, and the rest of the chain is skipped too.
+func (e *interpreter) evalLinkObject(node ast.Expression, env *object.Environment) object.Object {
+	switch node.(type) {
+	case *ast.MemberExpression, *ast.IndexExpression, *ast.CallExpression:
+		e.link = true
+	}
+	return e.eval(node, env)
+}
+
+// skip returns the value of a chain link that is skipped: skipped for the
+// next link if inner is set, or null at the end of the chain.
+func skip(inner bool) object.Object {
+	if inner {
+		return skipped
+	}
+	return NULL
+}
+
+// isNull reports whether obj is null, which `??` and `?.` test for.
+func isNull(obj object.Object) bool {
+	return obj.Type() == object.NULL_OBJ
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// isAbrupt reports whether obj ends the evaluation of the statement producing
+// it: an error, a value being returned or a pending tail call.
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue, *tailCall:
+		return true
+	}
+	return false
+}
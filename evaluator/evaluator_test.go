@@ -0,0 +1,515 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/limits"
+	"github.com/kellemNegasi/monkeylang/object"
+	"github.com/kellemNegasi/monkeylang/parser"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * (5 + 10)", 30},
+		{"50 / 2 * 2 + 10", 60},
+		{"0x1f + 0b1", 32},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"(1 < 2) == true", true},
+		{"!5", false},
+		{"!!false", false},
+		{`"a" != "b"`, true},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (true) { let x = 1; }", nil},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("%q: object is not NULL. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{"foobar", "identifier not found: foobar"},
+		{"1 / 0", "division by zero"},
+		{"5(1)", "not a function: INTEGER"},
+		{"fn(x) { x }()", "wrong number of arguments to <anonymous>: want=1, got=0"},
+		{"let f = fn(x, y = 1) { x }; f(1, 2, 3)", "wrong number of arguments to f: want=1..2, got=3"},
+		{"let f = fn(x, ...y) { x }; f(...[])", "wrong number of arguments to f: want=1+, got=0"},
+		{"[1, ...true]", "cannot spread BOOLEAN"},
+		{"1[0]", "index operator not supported: INTEGER[INTEGER]"},
+		{`[1]["a"]`, "index operator not supported: ARRAY[STRING]"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 1}`, "unusable as hash key: ARRAY"},
+		{`{[1]: 1, "a": -true}`, "unknown operator: -BOOLEAN"},
+		{"len(1)", "argument 1 to len must be STRING, ARRAY or HASH, got INTEGER"},
+		{"len()", "wrong number of arguments to len: want=1, got=0"},
+		{"first(1)", "argument 1 to first must be ARRAY, got INTEGER"},
+		{"push([])", "wrong number of arguments to push: want=2, got=1"},
+		{"type(1, 2)", "wrong number of arguments to type: want=1, got=2"},
+		{`{"name": "Monkey"}.age`, "hash has no member age"},
+		{`{1: "one"}.one`, "hash has no member one"},
+		{`try { 1 / 0 } catch (e) { e.code }`, "error has no member code"},
+		{`[1, 2].len`, "member access not supported: ARRAY.len"},
+		{"let [a, b] = [1];", "wrong number of array elements: want=2, got=1"},
+		{"let [a, ...b] = [];", "wrong number of array elements: want>=1, got=0"},
+		{`let {a} = "a";`, "cannot destructure STRING with a hash pattern"},
+		{`let {a, b} = {"a": [1]}; a`, "hash has no key b"},
+		{`match ([1, 2]) { [a] => a, [a, b, c, ...d] => d }`, "non-exhaustive match: no arm matches [1, 2]"},
+		{`throw "boom";`, "uncaught exception: boom"},
+		{"try { 1 / 0 } finally { 1 }", "division by zero"},
+		{"try { 1 } catch (e) { 2 }; e", "identifier not found: e"},
+	}
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T", tt.input, testEval(tt.input))
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+// TestNullishOperators also checks that the operators short-circuit: the
+// divisions by zero are never evaluated.
+func TestNullishOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null", nil},
+		{"true ? 1 : 1 / 0", 1},
+		{"false ? 1 / 0 : 2", 2},
+		{"null ? 1 : 2", 2},
+		{"1 ?? 1 / 0", 1},
+		{"null ?? null ?? 3", 3},
+		{`let h = {"a": {"b": [5]}}; h?.a?.b?.[0]`, 5},
+		{`let h = {"a": null}; h.a?.b`, nil},
+		{`let h = {"a": null}; h.a?.[1 / 0]`, nil},
+		{`let h = {"a": null}; h.a?.(1 / 0)`, nil},
+		{`let h = {"f": fn(x) { x * 2 }}; h.f?.(4)`, 8},
+		{"let h = null; h?.a.b.c", nil},
+		{"let h = null; h?.a(1)[0]", nil},
+		{`let h = {"a": [fn(x) { [x] }]}; h?.a[0](7)[0]`, 7},
+		{"let h = null; let f = fn(x) { [x] }; f(h?.a.b)[0] ?? 3", 3},
+		{"let g = fn(h) { h?.a.b(1) }; g(null)", nil},
+		{"let f = fn(n, acc) { n == 0 ? acc : f(n - 1, (acc ?? 0) + 1) }; f(5000, null)", 5000},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("%q: object is not NULL. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 1; 2 } catch (e) { e + 10 }", 11},
+		{`try { 1 / 0 } catch (e) { len(e["message"]) }`, 16},
+		{"let f = fn(n) { try { return n; } finally { 0 } }; f(3)", 3},
+		{"let f = fn() { try { return 1; } finally { return 2; } }; f()", 2},
+		{"try { try { throw 1; } finally { 5 } } catch (e) { e }", 1},
+		{"try { try { throw 1; } catch (e) { throw e + 1; } } catch (e) { e }", 2},
+		{"let f = fn(n) { if (n == 0) { throw n; } try { f(n - 1) } catch (e) { throw e + 1; } }; try { f(5) } catch (e) { e }", 5},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("let f = fn() { 1 + f() }; try { f() } catch (e) { 0 }")
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "stack overflow: call depth limit of 1024 exceeded" {
+		t.Errorf("limit error was caught. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let double = fn(x) { return x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let adder = fn(x) { fn(y) { x + y } }; adder(2)(3)", 5},
+		{"let f = fn(a, b = a + 1) { a * b }; f(2) + f(2, 5)", 16},
+		{"let f = fn(a, ...b) { len(b) + a }; f(10, 1, 2)", 12},
+		{"let f = fn(a, b) { a - b }; f(...[5, 2])", 3},
+		{"let f = fn(a = b, b = 2) { if (a) { 0 } else { b } }; f()", 2},
+		{"let f = (a, b) => a - b; 10 |> f(3) |> f(2)", 5},
+		{"let add = (a) => (b) => a + b; 2 |> add(3)()", 5},
+		{"[1, 2, 3] |> (xs) => len(xs) |> (n) => n * 2", 6},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+// TestTailRecursion runs a million-deep tail recursion with a Go stack too
+// small for one nested Go call per Monkey call.
+func TestTailRecursion(t *testing.T) {
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let countDown = fn(n) { if (n == 0) { 0 } else { countDown(n - 1) } }; countDown(1000000)", 0},
+		{"let countDown = fn(n) { if (n > 0) { return countDown(n - 1); } n }; countDown(1000000)", 0},
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(1000000, 0)", 1000000},
+		{"let count = (n) => if (n == 0) { 0 } else { n - 1 |> count }; count(1000000)", 0},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	evaluated := testEval("[1, 2 * 2, 3 + 3]")
+	array, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("array has wrong number of elements. got=%d", len(array.Elements))
+	}
+	testIntegerObject(t, array.Elements[0], 1)
+	testIntegerObject(t, array.Elements[1], 4)
+	testIntegerObject(t, array.Elements[2], 6)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1 + 1]", 3},
+		{"let i = 0; [1][i]", 1},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2]", 6},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("%q: object is not NULL. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+	hash, ok := testEval(input).(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T", testEval(input))
+	}
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+	if hash.Len() != len(expected) {
+		t.Fatalf("hash has wrong number of pairs. got=%d", hash.Len())
+	}
+	for i, pair := range hash.Pairs() {
+		if pair.Key.HashKey() != expected[i].key.HashKey() {
+			t.Errorf("pair %d has key %s, want %s", i, pair.Key.Inspect(), expected[i].key.Inspect())
+		}
+		testIntegerObject(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{"5": 5}[5]`, nil},
+		{`{true: 5}[true]`, 5},
+		{`{1: 5}[true]`, nil},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("%q: object is not NULL. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len("four")`, "4"},
+		{`len([1, [2, 3]])`, "2"},
+		{`first([1, 2, 3])`, "1"},
+		{`first([])`, "null"},
+		{`last([1, 2, 3])`, "3"},
+		{`rest([1, 2, 3])`, "[2, 3]"},
+		{`rest([1])`, "[]"},
+		{`let a = [1]; let b = push(a, 2); [a, b]`, "[[1], [1, 2]]"},
+		{`let a = [1, 2]; rest(a); a`, "[1, 2]"},
+		{`type(true)`, "BOOLEAN"},
+		{`type(fn(x) { x })`, "FUNCTION"},
+		{`str(12) + "!"`, "12!"},
+		{`str("s")`, "s"},
+		{`puts("hello", 1, [2])`, "null"},
+	}
+	var out bytes.Buffer
+	defer func(w io.Writer) { object.Output = w }(object.Output)
+	object.Output = &out
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+	if out.String() != "hello\n1\n[2]\n" {
+		t.Errorf("puts wrote %q", out.String())
+	}
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"`plain`", "plain"},
+		{"``", ""},
+		{"let x = 2; `${x} + ${x} = ${x + x}`", "2 + 2 = 4"},
+		{"`${[1, \"a\"]}${null}${true}`", "[1, a]nulltrue"},
+		{"let f = fn(n) { `<${n}>` }; `${f(`${f(1)}`)}`", "<<1>>"},
+		{"`${ {\"}\": `}`}[\"}\"] }`", "}"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%q: wrong value. want=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	evaluated := testEval(`"Hello" + " " + "World!"`)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	input := `let inner = fn(x) { x + true };
+let alias = inner;
+let outer = fn(x) { let y = alias(x); y };
+outer(1);`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	program.File = "lib.mk"
+	failure, ok := Eval(program, object.NewEnvironment()).(*object.Error)
+	if !ok {
+		t.Fatalf("no error")
+	}
+	// Functions are named by the let statement defining them, not by the
+	// names they are called by.
+	expected := []object.Frame{
+		{Function: "inner", File: "lib.mk", Line: 1, Column: 23},
+		{Function: "outer", File: "lib.mk", Line: 3, Column: 34},
+		{Function: object.MainFunction, File: "lib.mk", Line: 4, Column: 6},
+	}
+	if !reflect.DeepEqual(failure.Trace, expected) {
+		t.Errorf("wrong trace.\nwant=%v\ngot= %v", expected, failure.Trace)
+	}
+
+	if failure := testEval("let f = fn() { 1 + f() }; f()").(*object.Error); failure.Trace != nil {
+		t.Errorf("limit error has a trace: %v", failure.Trace)
+	}
+}
+
+func testEval(input string) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	return Eval(program, object.NewEnvironment())
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. want=%d, got=%d", expected, result.Value)
+	}
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) {
+	t.Helper()
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. want=%t, got=%t", expected, result.Value)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	loop := "let f = fn(n) { f(n + 1) }; f(0)"
+	// d(1, 40) is an array nesting 2^40 ones, built in 40 steps.
+	doubled := "let d = fn(a, n) { if (n == 0) { a } else { d([a, a], n - 1) } }; "
+	tests := []struct {
+		input    string
+		config   limits.Config
+		expected error
+	}{
+		{loop, limits.Config{MaxSteps: 1000}, &limits.StepError{Limit: 1000}},
+		{"let f = fn(n) { 1 + f(n) }; f(0)", limits.Config{MaxDepth: 10}, &limits.DepthError{Limit: 10}},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(3000)", limits.Config{MaxDepth: 5000}, nil},
+		{`let f = fn(s) { f(s + s) }; f("ab")`, limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{`let f = fn(s) { f(str([s, s])) }; f("a")`, limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{`let f = fn(xs) { f(push(xs, xs)) }; f([])`, limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "str(d(1, 40))", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "puts(d(1, 40))", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "`${d(1, 40)}`", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "try { throw d(1, 40) } catch (e) { 0 }", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "match (d(1, 40)) { 0 => 0 }", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{`let f = fn(s) { if (len(s) > 100) { s } else { f(s + s) } }; len(f("ab"))`, limits.Config{MaxAlloc: 1 << 20}, nil},
+	}
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		_, err := EvalContext(context.Background(), program, object.NewEnvironment(), tt.config)
+		if !reflect.DeepEqual(err, tt.expected) {
+			t.Errorf("wrong error for %q. want=%v, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	for _, input := range []string{loop, doubled + "str(d(1, 40))"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		program := parser.New(lexer.New(input)).ParseProgram()
+		_, err := EvalContext(ctx, program, object.NewEnvironment(), limits.Config{})
+		cancel()
+		var canceled *limits.CanceledError
+		if !errors.As(err, &canceled) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("wrong error for a timed out evaluation of %q: %v", input, err)
+		}
+	}
+
+	// The Go stack cannot hold millions of nested calls.
+	program := parser.New(lexer.New("let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(3000000)")).ParseProgram()
+	_, err := EvalContext(context.Background(), program, object.NewEnvironment(), limits.Config{MaxDepth: 10000000})
+	var depth *limits.DepthError
+	if !errors.As(err, &depth) || depth.Limit < 10000 || depth.Limit >= 3000000 {
+		t.Errorf("wrong error for calls nesting deeper than the Go stack holds: %v", err)
+	}
+
+	evaluated := testEval("let f = fn(n) { 1 + f(n) }; f(0)")
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "stack overflow: call depth limit of 1024 exceeded" {
+		t.Errorf("Eval does not apply the default depth limit. got=%T (%+v)", evaluated, evaluated)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kellemNegasi/monkeylang/format"
+)
+
+// fmtMain implements `monkey fmt [-w | -d] [files]`. Without files it formats
+// standard input to standard output.
+func fmtMain(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey fmt [-w | -d] [files]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *write && *diff {
+		fmt.Fprintln(os.Stderr, "monkey fmt: -w and -d are mutually exclusive")
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "monkey fmt: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey fmt: %v\n", err)
+			return 1
+		}
+		if err := formatFile("<standard input>", src, *diff, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "monkey fmt: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err == nil {
+			if *write {
+				err = writeFormatted(path, src)
+			} else {
+				err = formatFile(path, src, *diff, os.Stdout)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey fmt: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// formatFile writes the formatted source, or its diff against src, to out.
+func formatFile(name string, src []byte, diff bool, out io.Writer) error {
+	res, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if !diff {
+		_, err = out.Write(res)
+		return err
+	}
+	if !bytes.Equal(src, res) {
+		_, err = io.WriteString(out, unifiedDiff(name, src, res))
+	}
+	return err
+}
+
+// writeFormatted rewrites the file at path if formatting changes it.
+func writeFormatted(path string, src []byte) error {
+	res, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, res, info.Mode().Perm())
+}
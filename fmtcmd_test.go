@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFmtWrite(t *testing.T) {
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.mk")
+	tidy := filepath.Join(dir, "tidy.mk")
+	if err := os.WriteFile(messy, []byte("let x=1"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tidy, []byte("let y = 2;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if status := fmtMain([]string{"-w", messy, tidy}); status != 0 {
+		t.Fatalf("fmt -w failed with status %d", status)
+	}
+	for path, expected := range map[string]string{messy: "let x = 1;\n", tidy: "let y = 2;\n"} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected {
+			t.Errorf("%s: wrong contents. want=%q, got=%q", filepath.Base(path), expected, got)
+		}
+	}
+	info, err := os.Stat(messy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("fmt -w changed the permissions of the file to %v", info.Mode().Perm())
+	}
+}
+
+func TestFmtDiff(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"let x=1;\nlet y = 2;\n", "--- a.mk\n+++ a.mk\n@@ -1,2 +1,2 @@\n-let x=1;\n+let x = 1;\n let y = 2;\n"},
+		{"let x = 1;\n", ""},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := formatFile("a.mk", []byte(tt.src), true, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong diff of %q.\nwant=%q\ngot= %q", tt.src, tt.expected, out.String())
+		}
+	}
+}
+
+func TestFmtUsageErrors(t *testing.T) {
+	for _, args := range [][]string{{"-w", "-d", "a.mk"}, {"-w"}} {
+		if status := fmtMain(args); status != 2 {
+			t.Errorf("fmt %q: wrong status. want=2, got=%d", args, status)
+		}
+	}
+}
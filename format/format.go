@@ -0,0 +1,705 @@
+// Package format implements canonical formatting of Monkey source code.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/parser"
+	"github.com/kellemNegasi/monkeylang/token"
+)
+
+// MaxWidth is the line width above which the arguments of a call or the
+// elements of an array or hash are put on separate lines.
+const MaxWidth = 80
+
+// tabWidth is the width of an indentation level when measuring lines.
+const tabWidth = 4
+
+// atomic is the precedence of expressions that never need parentheses.
+const atomic = parser.CALL + 1
+
+// Source formats Monkey source code, keeping its comments. The result is
+// canonical: formatting it again yields the same bytes.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := &printer{span: p.Span}
+	l := lexer.New(string(src))
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		pr.tokens = append(pr.tokens, tok)
+	}
+	pr.comments = l.Comments()
+	pr.matchBraces()
+	pr.program(program)
+	return pr.buf.Bytes(), nil
+}
+
+// Node writes the canonical form of node to w. Comments are not part of the
+// tree, so none are written.
+func Node(w io.Writer, node ast.Node) error {
+	pr := &printer{}
+	switch n := node.(type) {
+	case *ast.Program:
+		pr.program(n)
+	case ast.Statement:
+		pr.statement(n)
+	case ast.Expression:
+		pr.expression(n, parser.LOWEST)
+	}
+	_, err := w.Write(pr.buf.Bytes())
+	return err
+}
+
+// pos is a position in the source.
+type pos struct {
+	line, column int
+}
+
+func posOf(t token.Token) pos { return pos{t.Line, t.Column} }
+
+func (a pos) before(b pos) bool {
+	return a.line < b.line || a.line == b.line && a.column < b.column
+}
+
+// eof is a position after any source position.
+var eof = pos{line: int(^uint(0) >> 1)}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+	column int  // column of the next byte written, in tabWidth units for tabs
+	flat   bool // never break lines, used to measure expressions
+
+	tokens   []token.Token // all non-comment tokens of the source
+	comments []token.Token // comments not yet printed
+	closing  map[pos]pos   // position of each `{` to its matching `}`
+	lastLine int           // source line of the last printed item, 0 at block start
+
+	// span returns the tokens a node was parsed from. It is nil when the
+	// source is not known.
+	span func(ast.Node) (parser.Span, bool)
+
+	// guard is set while printing a match guard, where `(x) =>` would start
+	// the arm's body, so arrow functions keep their parentheses.
+	guard bool
+}
+
+// matchBraces records the closing brace of every opening brace.
+func (p *printer) matchBraces() {
+	p.closing = map[pos]pos{}
+	var open []pos
+	for _, tok := range p.tokens {
+		switch tok.Type {
+		case token.LBRACE:
+			open = append(open, posOf(tok))
+		case token.RBRACE:
+			if len(open) > 0 {
+				p.closing[open[len(open)-1]] = posOf(tok)
+				open = open[:len(open)-1]
+			}
+		}
+	}
+}
+
+// lineBefore returns the line of the last token located before at.
+func (p *printer) lineBefore(at pos) int {
+	i := sort.Search(len(p.tokens), func(i int) bool { return !posOf(p.tokens[i]).before(at) })
+	if i == 0 {
+		return 0
+	}
+	return p.tokens[i-1].Line
+}
+
+func (p *printer) write(s string) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\n':
+			p.column = 0
+		case '\t':
+			p.column += tabWidth
+		default:
+			p.column++
+		}
+	}
+	p.buf.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.write("\n")
+	p.write(strings.Repeat("\t", p.indent))
+}
+
+// separate writes a blank line before an item at the given source line if the
+// source had one there.
+func (p *printer) separate(line int) {
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.write("\n")
+	}
+	if line > 0 {
+		p.lastLine = line
+	}
+}
+
+// leadingComments prints, each on its own line, the comments located before at.
+func (p *printer) leadingComments(at pos) {
+	for len(p.comments) > 0 && posOf(p.comments[0]).before(at) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		p.separate(c.Line)
+		p.write(strings.Repeat("\t", p.indent) + c.Literal + "\n")
+	}
+}
+
+// bounds returns the positions of the first token of first and of the last
+// token of last. It reports false when the source is not known.
+func (p *printer) bounds(first, last ast.Node) (start, end pos, ok bool) {
+	if p.span == nil {
+		return pos{}, pos{}, false
+	}
+	a, ok := p.span(first)
+	b, ok2 := p.span(last)
+	return posOf(a.Start), posOf(b.End), ok && ok2
+}
+
+// holdsComment reports whether a comment not printed yet lies inside node,
+// after its first token.
+func (p *printer) holdsComment(node ast.Node) bool {
+	start, end, ok := p.bounds(node, node)
+	if !ok {
+		return false
+	}
+	for _, c := range p.comments {
+		if at := posOf(c); start.before(at) && at.before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// itemComments prints, each on a line of its own, the comments located
+// before at. They precede an item of a list or match printed one per line.
+func (p *printer) itemComments(at pos) {
+	for len(p.comments) > 0 && posOf(p.comments[0]).before(at) {
+		p.newline()
+		p.write(p.comments[0].Literal)
+		p.comments = p.comments[1:]
+	}
+}
+
+// itemComment prints a comment placed after the code on line, the source line
+// an item of a list or match ended on, and before next.
+func (p *printer) itemComment(line int, next pos) {
+	if len(p.comments) > 0 && p.comments[0].Line == line && posOf(p.comments[0]).before(next) {
+		p.write(" " + p.comments[0].Literal)
+		p.comments = p.comments[1:]
+	}
+}
+
+// trailingComment prints a comment placed after the code on the source line
+// the previous statement ended on.
+func (p *printer) trailingComment(next pos) {
+	if len(p.comments) == 0 {
+		return
+	}
+	c := p.comments[0]
+	if c.Line == p.lastLine && posOf(c).before(next) {
+		p.comments = p.comments[1:]
+		p.write(" " + c.Literal)
+	}
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.statements(program.Statements, eof)
+}
+
+// statements prints a list of statements, one per line, followed by the
+// comments located before end.
+func (p *printer) statements(list []ast.Statement, end pos) {
+	for i, s := range list {
+		start := statementPos(s)
+		p.leadingComments(start)
+		p.separate(start.line)
+		p.write(strings.Repeat("\t", p.indent))
+		p.statement(s)
+
+		next := end
+		if i+1 < len(list) {
+			next = statementPos(list[i+1])
+		}
+		if p.tokens != nil {
+			p.lastLine = p.lineBefore(next)
+		}
+		p.trailingComment(next)
+		p.write("\n")
+	}
+	p.leadingComments(end)
+}
+
+func statementPos(s ast.Statement) pos {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		return posOf(s.Token)
+	case *ast.ReturnStatement:
+		return posOf(s.Token)
+	case *ast.ThrowStatement:
+		return posOf(s.Token)
+	case *ast.ImportStatement:
+		return posOf(s.Token)
+	case *ast.ExportStatement:
+		return posOf(s.Token)
+	case *ast.ExpressionStatement:
+		return posOf(s.Token)
+	case *ast.BlockStatement:
+		return posOf(s.Token)
+	}
+	return pos{}
+}
+
+func (p *printer) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.write("let ")
+		if s.Pattern != nil {
+			p.pattern(s.Pattern)
+		} else {
+			p.write(s.Name.Value)
+		}
+		p.write(" = ")
+		p.expression(s.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ImportStatement:
+		p.write("import " + quote(s.Path.Value) + " as " + s.Name.Value + ";")
+	case *ast.ExportStatement:
+		p.write("export ")
+		p.statement(s.Statement)
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.ReturnValue != nil {
+			p.write(" ")
+			p.expression(s.ReturnValue, parser.LOWEST)
+		}
+		p.write(";")
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(s.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, parser.LOWEST)
+		switch s.Expression.(type) {
+		case *ast.IfExpression, *ast.TryExpression:
+		default:
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(s)
+	}
+}
+
+// block prints a braced block. Its statements are indented one level deeper
+// than the line holding the opening brace.
+func (p *printer) block(b *ast.BlockStatement) {
+	end := p.closing[posOf(b.Token)]
+	if len(b.Statements) == 0 && (len(p.comments) == 0 || !posOf(p.comments[0]).before(end)) {
+		p.write("{}")
+		return
+	}
+	p.write("{\n")
+	p.indent++
+	p.lastLine = 0
+	p.statements(b.Statements, end)
+	p.indent--
+	p.write(strings.Repeat("\t", p.indent) + "}")
+	if end.line > 0 {
+		p.lastLine = end.line
+	}
+}
+
+// precedence returns the binding power of e as the parser sees it.
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(e.Operator))
+	case *ast.PipeExpression:
+		return parser.PIPE
+	case *ast.ConditionalExpression:
+		return parser.CONDITIONAL
+	case *ast.CoalesceExpression:
+		return parser.COALESCE
+	case *ast.FunctionLiteral:
+		if e.Arrow {
+			// The body of an arrow function extends as far right as it
+			// can, up to a pipe.
+			return parser.PIPE
+		}
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression, *ast.MemberExpression:
+		return parser.INDEX
+	}
+	return atomic
+}
+
+// expression prints e, wrapping it in parentheses if it binds less tightly
+// than prec requires.
+func (p *printer) expression(e ast.Expression, prec int) {
+	fn, arrow := e.(*ast.FunctionLiteral)
+	if precedence(e) < prec || arrow && fn.Arrow && p.guard {
+		guard := p.guard
+		p.guard = false
+		p.write("(")
+		p.expression(e, parser.LOWEST)
+		p.write(")")
+		p.guard = guard
+		return
+	}
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+	case *ast.IntegerLiteral:
+		if e.Token.Literal != "" {
+			p.write(e.Token.Literal)
+		} else {
+			p.write(strconv.FormatInt(e.Value, 10))
+		}
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(e.Value))
+	case *ast.NullLiteral:
+		p.write("null")
+	case *ast.StringLiteral:
+		p.write(quote(e.Value))
+	case *ast.TemplateLiteral:
+		p.write("`")
+		for i, s := range e.Strings {
+			p.write(templateText.Replace(s))
+			if i < len(e.Expressions) {
+				p.write("${")
+				p.expression(e.Expressions[i], parser.LOWEST)
+				p.write("}")
+			}
+		}
+		p.write("`")
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		if e.Operator == "-" && negative(e.Right) {
+			// `--x` would read as a decrement.
+			p.write(" ")
+		}
+		p.expression(e.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := precedence(e)
+		p.expression(e.Left, prec)
+		p.write(" " + e.Operator + " ")
+		p.expression(e.Right, prec+1)
+	case *ast.PipeExpression:
+		left := parser.PIPE
+		if fn, ok := e.Left.(*ast.FunctionLiteral); ok && fn.Arrow {
+			// An arrow function piped into something reads as if the
+			// pipe were part of its body, so keep it parenthesised.
+			left = parser.PIPE + 1
+		}
+		p.expression(e.Left, left)
+		p.write(" |> ")
+		p.last(e.Right, parser.PIPE+1)
+	case *ast.ConditionalExpression:
+		// Conditionals associate to the right, so only a conditional
+		// condition needs parentheses. An arrow function alternative gets
+		// them too, since a pipe after it would apply to the whole
+		// conditional rather than to the function's body.
+		p.expression(e.Condition, parser.CONDITIONAL+1)
+		p.write(" ? ")
+		p.expression(e.Consequence, parser.LOWEST)
+		p.write(" : ")
+		p.expression(e.Alternative, parser.CONDITIONAL)
+	case *ast.CoalesceExpression:
+		p.expression(e.Left, parser.COALESCE)
+		p.write(" ?? ")
+		p.expression(e.Right, parser.COALESCE+1)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(e.Block)
+		if e.Catch != nil {
+			p.write(" catch (" + e.Parameter.Value + ") ")
+			p.block(e.Catch)
+		}
+		if e.Finally != nil {
+			p.write(" finally ")
+			p.block(e.Finally)
+		}
+	case *ast.MatchExpression:
+		// Arms are printed one per line, each followed by a comma.
+		p.write("match (")
+		p.expression(e.Subject, parser.LOWEST)
+		p.write(") {")
+		if len(e.Arms) == 0 {
+			p.write("}")
+			break
+		}
+		_, end, _ := p.bounds(e, e)
+		p.indent++
+		for i, arm := range e.Arms {
+			start, armEnd, _ := p.bounds(arm.Pattern, arm.Body)
+			p.itemComments(start)
+			p.newline()
+			p.pattern(arm.Pattern)
+			if arm.Guard != nil {
+				p.write(" if ")
+				p.guard = true
+				p.expression(arm.Guard, parser.LOWEST)
+				p.guard = false
+			}
+			p.write(" => ")
+			p.expression(arm.Body, parser.LOWEST)
+			p.write(",")
+			next := end
+			if i+1 < len(e.Arms) {
+				next, _, _ = p.bounds(e.Arms[i+1].Pattern, e.Arms[i+1].Pattern)
+			}
+			p.itemComment(armEnd.line, next)
+		}
+		p.itemComments(end)
+		p.indent--
+		p.newline()
+		p.write("}")
+	case *ast.FunctionLiteral:
+		if e.Arrow {
+			p.write("(")
+		} else {
+			p.write("fn(")
+		}
+		for i, param := range e.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(param.Name.Value)
+			if param.Default != nil {
+				p.write(" = ")
+				p.expression(param.Default, parser.LOWEST)
+			}
+		}
+		if e.Rest != nil {
+			if len(e.Parameters) > 0 {
+				p.write(", ")
+			}
+			p.write("..." + e.Rest.Value)
+		}
+		if e.Arrow {
+			p.write(") => ")
+			body := e.Body.Statements[0].(*ast.ExpressionStatement)
+			p.last(body.Expression, parser.PIPE+1)
+			break
+		}
+		p.write(") ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.expression(e.Function, parser.CALL)
+		if e.Optional {
+			p.write("?.")
+		}
+		p.list(e, "(", ")", e.Arguments)
+	case *ast.ArrayLiteral:
+		p.list(e, "[", "]", e.Elements)
+	case *ast.SpreadElement:
+		p.write("...")
+		p.expression(e.Value, parser.LOWEST)
+	case *ast.HashLiteral:
+		p.hash(e, e.Pairs)
+	case *ast.IndexExpression:
+		// Calls and index expressions chain from left to right, so either
+		// can be indexed without parentheses.
+		p.expression(e.Left, parser.CALL)
+		if e.Optional {
+			p.write("?.")
+		}
+		p.write("[")
+		p.expression(e.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.MemberExpression:
+		p.expression(e.Object, parser.CALL)
+		if e.Optional {
+			p.write("?")
+		}
+		p.write("." + e.Member.Value)
+	}
+}
+
+// last prints e like expression, where e ends the right operand of a pipe or
+// the body of an arrow function, which nothing but a pipe can follow. An arrow
+// function needs no parentheses there, since its body stops at a pipe.
+func (p *printer) last(e ast.Expression, prec int) {
+	if fn, ok := e.(*ast.FunctionLiteral); ok && fn.Arrow {
+		prec = parser.PIPE
+	}
+	p.expression(e, prec)
+}
+
+// list prints a list of expressions such as call arguments between open and
+// close. node is the call or array holding the list.
+func (p *printer) list(node ast.Node, open, close string, args []ast.Expression) {
+	bounds := func(i int) (ast.Node, ast.Node) { return args[i], args[i] }
+	p.items(node, open, close, len(args), bounds, func(p *printer, i int) {
+		p.expression(args[i], parser.LOWEST)
+	})
+}
+
+// hash prints the pairs of a hash literal.
+func (p *printer) hash(node *ast.HashLiteral, pairs []ast.HashPair) {
+	bounds := func(i int) (ast.Node, ast.Node) { return pairs[i].Key, pairs[i].Value }
+	p.items(node, "{", "}", len(pairs), bounds, func(p *printer, i int) {
+		p.expression(pairs[i].Key, parser.LOWEST)
+		p.write(": ")
+		p.expression(pairs[i].Value, parser.LOWEST)
+	})
+}
+
+// negative reports whether the text of operand, printed after a prefix
+// operator, starts with a minus sign.
+func negative(operand ast.Expression) bool {
+	switch operand := operand.(type) {
+	case *ast.PrefixExpression:
+		return operand.Operator == "-"
+	case *ast.IntegerLiteral:
+		if operand.Token.Literal != "" {
+			return strings.HasPrefix(operand.Token.Literal, "-")
+		}
+		return operand.Value < 0
+	}
+	return false
+}
+
+// pattern prints a destructuring pattern.
+func (p *printer) pattern(pat ast.Pattern) {
+	switch pat := pat.(type) {
+	case *ast.Identifier:
+		p.write(pat.Value)
+	case *ast.WildcardPattern:
+		p.write("_")
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.NullLiteral:
+		p.expression(pat.(ast.Expression), parser.LOWEST)
+	case *ast.ArrayPattern:
+		n := len(pat.Elements)
+		if pat.Rest != nil {
+			n++
+		}
+		bounds := func(i int) (ast.Node, ast.Node) {
+			if i < len(pat.Elements) {
+				return pat.Elements[i], pat.Elements[i]
+			}
+			return pat.Rest, pat.Rest
+		}
+		p.items(pat, "[", "]", n, bounds, func(p *printer, i int) {
+			if i < len(pat.Elements) {
+				p.pattern(pat.Elements[i])
+			} else {
+				p.write("..." + pat.Rest.Value)
+			}
+		})
+	case *ast.HashPattern:
+		bounds := func(i int) (ast.Node, ast.Node) { return pat.Pairs[i].Key, pat.Pairs[i].Value }
+		p.items(pat, "{", "}", len(pat.Pairs), bounds, func(p *printer, i int) {
+			pair := pat.Pairs[i]
+			if pair.Shorthand() {
+				p.write(pair.Key.(*ast.Identifier).Value)
+				return
+			}
+			p.expression(pair.Key, parser.LOWEST)
+			p.write(": ")
+			p.pattern(pair.Value)
+		})
+	}
+}
+
+// items prints n comma-separated items between open and close, printing each
+// with item. Lists that do not fit on the current line, or that hold a
+// comment, are printed one item per line. list is the node holding the items
+// and bounds returns the first and last node of each item, which locate the
+// comments.
+func (p *printer) items(list ast.Node, open, close string, n int, bounds func(i int) (first, last ast.Node), item func(p *printer, i int)) {
+	// Arrow functions between brackets need no parentheses in guards.
+	guard := p.guard
+	p.guard = false
+	defer func() { p.guard = guard }()
+	if !p.flat && p.holdsComment(list) {
+		p.itemsBroken(list, open, close, n, bounds, item)
+		return
+	}
+	if !p.flat && n > 0 {
+		measure := &printer{flat: true, indent: p.indent}
+		measure.itemsFlat(open, close, n, item)
+		flat := measure.buf.String()
+		if !strings.Contains(flat, "\n") && p.column+len(flat) > MaxWidth {
+			p.itemsBroken(list, open, close, n, bounds, item)
+			return
+		}
+	}
+	p.itemsFlat(open, close, n, item)
+}
+
+// itemsBroken prints items like items, one per line. A comment on the line an
+// item ends stays after it, and other comments go on lines of their own
+// before the item or closing bracket they precede.
+func (p *printer) itemsBroken(list ast.Node, open, close string, n int, bounds func(i int) (first, last ast.Node), item func(p *printer, i int)) {
+	_, end, _ := p.bounds(list, list)
+	p.write(open)
+	p.indent++
+	for i := 0; i < n; i++ {
+		start, last, _ := p.bounds(bounds(i))
+		p.itemComments(start)
+		p.newline()
+		item(p, i)
+		if i < n-1 {
+			p.write(",")
+		}
+		next := end
+		if i+1 < n {
+			next, _, _ = p.bounds(bounds(i + 1))
+		}
+		p.itemComment(last.line, next)
+	}
+	p.itemComments(end)
+	p.indent--
+	p.newline()
+	p.write(close)
+}
+
+func (p *printer) itemsFlat(open, close string, n int, item func(p *printer, i int)) {
+	p.write(open)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			p.write(", ")
+		}
+		item(p, i)
+	}
+	p.write(close)
+}
+
+// quote returns s as a Monkey string literal.
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// templateText escapes the text of a template literal the way quote escapes
+// strings, and also its backticks and the `${` that would open a hole.
+var templateText = strings.NewReplacer(`\`, `\\`, "`", "\\`", "${", `\${`, "\n", `\n`, "\t", `\t`)
@@ -0,0 +1,215 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/parser"
+	"github.com/kellemNegasi/monkeylang/token"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"return  a+b*c", "return a + b * c;\n"},
+		{"(a + b) * c; a - (b - c); (a - b) - c", "(a + b) * c;\na - (b - c);\na - b - c;\n"},
+		{"-(a + b); !(-a); (-a) * b", "-(a + b);\n!-a;\n-a * b;\n"},
+		{"-(-a); - -1; !(!a); -(-(-a))", "- -a;\n- -1;\n!!a;\n- - -a;\n"},
+		{"(5 > 4) == (3 < 4)", "5 > 4 == 3 < 4;\n"},
+		{"(a == b) == c; a == (b == c)", "a == b == c;\na == (b == c);\n"},
+		{"f(x)(y); (f + g)(x)", "f(x)(y);\n(f + g)(x);\n"},
+		{"[1,2+3][0]; f(x)[0]; (-a)[1]; -(a[1]); a[0](1)", "[1, 2 + 3][0];\nf(x)[0];\n(-a)[1];\n-a[1];\na[0](1);\n"},
+		{"[]", "[];\n"},
+		{`{"a":1,2:b+c}["a"]; {}`, "{\"a\": 1, 2: b + c}[\"a\"];\n{};\n"},
+		{`let s = "a \\ \"b\"\n";`, "let s = \"a \\\\ \\\"b\\\"\\n\";\n"},
+		{"if(x){}else{ y }", "if (x) {} else {\n\ty;\n}\n"},
+		{
+			"let add = fn(a,b){ return a+b; };",
+			"let add = fn(a, b) {\n\treturn a + b;\n};\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			"// header\n\nlet a = 1; // one\nfn() {\n  // body\n  a\n  // end of body\n};\n// footer",
+			"// header\n\nlet a = 1; // one\nfn() {\n\t// body\n\ta;\n\t// end of body\n};\n// footer\n",
+		},
+		{
+			"fn() { // note\n}",
+			"fn() {\n\t// note\n};\n",
+		},
+		{
+			"let result = compute(firstArgument, secondArgument, thirdArgument, fourthArgument);",
+			"let result = compute(\n\tfirstArgument,\n\tsecondArgument,\n\tthirdArgument,\n\tfourthArgument\n);\n",
+		},
+		{
+			"let list = [firstElement, secondElement, thirdElement, fourthElement, fifthElement];",
+			"let list = [\n\tfirstElement,\n\tsecondElement,\n\tthirdElement,\n\tfourthElement,\n\tfifthElement\n];\n",
+		},
+		{
+			`let config = {"name": firstValue, "size": secondValue, "colour": thirdValue, "shape": last};`,
+			"let config = {\n\t\"name\": firstValue,\n\t\"size\": secondValue,\n\t\"colour\": thirdValue,\n\t\"shape\": last\n};\n",
+		},
+		{"puts(1, // one\n 2);", "puts(\n\t1, // one\n\t2\n);\n"},
+		{"g( // none\n);", "g(\n\t// none\n);\n"},
+		{"let xs = [\n  // first\n  1,\n  2 // two\n  // end\n];", "let xs = [\n\t// first\n\t1,\n\t2 // two\n\t// end\n];\n"},
+		{`{"a": 1, // a` + "\n" + `"b": 2}`, "{\n\t\"a\": 1, // a\n\t\"b\": 2\n};\n"},
+		{"let [a, // a\n ...rest] = xs;", "let [\n\ta, // a\n\t...rest\n] = xs;\n"},
+		{"let {x, // x\n \"y\": y} = h;", "let {\n\tx, // x\n\t\"y\": y\n} = h;\n"},
+		{
+			"match (a) {\n  // zero\n  0 => \"zero\", // z\n  _ => 1,\n  // done\n}",
+			"match (a) {\n\t// zero\n\t0 => \"zero\", // z\n\t_ => 1,\n\t// done\n};\n",
+		},
+		{"f([1, // c\n 2], 3);", "f(\n\t[\n\t\t1, // c\n\t\t2\n\t],\n\t3\n);\n"},
+		{
+			"try{ f() }catch(e){ throw e }finally{ g() }",
+			"try {\n\tf();\n} catch (e) {\n\tthrow e;\n} finally {\n\tg();\n}\n",
+		},
+		{"let x = try { f() } catch (e) { 0 };", "let x = try {\n\tf();\n} catch (e) {\n\t0;\n};\n"},
+		{"throw  {\"code\":1}", "throw {\"code\": 1};\n"},
+		{"let [a,[b],...c]=x", "let [a, [b], ...c] = x;\n"},
+		{`let {name,age:years,"k":{v}}=h`, "let {name, age: years, \"k\": {v}} = h;\n"},
+		{`import  "lib.mk"  as lib`, "import \"lib.mk\" as lib;\n"},
+		{"export let x=lib.f(1).y", "export let x = lib.f(1).y;\n"},
+		{
+			`match(x){0=>"zero",[a,_] if a>1=>a,{"k":true}=>1,_=>x}`,
+			"match (x) {\n\t0 => \"zero\",\n\t[a, _] if a > 1 => a,\n\t{\"k\": true} => 1,\n\t_ => x,\n};\n",
+		},
+		{"match (x) {}", "match (x) {};\n"},
+		{"match (x) { - 1 => 1, {2: a, true: b} => a }", "match (x) {\n\t-1 => 1,\n\t{2: a, true: b} => a,\n};\n"},
+		{"let f=fn(a,b=a*2,...rest){rest}", "let f = fn(a, b = a * 2, ...rest) {\n\trest;\n};\n"},
+		{"f(...xs,1);[...a,...b+c]", "f(...xs, 1);\n[...a, ...b + c];\n"},
+		{"(a + b).c; (-a).b; -a.b; a.b[0].c(1)", "(a + b).c;\n(-a).b;\n-a.b;\na.b[0].c(1);\n"},
+		{"xs|>filter(( x )=>x>1)|>map((x)=>x*2)", "xs |> filter((x) => x > 1) |> map((x) => x * 2);\n"},
+		{"a |> (b |> c); (a |> b) + 1; ((x) => x)(1)", "a |> (b |> c);\n(a |> b) + 1;\n((x) => x)(1);\n"},
+		{"let add=(a)=>(b)=>a+b; (x) => (x |> f)", "let add = (a) => (b) => a + b;\n(x) => (x |> f);\n"},
+		{"((x) => x) |> f; [(x) => x, 1]", "((x) => x) |> f;\n[(x) => x, 1];\n"},
+		{"match (v) { x if ((x) => x)(1) => 1, _ => (y) => y }", "match (v) {\n\tx if ((x) => x)(1) => 1,\n\t_ => (y) => y,\n};\n"},
+		{"match (v) { x if (f((y) => y)) => 1 }", "match (v) {\n\tx if f((y) => y) => 1,\n};\n"},
+		{"a?b:c?d:e; (a?b:c)?d:e; a?(b?c:d):e", "a ? b : c ? d : e;\n(a ? b : c) ? d : e;\na ? b ? c : d : e;\n"},
+		{"(a??b)??c; a??(b??c); (a ?? b) == c", "a ?? b ?? c;\na ?? (b ?? c);\n(a ?? b) == c;\n"},
+		{"a?.b?.[ i ]?.( 1 ).c; (a?.b)(); null", "a?.b?.[i]?.(1).c;\na?.b();\nnull;\n"},
+		{"(c ? f : g) |> h; c ? (x) => x : (y) => y", "c ? f : g |> h;\nc ? (x) => x : ((y) => y);\n"},
+		{"(x) => c ? x : null ?? 1", "(x) => c ? x : null ?? 1;\n"},
+		{"`a ${ x+1 } b`;``", "`a ${x + 1} b`;\n``;\n"},
+		{"`\\` \\${x} $y $${z} \\\\ line\nbreak\ttab`", "`\\` \\${x} $y $${z} \\\\ line\\nbreak\\ttab`;\n"},
+		{"`${ `${ {\"k\": 1}[\"k\"] }` }`", "`${`${{\"k\": 1}[\"k\"]}`}`;\n"},
+		{
+			"apply(fn(x) { x }, 1)",
+			"apply(fn(x) {\n\tx;\n}, 1);\n",
+		},
+	}
+	for _, tt := range tests {
+		out, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) returned error: %v", tt.input, err)
+			continue
+		}
+		if string(out) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot= %q", tt.input, tt.expected, out)
+		}
+	}
+}
+
+// corpus holds programs exercising every construct the formatter prints.
+var corpus = []string{
+	`let x = 5 * (2 + 3) - -1;`,
+	`let fib = fn(n) { if (n < 2) { return n; } else { fib(n - 1) + fib(n - 2) } }; fib(10);`,
+	`// comment
+	let a = fn() { // trailing
+		// inner
+		fn(x, y) { x * (y + 1) }
+	};
+
+	a()(1, 2) == !true;`,
+	`if (a) { if (b) { c } } else { d(e(f(g))) }`,
+	`let safe = fn(f) { try { f() } catch (e) { throw e["message"]; } finally { cleanup() } };`,
+	`let sign = fn(n) { match (n) { 0 => "zero", x if x < 0 => "negative", _ => "positive" } };`,
+	`let pad = fn(s, width = 10, ...fill) { [...fill, s, ...pad(s, width - 1)] };`,
+	`let inc = (x) => x + 1; [1, 2, 3] |> map(inc) |> filter((x) => x > 2) |> (xs) => len(xs);`,
+	`let name = user?.profile?.["name"] ?? (fallback ? fallback() : null); user?.greet?.(name);`,
+	"let greet = fn(name, n) { `Hello, ${name}! You have ${n} new ${n == 1 ? \"message\" : \"messages\"}.\\n` };",
+	`let long = outer(inner(argumentNumberOne, argumentNumberTwo), argumentNumberThree, 123456789);`,
+	`let xs = [1, // one
+		{"k": f(2, // two
+			3)} // hash
+		// last
+	]; match (xs) { [a, ...b] => a, // first arm
+		_ => 0 }`,
+	`fn(a) { fn(b) { fn(c) { aVeryLongFunctionName(aVeryLongArgument, anotherVeryLongArgument, a, b, c) } } }`,
+}
+
+func TestIdempotent(t *testing.T) {
+	for _, input := range corpus {
+		once, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %v", input, err)
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %v", once, err)
+		}
+		if !bytes.Equal(once, twice) {
+			t.Errorf("formatting is not idempotent.\nonce= %q\ntwice=%q", once, twice)
+		}
+	}
+}
+
+func TestPreservesMeaning(t *testing.T) {
+	for _, input := range corpus {
+		out, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %v", input, err)
+		}
+		if parse(t, input).String() != parse(t, string(out)).String() {
+			t.Errorf("formatting changed the program.\ninput= %q\noutput=%q", input, out)
+		}
+	}
+}
+
+func TestNode(t *testing.T) {
+	// A tree built by hand has no positions; it is printed without comments
+	// and with the same parenthesization rules.
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.InfixExpression{
+			Operator: "*",
+			Left: &ast.InfixExpression{
+				Operator: "+",
+				Left:     &ast.IntegerLiteral{Value: 1},
+				Right:    &ast.Identifier{Value: "x"},
+			},
+			Right: &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2},
+		}},
+	}}
+	var out bytes.Buffer
+	if err := Node(&out, program); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "(1 + x) * 2;\n" {
+		t.Errorf("Node() wrong. got=%q", out.String())
+	}
+}
+
+func TestSourceError(t *testing.T) {
+	_, err := Source([]byte("let = 5;"))
+	if err == nil || !strings.Contains(err.Error(), "expected next token to be IDENT") {
+		t.Errorf("expected a parse error, got=%v", err)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
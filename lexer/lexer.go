@@ -2,6 +2,8 @@
 package lexer
 
 import (
+	"strings"
+
 	"github.com/kellemNegasi/monkeylang/token"
 )
 
@@ -11,6 +13,13 @@ type Lexer struct {
 	position     int    // current position in input (current char)
 	readPosition int    // the position after current char, current reading position
 	ch           byte   // current char under examination
+	line         int    // line of the current char
+	column       int    // column of the current char
+	comments     []token.Token
+	// holes has an entry for each `${` hole of a template literal being
+	// lexed, innermost last, counting the braces opened in it and not closed
+	// yet. The `}` closing the hole itself returns to the template's text.
+	holes []int
 }
 
 // New is function that intializes Lexer object and returns a pointer to a it.
@@ -21,6 +30,8 @@ func New(input string) *Lexer {
 		position:     0,
 		readPosition: 0,
 		ch:           0,
+		line:         1,
+		column:       0,
 	}
 	l.readChar() // initializes position,readPosition and ch.
 	return l
@@ -28,6 +39,11 @@ func New(input string) *Lexer {
 
 // Method readChar() Reads the next character and assigns it the ch field of Lexer.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -38,15 +54,20 @@ func (l *Lexer) readChar() {
 }
 
 // NextToken identifies and returns the next token
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+func (l *Lexer) NextToken() (tok token.Token) {
 	l.eatWhiteSpace() // skip white spaces
+	line, column := l.line, l.column
+	defer func() { tok.Line, tok.Column = line, column }()
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -70,19 +91,75 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LT, l.ch)
 	case '>':
 		tok = newToken(token.GT, l.ch)
+	case '|':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.PIPE, Literal: "|>"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '?':
+		if l.peekChar() == '?' {
+			l.readChar()
+			tok = token.Token{Type: token.NULLISH, Literal: "??"}
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.OPTIONAL, Literal: "?."}
+		} else {
+			tok = newToken(token.QUESTION, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.holes); n > 0 {
+			l.holes[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		n := len(l.holes)
+		if n > 0 && l.holes[n-1] == 0 {
+			l.holes = l.holes[:n-1]
+			return l.readTemplate(token.TEMPLATE_MIDDLE, token.TEMPLATE_TAIL)
+		}
+		if n > 0 {
+			l.holes[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
+	case '`':
+		return l.readTemplate(token.TEMPLATE_HEAD, token.TEMPLATE)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '"':
+		if value, ok := l.readString(); ok {
+			tok = token.Token{Type: token.STRING, Literal: value}
+		} else {
+			tok = token.Token{Type: token.ILLEGAL, Literal: "unterminated string"}
+			return tok
+		}
 	case 0:
+		if !l.atEnd() {
+			// A NUL byte in the source is not the end of it.
+			tok = newToken(token.ILLEGAL, l.ch)
+			break
+		}
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
@@ -119,15 +196,100 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
+// readString reads a double quoted string and returns its value with escape
+// sequences (\", \\, \n, \t) resolved. It leaves the current char on the
+// closing quote and reports false if the string is not terminated.
+func (l *Lexer) readString() (string, bool) {
+	var out strings.Builder
+	for {
+		l.readChar()
+		if l.atEnd() {
+			return "", false
+		}
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case '\\':
+			l.readChar()
+			if l.atEnd() {
+				return "", false
+			}
+			switch l.ch {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			default:
+				out.WriteByte(l.ch)
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+// readTemplate reads the text of a template literal following the current
+// char, a backtick or the `}` closing a hole, resolving escape sequences as
+// readString does, so that \` and \${ stand for themselves. The text ends
+// with a `${` opening a hole, making a token of type open, or with the
+// closing backtick, making one of type end.
+func (l *Lexer) readTemplate(open, end token.TokenType) token.Token {
+	var out strings.Builder
+	for {
+		l.readChar()
+		if l.atEnd() {
+			return token.Token{Type: token.ILLEGAL, Literal: "unterminated template"}
+		}
+		switch l.ch {
+		case '`':
+			l.readChar()
+			return token.Token{Type: end, Literal: out.String()}
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteByte(l.ch)
+				break
+			}
+			l.readChar()
+			l.readChar()
+			l.holes = append(l.holes, 0)
+			return token.Token{Type: open, Literal: out.String()}
+		case '\\':
+			l.readChar()
+			if l.atEnd() {
+				return token.Token{Type: token.ILLEGAL, Literal: "unterminated template"}
+			}
+			switch l.ch {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			default:
+				out.WriteByte(l.ch)
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
 // isLetter() checks if the current character is a letter.
 // This function also includes '_' in the letters list. i.e '_' is considered as a letter.
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
-// readNumber() Reads a given number
+// readNumber() Reads a given number.
+// Besides decimals it reads hexadecimal, octal and binary literals prefixed with 0x, 0o and 0b.
 func (l *Lexer) readNumber() string {
 	position := l.position
+	if l.ch == '0' && strings.ContainsRune("xXoObB", rune(l.peekChar())) {
+		l.readChar()
+		l.readChar()
+		for isDigit(l.ch) || isLetter(l.ch) {
+			l.readChar()
+		}
+		return l.input[position:l.position]
+	}
 	for isDigit(l.ch) {
 		l.readChar()
 	}
@@ -139,11 +301,46 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-// eatWhiteSpace() skips the white space and advances the position forward.
+// eatWhiteSpace() skips the white space and comments and advances the position forward.
 func (l *Lexer) eatWhiteSpace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+			l.readChar()
+		}
+		if l.ch != '/' || l.peekChar() != '/' {
+			return
+		}
+		l.readComment()
+	}
+}
+
+// readComment reads a `//` comment up to the end of the line and records it.
+func (l *Lexer) readComment() {
+	comment := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+	position := l.position
+	for l.ch != '\n' && !l.atEnd() {
 		l.readChar()
 	}
+	comment.Literal = strings.TrimRight(l.input[position:l.position], "\r")
+	l.comments = append(l.comments, comment)
+}
+
+// Offset returns the byte offset just past the last token returned by NextToken.
+func (l *Lexer) Offset() int {
+	if l.position > len(l.input) {
+		return len(l.input)
+	}
+	return l.position
+}
+
+// atEnd reports whether the whole input has been read.
+func (l *Lexer) atEnd() bool {
+	return l.position >= len(l.input)
+}
+
+// Comments returns the comments skipped so far, in source order.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
 }
 
 //peakChar looks ahead and returns the next character
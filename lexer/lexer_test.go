@@ -26,6 +26,14 @@ func TestNextToken(t *testing.T) {
 	
 	10 == 10;
 	10 != 9;
+	[1, 2];
+	{"foo": "bar"}
+	import "lib.mk" as lib;
+	export let x = lib.y;
+	let [a, ...b] = c;
+	match (x) { _ => my_y }
+	xs |> (x) => x
+	a ? null : b ?? c?.d?.[0]?.()
 	`
 
 	tests := []struct {
@@ -115,6 +123,74 @@ func TestNextToken(t *testing.T) {
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
 
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+
+		{token.IMPORT, "import"},
+		{token.STRING, "lib.mk"},
+		{token.AS, "as"},
+		{token.IDENT, "lib"},
+		{token.SEMICOLON, ";"},
+		{token.EXPORT, "export"},
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "lib"},
+		{token.DOT, "."},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "let"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RBRACKET, "]"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "c"},
+		{token.SEMICOLON, ";"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "my_y"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "xs"},
+		{token.PIPE, "|>"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "x"},
+		{token.IDENT, "a"},
+		{token.QUESTION, "?"},
+		{token.NULL, "null"},
+		{token.COLON, ":"},
+		{token.IDENT, "b"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "c"},
+		{token.OPTIONAL, "?."},
+		{token.IDENT, "d"},
+		{token.OPTIONAL, "?."},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.OPTIONAL, "?."},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+
 		{token.EOF, ""},
 	}
 	l := New(input)
@@ -129,3 +205,176 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x == 10\n"
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.EQ, 2, 5},
+		{token.INT, 2, 8},
+		{token.EOF, 3, 1},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// leading\nlet x = 10 / 2; // trailing\r\n//last"
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT,
+		token.SLASH, token.INT, token.SEMICOLON, token.EOF}
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+	comments := []token.Token{
+		{Type: token.COMMENT, Literal: "// leading", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "// trailing", Line: 2, Column: 17},
+		{Type: token.COMMENT, Literal: "//last", Line: 3, Column: 1},
+	}
+	if len(l.Comments()) != len(comments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(comments), len(l.Comments()))
+	}
+	for i, c := range comments {
+		if l.Comments()[i] != c {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, c, l.Comments()[i])
+		}
+	}
+}
+
+func TestNumberPrefixes(t *testing.T) {
+	l := New("0x1F 0o17 0b101 007")
+	for _, expected := range []string{"0x1F", "0o17", "0b101", "007"} {
+		tok := l.NextToken()
+		if tok.Type != token.INT || tok.Literal != expected {
+			t.Errorf("wrong token. expected=INT %q, got=%s %q", expected, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := `"foobar" "foo bar" "say \"hi\"\n" "unterminated`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, "say \"hi\"\n"},
+		{token.ILLEGAL, "unterminated string"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// TestNulBytes checks that a NUL byte ends neither the input nor a string,
+// template or comment holding it.
+func TestNulBytes(t *testing.T) {
+	input := "a \x00 \"s\x00\" `t\x00` // c\x00\nb"
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.ILLEGAL, "\x00"},
+		{token.STRING, "s\x00"},
+		{token.TEMPLATE, "t\x00"},
+		{token.IDENT, "b"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+	if comments := l.Comments(); len(comments) != 1 || comments[0].Literal != "// c\x00" {
+		t.Errorf("wrong comments. got=%v", comments)
+	}
+}
+
+// TestTemplates checks that the lexer returns to the text of a template at
+// the `}` closing a hole, and not at one closing a brace or inside a string
+// in the hole, and that the tokens of holes keep their positions.
+func TestTemplates(t *testing.T) {
+	input := "`a ${ {\"k\": \"}\"}[\"k\"] } b ${`c${x}`}\\${d}\\``\n`line\n${ y }`;`open ${`"
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.TEMPLATE_HEAD, "a ", 1, 1},
+		{token.LBRACE, "{", 1, 7},
+		{token.STRING, "k", 1, 8},
+		{token.COLON, ":", 1, 11},
+		{token.STRING, "}", 1, 13},
+		{token.RBRACE, "}", 1, 16},
+		{token.LBRACKET, "[", 1, 17},
+		{token.STRING, "k", 1, 18},
+		{token.RBRACKET, "]", 1, 21},
+		{token.TEMPLATE_MIDDLE, " b ", 1, 23},
+		{token.TEMPLATE_HEAD, "c", 1, 29},
+		{token.IDENT, "x", 1, 33},
+		{token.TEMPLATE_TAIL, "", 1, 34},
+		{token.TEMPLATE_TAIL, "${d}`", 1, 36},
+		{token.TEMPLATE_HEAD, "line\n", 2, 1},
+		{token.IDENT, "y", 3, 4},
+		{token.TEMPLATE_TAIL, "", 3, 6},
+		{token.SEMICOLON, ";", 3, 8},
+		{token.TEMPLATE_HEAD, "open ", 3, 9},
+		{token.ILLEGAL, "unterminated template", 3, 17},
+		{token.EOF, "", 3, 18},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+
+	if tok := New("`${x`").NextToken(); tok.Type != token.TEMPLATE_HEAD {
+		t.Fatalf("wrong first token %s", tok.Type)
+	}
+	if tok := New("``").NextToken(); tok.Type != token.TEMPLATE || tok.Literal != "" {
+		t.Errorf("empty template wrong. got=%s %q", tok.Type, tok.Literal)
+	}
+	if tok := New("`$x $ \\n`").NextToken(); tok.Type != token.TEMPLATE || tok.Literal != "$x $ \n" {
+		t.Errorf("dollar signs wrong. got=%s %q", tok.Type, tok.Literal)
+	}
+}
@@ -0,0 +1,181 @@
+// Package limits bounds the resources a Monkey program may use while it
+// runs. The evaluator and the virtual machine both meter execution with a
+// Meter, so a program hits the same limits whichever engine runs it.
+package limits
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kellemNegasi/monkeylang/object"
+)
+
+// DefaultMaxDepth is the call depth allowed when Config.MaxDepth is zero.
+const DefaultMaxDepth = 1024
+
+// checkInterval is the number of steps between two checks of the context.
+const checkInterval = 1024
+
+// Config holds the limits of an execution. Zero fields mean no limit, except
+// MaxDepth, which defaults to DefaultMaxDepth.
+type Config struct {
+	// MaxSteps bounds the work done: the number of nodes the evaluator
+	// evaluates, or of instructions the VM executes.
+	MaxSteps int64
+	// MaxDepth bounds the number of nested function calls. Tail calls do
+	// not nest.
+	MaxDepth int
+	// MaxAlloc bounds the total number of bytes allocated for values and
+	// environments, estimated from their sizes. Memory is not reclaimed
+	// from the budget when it is freed.
+	MaxAlloc int64
+}
+
+// Depth returns the effective call depth limit of c.
+func (c Config) Depth() int {
+	if c.MaxDepth <= 0 {
+		return DefaultMaxDepth
+	}
+	return c.MaxDepth
+}
+
+// StepError reports that a program exceeded Config.MaxSteps.
+type StepError struct {
+	Limit int64
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step limit of %d exceeded", e.Limit)
+}
+
+// DepthError reports that a program nested calls deeper than the depth
+// limit.
+type DepthError struct {
+	Limit int
+}
+
+func (e *DepthError) Error() string {
+	return fmt.Sprintf("stack overflow: call depth limit of %d exceeded", e.Limit)
+}
+
+// AllocError reports that a program exceeded Config.MaxAlloc.
+type AllocError struct {
+	Limit int64
+}
+
+func (e *AllocError) Error() string {
+	return fmt.Sprintf("allocation limit of %d bytes exceeded", e.Limit)
+}
+
+// CanceledError reports that the context of an execution was canceled or
+// timed out. It unwraps to the context's error.
+type CanceledError struct {
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return "execution canceled: " + e.Err.Error()
+}
+
+func (e *CanceledError) Unwrap() error { return e.Err }
+
+// Meter tracks the resources used by one execution.
+type Meter struct {
+	ctx    context.Context
+	config Config
+	steps  int64
+	depth  int
+	alloc  int64
+}
+
+// NewMeter returns a meter enforcing config and the cancellation of ctx.
+func NewMeter(ctx context.Context, config Config) *Meter {
+	return &Meter{ctx: ctx, config: config}
+}
+
+// Step counts one step of execution. It also reports the cancellation of the
+// context, which it checks every few steps.
+func (m *Meter) Step() error {
+	m.steps++
+	if m.config.MaxSteps > 0 && m.steps > m.config.MaxSteps {
+		return &StepError{Limit: m.config.MaxSteps}
+	}
+	if m.steps%checkInterval == 0 {
+		return m.Canceled()
+	}
+	return nil
+}
+
+// Canceled returns a CanceledError if the context is done.
+func (m *Meter) Canceled() error {
+	select {
+	case <-m.ctx.Done():
+		return &CanceledError{Err: m.ctx.Err()}
+	default:
+		return nil
+	}
+}
+
+// Enter records a function call.
+func (m *Meter) Enter() error {
+	if m.depth >= m.config.Depth() {
+		return &DepthError{Limit: m.config.Depth()}
+	}
+	m.depth++
+	return nil
+}
+
+// Leave records the return from a function call.
+func (m *Meter) Leave() {
+	m.depth--
+}
+
+// Depth returns the number of function calls being made.
+func (m *Meter) Depth() int {
+	return m.depth
+}
+
+// Alloc counts the allocation of n bytes.
+func (m *Meter) Alloc(n int64) error {
+	m.alloc += n
+	if m.config.MaxAlloc > 0 && m.alloc > m.config.MaxAlloc {
+		return &AllocError{Limit: m.config.MaxAlloc}
+	}
+	return nil
+}
+
+// Approximate sizes in bytes of runtime values.
+const (
+	wordSize   = 8
+	objectSize = 2 * wordSize // an interface value pointing to the object
+)
+
+// SizeOf returns the approximate number of bytes allocated for obj, not
+// counting the values it refers to. Booleans and null are shared singletons
+// and cost nothing.
+func SizeOf(obj object.Object) int64 {
+	switch obj := obj.(type) {
+	case nil, *object.Boolean, *object.Null:
+		return 0
+	case *object.Integer:
+		return objectSize + wordSize
+	case *object.String:
+		return objectSize + 2*wordSize + int64(len(obj.Value))
+	case *object.Closure:
+		return objectSize + 4*wordSize + int64(len(obj.Free))*objectSize
+	case *object.Function:
+		return objectSize + 7*wordSize
+	case *object.Array:
+		return objectSize + 3*wordSize + int64(len(obj.Elements))*objectSize
+	case *object.Hash:
+		// Each pair is stored once in order and its key once in the index.
+		return objectSize + 10*wordSize + int64(obj.Len())*(2*objectSize+6*wordSize)
+	}
+	return objectSize
+}
+
+// EnvironmentSize returns the approximate number of bytes allocated for an
+// environment binding n names.
+func EnvironmentSize(n int) int64 {
+	return 6*wordSize + int64(n)*(2*wordSize+objectSize)
+}
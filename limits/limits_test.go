@@ -0,0 +1,72 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMeter(t *testing.T) {
+	m := NewMeter(context.Background(), Config{MaxSteps: 3, MaxDepth: 2, MaxAlloc: 10})
+	for i := 0; i < 3; i++ {
+		if err := m.Step(); err != nil {
+			t.Fatalf("step %d failed: %v", i, err)
+		}
+	}
+	if err, ok := m.Step().(*StepError); !ok || err.Limit != 3 {
+		t.Errorf("wrong step error: %v", err)
+	}
+
+	if m.Enter() != nil || m.Enter() != nil {
+		t.Fatal("entering two calls failed")
+	}
+	if err, ok := m.Enter().(*DepthError); !ok || err.Limit != 2 {
+		t.Errorf("wrong depth error: %v", err)
+	}
+	m.Leave()
+	if m.Depth() != 1 {
+		t.Errorf("wrong depth after leaving a call. want=1, got=%d", m.Depth())
+	}
+	if err := m.Enter(); err != nil {
+		t.Errorf("entering a call after leaving one failed: %v", err)
+	}
+
+	if err := m.Alloc(10); err != nil {
+		t.Fatalf("allocation within the budget failed: %v", err)
+	}
+	if err, ok := m.Alloc(1).(*AllocError); !ok || err.Limit != 10 {
+		t.Errorf("wrong allocation error: %v", err)
+	}
+}
+
+func TestMeterDefaults(t *testing.T) {
+	m := NewMeter(context.Background(), Config{})
+	for i := 0; i < DefaultMaxDepth; i++ {
+		if err := m.Enter(); err != nil {
+			t.Fatalf("call %d failed: %v", i, err)
+		}
+	}
+	if _, ok := m.Enter().(*DepthError); !ok {
+		t.Errorf("default depth limit not applied")
+	}
+	if err := m.Alloc(1 << 40); err != nil {
+		t.Errorf("allocation limited by default: %v", err)
+	}
+}
+
+func TestMeterCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewMeter(ctx, Config{})
+	if err := m.Canceled(); err != nil {
+		t.Fatalf("live context reported canceled: %v", err)
+	}
+	cancel()
+	var err error
+	for i := 0; i < checkInterval && err == nil; i++ {
+		err = m.Step()
+	}
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) || !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error after cancellation: %v", err)
+	}
+}
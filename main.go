@@ -8,7 +8,26 @@ import (
 	"github.com/kellemNegasi/monkeylang/repl"
 )
 
+// commands maps subcommand names to their entry points. Each receives the
+// arguments following the subcommand name and returns the exit status.
+var commands = map[string]func(args []string) int{
+	"fmt":    fmtMain,
+	"build":  buildMain,
+	"disasm": disasmMain,
+	"parse":  parseMain,
+	"run":    runMain,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "monkey: unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+		os.Exit(command(os.Args[2:]))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,545 @@
+// Package mkc reads and writes compiled Monkey programs in the .mkc file
+// format.
+//
+// A file starts with the magic bytes "MKC\x00" and a big-endian uint16
+// format version, followed by the program and a big-endian CRC-32 (IEEE) of
+// all the bytes before it. The program is the name of the source file, the
+// instructions of the top level and their line table, then the constant pool. Lengths, counts and
+// non-negative integers are unsigned varints; integer constants are signed
+// varints. Instructions are stored as a length and the raw bytes; a line table
+// is a count followed by offset, line and column triples. Each constant is a
+// tag byte followed by its value:
+//
+//	tagInteger   varint value
+//	tagString    length, bytes
+//	tagFunction  parameter count, default count, variadic flag, local count, name, file,
+//	             instructions, line table
+//
+// Decode validates everything the virtual machine relies on, so a program
+// that decodes without error can be run safely.
+package mkc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/kellemNegasi/monkeylang/code"
+	"github.com/kellemNegasi/monkeylang/compiler"
+	"github.com/kellemNegasi/monkeylang/object"
+)
+
+// Version is the format version written by Encode and accepted by Decode.
+const Version = 4
+
+// Magic is the signature every .mkc file starts with.
+const Magic = "MKC\x00"
+
+// Tags of constants.
+const (
+	tagInteger  byte = 1
+	tagString   byte = 2
+	tagFunction byte = 3
+)
+
+// ErrInvalid is wrapped by all errors Decode returns for malformed data.
+var ErrInvalid = errors.New("invalid .mkc data")
+
+// IsCompiled reports whether data starts like a .mkc file.
+func IsCompiled(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// Encode returns bytecode in the .mkc format. It fails if the constant pool
+// holds values the format cannot represent.
+func Encode(bytecode *compiler.Bytecode) ([]byte, error) {
+	e := &encoder{}
+	e.buf.WriteString(Magic)
+	e.buf.Write([]byte{Version >> 8, Version & 0xff})
+	e.bytes([]byte(bytecode.File))
+	e.instructions(bytecode.Instructions, bytecode.Lines)
+	e.uvarint(uint64(len(bytecode.Constants)))
+	for i, c := range bytecode.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			e.buf.WriteByte(tagInteger)
+			e.varint(c.Value)
+		case *object.String:
+			e.buf.WriteByte(tagString)
+			e.bytes([]byte(c.Value))
+		case *object.CompiledFunction:
+			e.buf.WriteByte(tagFunction)
+			e.uvarint(uint64(c.NumParameters))
+			e.uvarint(uint64(c.NumDefaults))
+			if c.Variadic {
+				e.buf.WriteByte(1)
+			} else {
+				e.buf.WriteByte(0)
+			}
+			e.uvarint(uint64(c.NumLocals))
+			e.bytes([]byte(c.Name))
+			e.bytes([]byte(c.File))
+			e.instructions(c.Instructions, c.Lines)
+		default:
+			return nil, fmt.Errorf("mkc: cannot encode constant %d of type %s", i, c.Type())
+		}
+	}
+	sum := crc32.ChecksumIEEE(e.buf.Bytes())
+	e.buf.Write([]byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)})
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uvarint(x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], x)])
+}
+
+func (e *encoder) varint(x int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutVarint(b[:], x)])
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) instructions(ins code.Instructions, lines code.LineTable) {
+	e.bytes(ins)
+	e.uvarint(uint64(len(lines)))
+	for _, l := range lines {
+		e.uvarint(uint64(l.Offset))
+		e.uvarint(uint64(l.Line))
+		e.uvarint(uint64(l.Column))
+	}
+}
+
+// Decode parses and validates a .mkc file.
+func Decode(data []byte) (*compiler.Bytecode, error) {
+	if !IsCompiled(data) {
+		return nil, invalid("not a .mkc file")
+	}
+	if len(data) < len(Magic)+2+4 {
+		return nil, invalid("file is truncated")
+	}
+	if v := int(data[4])<<8 | int(data[5]); v != Version {
+		return nil, invalid("unsupported version %d, want %d", v, Version)
+	}
+	body, trailer := data[:len(data)-4], data[len(data)-4:]
+	want := uint32(trailer[0])<<24 | uint32(trailer[1])<<16 | uint32(trailer[2])<<8 | uint32(trailer[3])
+	if crc32.ChecksumIEEE(body) != want {
+		return nil, invalid("checksum mismatch")
+	}
+
+	d := &decoder{data: body, pos: len(Magic) + 2}
+	bytecode := &compiler.Bytecode{File: string(d.bytes())}
+	bytecode.Instructions, bytecode.Lines = d.instructions()
+	n := d.count()
+	bytecode.Constants = make([]object.Object, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, d.constant())
+	}
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("unexpected data after the constant pool")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	v := &validator{constants: bytecode.Constants, freeUsed: map[int]int{}}
+	main := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	if err := v.validate(main, -1); err != nil {
+		return nil, err
+	}
+	for i, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			if err := v.validate(fn, i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, c := range v.closures {
+		if c.numFree < v.freeUsed[c.index] {
+			return nil, invalid("%s: at %04d: closure over function constant %d captures %d values, it uses %d",
+				c.in, c.at, c.index, c.numFree, v.freeUsed[c.index])
+		}
+	}
+	return bytecode, nil
+}
+
+func invalid(format string, a ...interface{}) error {
+	return fmt.Errorf("mkc: %w: %s", ErrInvalid, fmt.Sprintf(format, a...))
+}
+
+// decoder reads the values of a file. After the first error it returns zero
+// values and keeps that error.
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = invalid("at offset %d: %s", d.pos, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bad unsigned integer")
+		return 0
+	}
+	d.pos += n
+	return x
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	x, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bad integer")
+		return 0
+	}
+	d.pos += n
+	return x
+}
+
+// count reads a length or count. Every counted item takes at least one byte,
+// so counts larger than the remaining data are rejected before anything is
+// allocated for them.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)-d.pos) {
+		d.fail("count %d exceeds the remaining data", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.data[d.pos:])
+	d.pos += n
+	return b
+}
+
+func (d *decoder) instructions() (code.Instructions, code.LineTable) {
+	ins := code.Instructions(d.bytes())
+	n := d.count()
+	var lines code.LineTable
+	for i := 0; i < n && d.err == nil; i++ {
+		entry := code.LineEntry{Offset: d.int(), Line: d.int(), Column: d.int()}
+		if entry.Offset >= len(ins) || i > 0 && entry.Offset <= lines[i-1].Offset {
+			d.fail("line table entry %d has bad offset %d", i, entry.Offset)
+		}
+		lines = append(lines, entry)
+	}
+	return ins, lines
+}
+
+// int reads an unsigned varint that must fit in an int32.
+func (d *decoder) int() int {
+	x := d.uvarint()
+	if x > 1<<31-1 {
+		d.fail("value %d out of range", x)
+		return 0
+	}
+	return int(x)
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag := d.byte(); tag {
+	case tagInteger:
+		return &object.Integer{Value: d.varint()}
+	case tagString:
+		return &object.String{Value: string(d.bytes())}
+	case tagFunction:
+		fn := &object.CompiledFunction{NumParameters: d.int(), NumDefaults: d.int()}
+		switch variadic := d.byte(); variadic {
+		case 0:
+		case 1:
+			fn.Variadic = true
+		default:
+			d.fail("bad variadic flag %d", variadic)
+		}
+		fn.NumLocals = d.int()
+		fn.Name = string(d.bytes())
+		fn.File = string(d.bytes())
+		fn.Instructions, fn.Lines = d.instructions()
+		return fn
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
+
+// validator checks the instructions of a program's functions.
+type validator struct {
+	constants []object.Object
+	freeUsed  map[int]int // number of free variables used by each function constant
+	closures  []closure   // closures created by the program
+}
+
+// closure describes an OpClosure instruction.
+type closure struct {
+	in      string // the function holding the instruction
+	at      int
+	index   int // constant index of the function closed over
+	numFree int
+}
+
+// validate checks that the instructions of fn decode, that their operands
+// refer to existing constants, builtins and locals, that jumps go forward and
+// land on instructions, and that the operand stack never underflows. index
+// is the constant index of fn, or -1 for the main program.
+func (v *validator) validate(fn *object.CompiledFunction, index int) error {
+	name := "main program"
+	if index >= 0 {
+		name = fmt.Sprintf("function constant %d", index)
+	}
+	numParameters := fn.NumParameters
+	if fn.Variadic {
+		numParameters++
+	}
+	if numParameters > fn.NumLocals || fn.NumLocals > 255 {
+		return invalid("%s: bad parameter count %d or local count %d", name, fn.NumParameters, fn.NumLocals)
+	}
+	if fn.NumDefaults > fn.NumParameters {
+		return invalid("%s: bad default count %d", name, fn.NumDefaults)
+	}
+	ins := fn.Instructions
+	starts := map[int]bool{}
+	var jumps []int
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return invalid("%s: at %04d: %s", name, i, err)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return invalid("%s: at %04d: truncated %s", name, i, def.Name)
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant:
+			if operands[0] >= len(v.constants) {
+				return invalid("%s: at %04d: constant %d out of range", name, i, operands[0])
+			}
+		case code.OpClosure:
+			if operands[0] >= len(v.constants) {
+				return invalid("%s: at %04d: constant %d out of range", name, i, operands[0])
+			}
+			if _, ok := v.constants[operands[0]].(*object.CompiledFunction); !ok {
+				return invalid("%s: at %04d: constant %d is not a function", name, i, operands[0])
+			}
+			v.closures = append(v.closures, closure{in: name, at: i, index: operands[0], numFree: operands[1]})
+		case code.OpImport:
+			if operands[0] >= len(v.constants) {
+				return invalid("%s: at %04d: constant %d out of range", name, i, operands[0])
+			}
+			module, ok := v.constants[operands[0]].(*object.CompiledFunction)
+			if !ok || module.NumParameters != 0 {
+				return invalid("%s: at %04d: constant %d is not a module function", name, i, operands[0])
+			}
+			// The function is called as a closure capturing nothing.
+			v.closures = append(v.closures, closure{in: name, at: i, index: operands[0]})
+		case code.OpGetLateGlobal:
+			if operands[1] >= len(v.constants) {
+				return invalid("%s: at %04d: constant %d out of range", name, i, operands[1])
+			}
+			if _, ok := v.constants[operands[1]].(*object.String); !ok {
+				return invalid("%s: at %04d: constant %d is not a string", name, i, operands[1])
+			}
+		case code.OpMember:
+			if operands[0] >= len(v.constants) {
+				return invalid("%s: at %04d: constant %d out of range", name, i, operands[0])
+			}
+			if _, ok := v.constants[operands[0]].(*object.String); !ok {
+				return invalid("%s: at %04d: constant %d is not a string", name, i, operands[0])
+			}
+		case code.OpHash:
+			if operands[0]%2 != 0 {
+				return invalid("%s: at %04d: odd hash element count %d", name, i, operands[0])
+			}
+		case code.OpArrayPattern, code.OpMatchArray:
+			if operands[1] > 1 {
+				return invalid("%s: at %04d: bad rest flag %d", name, i, operands[1])
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpGetLocalCell:
+			if operands[0] >= fn.NumLocals {
+				return invalid("%s: at %04d: local %d out of range", name, i, operands[0])
+			}
+		case code.OpGetLocalIfSet:
+			if operands[1] >= fn.NumLocals {
+				return invalid("%s: at %04d: local %d out of range", name, i, operands[1])
+			}
+			jumps = append(jumps, i)
+		case code.OpGetFree, code.OpGetFreeCell, code.OpGetFreeIfSet:
+			if index < 0 {
+				return invalid("%s: at %04d: %s outside a function", name, i, def.Name)
+			}
+			free := operands[len(operands)-1]
+			if free >= v.freeUsed[index] {
+				v.freeUsed[index] = free + 1
+			}
+			if code.Opcode(ins[i]) == code.OpGetFreeIfSet {
+				jumps = append(jumps, i)
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(object.Builtins) {
+				return invalid("%s: at %04d: builtin %d out of range", name, i, operands[0])
+			}
+		case code.OpJumpIfPassed:
+			if operands[1] >= fn.NumParameters {
+				return invalid("%s: at %04d: parameter %d out of range", name, i, operands[1])
+			}
+			jumps = append(jumps, i)
+		case code.OpJump, code.OpJumpNotTruthy, code.OpJumpIfNull, code.OpTry, code.OpTryFinally, code.OpGetGlobalIfSet:
+			jumps = append(jumps, i)
+		case code.OpReturn:
+			if index < 0 {
+				return invalid("%s: at %04d: OpReturn outside a function", name, i)
+			}
+		}
+		starts[i] = true
+		i += 1 + read
+	}
+	for _, i := range jumps {
+		target := int(code.ReadUint16(ins[i+1:]))
+		if target <= i {
+			// The compiler only jumps forward, which guarantees that
+			// every function runs to completion.
+			return invalid("%s: at %04d: backward jump to %04d", name, i, target)
+		}
+		if target != len(ins) && !starts[target] {
+			return invalid("%s: at %04d: jump to %04d is not an instruction", name, i, target)
+		}
+	}
+	return checkStack(name, ins)
+}
+
+// checkStack follows every path through ins and checks that each instruction
+// finds the operands it pops on the stack, and that paths joining at an
+// instruction agree on the stack height there. Locals live below the operand
+// stack and are not counted.
+func checkStack(name string, ins code.Instructions) error {
+	heights := map[int]int{0: 0}
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if i >= len(ins) {
+			continue
+		}
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		op := code.Opcode(ins[i])
+		pop, push := stackEffect(op, operands)
+		height := heights[i]
+		if height < pop {
+			return invalid("%s: at %04d: %s needs %d stack values, has %d", name, i, def.Name, pop, height)
+		}
+		height += push - pop
+
+		// next lists the instructions that may run after this one, with
+		// the stack height they start with.
+		type successor struct{ at, height int }
+		var next []successor
+		switch op {
+		case code.OpReturnValue, code.OpReturn, code.OpThrow, code.OpNoMatch:
+		case code.OpJump:
+			next = []successor{{operands[0], height}}
+		case code.OpJumpNotTruthy, code.OpJumpIfPassed, code.OpJumpIfNull:
+			next = []successor{{i + 1 + read, height}, {operands[0], height}}
+		case code.OpTry, code.OpTryFinally:
+			// The handler starts with the caught value pushed.
+			next = []successor{{i + 1 + read, height}, {operands[0], height + 1}}
+		case code.OpGetLocalIfSet, code.OpGetFreeIfSet, code.OpGetGlobalIfSet:
+			// The value is pushed only when the instruction jumps.
+			next = []successor{{i + 1 + read, height}, {operands[0], height + 1}}
+		default:
+			next = []successor{{i + 1 + read, height}}
+		}
+		for _, n := range next {
+			if h, seen := heights[n.at]; !seen {
+				heights[n.at] = n.height
+				work = append(work, n.at)
+			} else if h != n.height {
+				return invalid("%s: at %04d: stack height %d differs from %d on another path", name, n.at, n.height, h)
+			}
+		}
+	}
+	return nil
+}
+
+// stackEffect returns how many values an instruction pops off the operand
+// stack and how many it pushes.
+func stackEffect(op code.Opcode, operands []int) (pop, push int) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpGetGlobal, code.OpGetLateGlobal, code.OpGetLocal,
+		code.OpGetBuiltin, code.OpGetFree, code.OpCurrentClosure, code.OpGetLocalCell, code.OpGetFreeCell:
+		return 0, 1
+	case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal, code.OpReturnValue, code.OpThrow,
+		code.OpNoMatch:
+		return 1, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpIndex, code.OpMatchLiteral:
+		return 2, 1
+	case code.OpMinus, code.OpBang, code.OpMember, code.OpSpread, code.OpJumpIfNull:
+		return 1, 1
+	case code.OpImport:
+		return 0, 1
+	case code.OpModule:
+		return 2 * operands[0], 1
+	case code.OpCall, code.OpTailCall:
+		return operands[0] + 1, 1
+	case code.OpCallSpread, code.OpTailCallSpread:
+		return 2, 1
+	case code.OpClosure:
+		return operands[1], 1
+	case code.OpArray, code.OpHash, code.OpConcat, code.OpTemplate:
+		return operands[0], 1
+	case code.OpArrayPattern:
+		return 1, operands[0] + operands[1]
+	case code.OpHashPattern:
+		return operands[0] + 1, operands[0]
+	case code.OpMatchArray:
+		return 1, operands[0] + operands[1] + 1
+	case code.OpMatchHash:
+		return operands[0] + 1, operands[0] + 1
+	}
+	return 0, 0
+}
@@ -0,0 +1,239 @@
+package mkc
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/code"
+	"github.com/kellemNegasi/monkeylang/compiler"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/limits"
+	"github.com/kellemNegasi/monkeylang/object"
+	"github.com/kellemNegasi/monkeylang/parser"
+	"github.com/kellemNegasi/monkeylang/vm"
+)
+
+// TestRoundTrip encodes every corpus program, decodes it and checks that the
+// result is identical and runs to the same value as the original.
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "testdata", "corpus", "*.mk"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no corpus files: %v", err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(string(src), "// error: identifier not found") {
+			continue // does not compile
+		}
+		bytecode := compileFile(t, filepath.Base(file), string(src))
+		data, err := Encode(bytecode)
+		if err != nil {
+			t.Fatalf("%s: Encode failed: %v", file, err)
+		}
+		decoded, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%s: Decode failed: %v", file, err)
+		}
+		if !reflect.DeepEqual(decoded, bytecode) {
+			t.Errorf("%s: decoded bytecode differs from the original", file)
+		}
+		if want, got := run(bytecode), run(decoded); want != got {
+			t.Errorf("%s: decoded program result differs. want=%q, got=%q", file, want, got)
+		}
+	}
+}
+
+func TestRoundTripModules(t *testing.T) {
+	dir := t.TempDir()
+	lib := `import "util.mk" as util; export let twice = fn(x) { util.add(x, x) };`
+	util := `export let add = fn(a, b) { a + b };`
+	for name, src := range map[string]string{"lib.mk": lib, "util.mk": util} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bytecode := compileFile(t, filepath.Join(dir, "main.mk"), `import "lib.mk" as lib; lib.twice(21)`)
+	data, err := Encode(bytecode)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, bytecode) {
+		t.Errorf("decoded bytecode differs from the original")
+	}
+	if got := run(decoded); got != "42" {
+		t.Errorf("decoded program result wrong. want=%q, got=%q", "42", got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid, err := Encode(compile(t, `let f = fn(a) { if (a) { "yes" } else { -1 } }; f(true)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := func(main []byte, constants ...[]byte) []byte {
+		data := []byte(Magic + "\x00\x04\x00")
+		data = append(data, byte(len(main)))
+		data = append(data, main...)
+		data = append(data, 0, byte(len(constants)))
+		for _, c := range constants {
+			data = append(data, c...)
+		}
+		return seal(data)
+	}
+	ins := func(parts ...[]byte) []byte {
+		var out []byte
+		for _, p := range parts {
+			out = append(out, p...)
+		}
+		return out
+	}
+	integer := []byte{tagInteger, 2}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, "not a .mkc file"},
+		{"magic", []byte("MKD\x00\x00\x01\x00\x00\x00\x00"), "not a .mkc file"},
+		{"short", []byte(Magic + "\x00\x04"), "truncated"},
+		{"version", seal([]byte(Magic + "\x00\x05\x00\x00\x00")), "unsupported version 5"},
+		{"checksum", append(append([]byte{}, valid[:len(valid)-1]...), valid[len(valid)-1]^1), "checksum mismatch"},
+		{"truncated body", seal(valid[:len(valid)-9]), "at offset"},
+		{"huge count", seal([]byte(Magic + "\x00\x04\x00\xff\xff\x03")), "exceeds the remaining data"},
+		{"trailing", seal(append(append([]byte{}, valid[:len(valid)-4]...), 0)), "unexpected data after"},
+		{"tag", body(nil, []byte{9}), "unknown constant tag 9"},
+		{"opcode", body([]byte{200}), "opcode 200 undefined"},
+		{"truncated instruction", body(code.Make(code.OpConstant, 0)[:2], integer), "truncated OpConstant"},
+		{"constant index", body(ins(code.Make(code.OpConstant, 1), code.Make(code.OpPop)), integer), "constant 1 out of range"},
+		{"local in main", body(code.Make(code.OpGetLocal, 0)), "local 0 out of range"},
+		{"underflow", body(code.Make(code.OpAdd)), "OpAdd needs 2 stack values, has 0"},
+		{"jump target", body(ins(code.Make(code.OpJump, 1), code.Make(code.OpConstant, 0)), integer), "jump to 0001 is not an instruction"},
+		{"try target", body(ins(code.Make(code.OpTry, 1), code.Make(code.OpEndTry))), "jump to 0001 is not an instruction"},
+		{"unbalanced", body(ins(
+			code.Make(code.OpTrue),
+			code.Make(code.OpJumpNotTruthy, 8),
+			code.Make(code.OpTrue),
+			code.Make(code.OpJump, 8),
+			code.Make(code.OpNull),
+			code.Make(code.OpPop),
+		)), "stack height 1 differs from 0"},
+		{"null check underflow", body(code.Make(code.OpJumpIfNull, 3)), "OpJumpIfNull needs 1 stack values, has 0"},
+		{"template underflow", body(code.Make(code.OpTemplate, 2)), "OpTemplate needs 2 stack values, has 0"},
+		{"return in main", body(code.Make(code.OpReturn)), "OpReturn outside a function"},
+		{"function locals", body(nil, []byte{tagFunction, 2, 0, 0, 1, 0, 0, 0, 0}), "bad parameter count 2"},
+		{"rest locals", body(nil, []byte{tagFunction, 1, 0, 1, 1, 0, 0, 0, 0}), "bad parameter count 1"},
+		{"default count", body(nil, []byte{tagFunction, 1, 2, 0, 1, 0, 0, 0, 0}), "bad default count 2"},
+		{"variadic flag", body(nil, []byte{tagFunction, 1, 0, 2, 1, 0, 0, 0, 0}), "bad variadic flag 2"},
+		{"passed parameter", body(nil,
+			append([]byte{tagFunction, 1, 1, 0, 1, 0, 0, 5}, ins(code.Make(code.OpJumpIfPassed, 4, 1), code.Make(code.OpReturn), []byte{0})...)),
+			"parameter 1 out of range"},
+		{"closure over integer", body(ins(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)), integer), "constant 0 is not a function"},
+		{"import integer", body(ins(code.Make(code.OpImport, 0), code.Make(code.OpPop)), integer), "constant 0 is not a module function"},
+		{"late global of integer", body(ins(code.Make(code.OpGetLateGlobal, 0, 0), code.Make(code.OpPop)), integer), "constant 0 is not a string"},
+		{"member of integer", body(ins(code.Make(code.OpNull), code.Make(code.OpMember, 0), code.Make(code.OpPop)), integer), "constant 0 is not a string"},
+		{"odd hash", body(ins(code.Make(code.OpNull), code.Make(code.OpHash, 1), code.Make(code.OpPop))), "odd hash element count 1"},
+		{"rest flag", body(ins(code.Make(code.OpArray, 0), code.Make(code.OpArrayPattern, 0, 2))), "bad rest flag 2"},
+		{"pattern underflow", body(ins(code.Make(code.OpNull), code.Make(code.OpHashPattern, 1), code.Make(code.OpPop))),
+			"OpHashPattern needs 2 stack values, has 1"},
+		{"match rest flag", body(ins(code.Make(code.OpArray, 0), code.Make(code.OpMatchArray, 1, 3))), "bad rest flag 3"},
+		{"match underflow", body(ins(code.Make(code.OpNull), code.Make(code.OpMatchHash, 1), code.Make(code.OpPop))),
+			"OpMatchHash needs 2 stack values, has 1"},
+		{"builtin", body(ins(code.Make(code.OpGetBuiltin, 200), code.Make(code.OpPop))), "builtin 200 out of range"},
+		{"free in main", body(ins(code.Make(code.OpGetFree, 0), code.Make(code.OpPop))), "OpGetFree outside a function"},
+		{"free count", body(ins(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)),
+			append([]byte{tagFunction, 0, 0, 0, 0, 0, 0, 3}, ins(code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue), []byte{0})...)),
+			"captures 0 values, it uses 1"},
+	}
+	for _, tt := range tests {
+		_, err := Decode(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want containing %q, got=%v", tt.name, tt.expected, err)
+			continue
+		}
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: error does not wrap ErrInvalid: %v", tt.name, err)
+		}
+	}
+}
+
+// TestDecodeCorrupted changes every byte of a valid file in turn, fixing up
+// the checksum, and checks that neither Decode nor running what it accepts
+// panics. The step limit stops programs the corruption made loop forever.
+func TestDecodeCorrupted(t *testing.T) {
+	valid, err := Encode(compile(t, `let add = fn(a, b) { let c = a + b; c * 2 }; add(1, 2) == 6`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := valid[:len(valid)-4]
+	for i := range body {
+		for _, delta := range []byte{1, 0x80, 0xff} {
+			corrupted := append([]byte{}, body...)
+			corrupted[i] += delta
+			bytecode, err := Decode(seal(corrupted))
+			if err != nil {
+				continue
+			}
+			machine := vm.New(bytecode)
+			machine.RunContext(context.Background(), limits.Config{MaxSteps: 100000})
+		}
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	bytecode := &compiler.Bytecode{Constants: []object.Object{&object.Null{}}}
+	if _, err := Encode(bytecode); err == nil || !strings.Contains(err.Error(), "cannot encode constant 0 of type NULL") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+// seal appends the checksum of body.
+func seal(body []byte) []byte {
+	sum := crc32.ChecksumIEEE(body)
+	return append(append([]byte{}, body...), byte(sum>>24), byte(sum>>16), byte(sum>>8), byte(sum))
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+	return compileFile(t, "", input)
+}
+
+// compileFile compiles input as the contents of the file name.
+func compileFile(t *testing.T, name, input string) *compiler.Bytecode {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	program.File = name
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func run(bytecode *compiler.Bytecode) string {
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		return "ERROR: " + err.Error()
+	}
+	if last := machine.LastPoppedStackElem(); last != nil {
+		return last.Inspect()
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+// Package modules finds, reads and parses the files Monkey programs import.
+// The evaluator and the compiler share it so that both resolve imports and
+// report failures to load them the same way.
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/parser"
+)
+
+// Resolve returns the path of the file imported as path by the file
+// importer. A relative path is relative to the directory of the importer;
+// a program read from no file imports relative to the current directory.
+func Resolve(importer, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(filepath.Dir(importer), path)
+}
+
+// CycleError reports a file that imports itself, directly or through the
+// files it imports.
+type CycleError struct {
+	// Path lists the files of the cycle in import order. The first and last
+	// are the same file.
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return "import cycle: " + strings.Join(e.Path, " -> ")
+}
+
+// Loader loads the files imported while a program runs or is compiled. It
+// keeps track of the files being loaded, which import each other in turn,
+// to detect cycles.
+type Loader struct {
+	loading []string
+}
+
+// NewLoader returns a loader for the imports of the program read from the
+// file root, which is empty for a program read from no file.
+func NewLoader(root string) *Loader {
+	l := &Loader{}
+	if root != "" {
+		l.loading = append(l.loading, filepath.Clean(root))
+	}
+	return l
+}
+
+// Enter starts loading the file at path, a path returned by Resolve, and
+// returns its program. Every successful call must be followed by a call to
+// Leave once the module is loaded.
+//
+// Enter fails with a *CycleError if path is already being loaded. A file
+// that cannot be read or parsed, or that has a return statement outside a
+// function, cannot be imported.
+func (l *Loader) Enter(path string) (*ast.Program, error) {
+	for i, loading := range l.loading {
+		if loading == path {
+			cycle := append(append([]string{}, l.loading[i:]...), path)
+			return nil, &CycleError{Path: cycle}
+		}
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return nil, fmt.Errorf("cannot import %s: %v", path, err)
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("cannot import %s: %s", path, strings.Join(p.Errors(), "; "))
+	}
+	if hasTopLevelReturn(program) {
+		return nil, fmt.Errorf("cannot import %s: return statement outside a function", path)
+	}
+	program.File = path
+	l.loading = append(l.loading, path)
+	return program, nil
+}
+
+// Leave ends loading the file entered last.
+func (l *Loader) Leave() {
+	l.loading = l.loading[:len(l.loading)-1]
+}
+
+// hasTopLevelReturn reports whether program has a return statement outside
+// a function. A module runs to its end, where its exports are collected, so
+// it cannot return.
+func hasTopLevelReturn(program *ast.Program) bool {
+	found := false
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		switch c.Node().(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.ReturnStatement:
+			found = true
+		}
+		return !found
+	}, nil)
+	return found
+}
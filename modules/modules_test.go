@@ -0,0 +1,81 @@
+package modules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		importer, path, expected string
+	}{
+		{"", "lib.mk", "lib.mk"},
+		{"main.mk", "lib.mk", "lib.mk"},
+		{"src/main.mk", "lib.mk", "src/lib.mk"},
+		{"src/main.mk", "../lib/./util.mk", "lib/util.mk"},
+		{"src/main.mk", "/opt/lib.mk", "/opt/lib.mk"},
+		{"src/main.mk", "/opt/../lib.mk", "/lib.mk"},
+	}
+	for _, tt := range tests {
+		if got := Resolve(tt.importer, tt.path); got != tt.expected {
+			t.Errorf("Resolve(%q, %q) wrong. want=%q, got=%q", tt.importer, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestLoader(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.mk":   `import "a.mk" as a;`,
+		"a.mk":      `export let x = 1;`,
+		"broken.mk": `let 1;`,
+		"return.mk": "let f = fn() { return 1; };\nreturn f();",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	l := NewLoader(path("main.mk"))
+	program, err := l.Enter(path("a.mk"))
+	if err != nil {
+		t.Fatalf("Enter failed: %v", err)
+	}
+	if program.File != path("a.mk") || program.String() != "export let x = 1;" {
+		t.Errorf("wrong program: file=%q, %q", program.File, program.String())
+	}
+
+	_, err = l.Enter(path("main.mk"))
+	var cycle *CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("importing main.mk from a.mk is not a cycle: %v", err)
+	}
+	if expected := []string{path("main.mk"), path("a.mk"), path("main.mk")}; !reflect.DeepEqual(cycle.Path, expected) {
+		t.Errorf("wrong cycle. want=%q, got=%q", expected, cycle.Path)
+	}
+
+	l.Leave()
+	if _, err := l.Enter(path("a.mk")); err != nil {
+		t.Errorf("entering a.mk again after leaving it failed: %v", err)
+	}
+	l.Leave()
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"missing.mk", "cannot import " + path("missing.mk") + ": no such file or directory"},
+		{"broken.mk", "cannot import " + path("broken.mk") + ": line 1, column 5: expected next token to be IDENT, got INT instead"},
+		{"return.mk", "cannot import " + path("return.mk") + ": return statement outside a function"},
+	}
+	for _, tt := range tests {
+		if _, err := l.Enter(path(tt.name)); err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package monkey
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/kellemNegasi/monkeylang/evaluator"
+	"github.com/kellemNegasi/monkeylang/object"
+)
+
+// monkeyValue names the target of conversions to Monkey in errors.
+const monkeyValue = "Monkey value"
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToObject converts a Go value to a Monkey value. Values that already are
+// Monkey values are returned as they are.
+func ToObject(value interface{}) (object.Object, error) {
+	return toObject(reflect.ValueOf(value))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	if !v.IsValid() {
+		return evaluator.NULL, nil
+	}
+	if v.Type().Implements(objectType) {
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return v.Interface().(object.Object), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u <= 1<<63-1 {
+			return &object.Integer{Value: int64(u)}, nil
+		}
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Interface:
+		return toObject(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			e, err := toObject(v.Index(i))
+			if err != nil {
+				return nil, inside(err, "["+strconv.Itoa(i)+"]")
+			}
+			elements[i] = e
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		// Go maps are unordered, so the keys are sorted to give the hash a
+		// deterministic order.
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		hash := object.NewHash(len(keys))
+		for _, k := range keys {
+			key := k.String()
+			value, err := toObject(v.MapIndex(k))
+			if err != nil {
+				return nil, inside(err, "["+strconv.Quote(key)+"]")
+			}
+			hash.Set(&object.String{Value: key}, value)
+		}
+		return hash, nil
+	}
+	return nil, &ConversionError{From: v.Type().String(), To: monkeyValue}
+}
+
+// FromObject converts a Monkey value to its natural Go value: an int64, a
+// bool, a string, nil, a []interface{} or a map[string]interface{}.
+func FromObject(obj object.Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, e := range obj.Elements {
+			value, err := FromObject(e)
+			if err != nil {
+				return nil, inside(err, "["+strconv.Itoa(i)+"]")
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *object.Hash:
+		pairs := make(map[string]interface{}, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key, err := stringKey(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := FromObject(pair.Value)
+			if err != nil {
+				return nil, inside(err, "["+strconv.Quote(key)+"]")
+			}
+			pairs[key] = value
+		}
+		return pairs, nil
+	}
+	return nil, &ConversionError{From: string(obj.Type()), To: "Go value"}
+}
+
+// toGo converts obj to a Go value of type t.
+func toGo(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t == objectType {
+		return reflect.ValueOf(&obj).Elem(), nil
+	}
+	fail := &ConversionError{From: string(obj.Type()), To: t.String()}
+	if _, ok := obj.(*object.Null); ok {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fail
+	}
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			return reflect.Value{}, fail
+		}
+		value, err := FromObject(obj)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.Set(reflect.ValueOf(value))
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return reflect.Value{}, fail
+		}
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*object.Integer)
+		if !ok || v.OverflowInt(i.Value) {
+			return reflect.Value{}, fail
+		}
+		v.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*object.Integer)
+		if !ok || i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return reflect.Value{}, fail
+		}
+		v.SetUint(uint64(i.Value))
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return reflect.Value{}, fail
+		}
+		v.SetString(s.Value)
+	case reflect.Slice:
+		a, ok := obj.(*object.Array)
+		if !ok {
+			return reflect.Value{}, fail
+		}
+		v.Set(reflect.MakeSlice(t, len(a.Elements), len(a.Elements)))
+		for i, e := range a.Elements {
+			element, err := toGo(e, t.Elem())
+			if err != nil {
+				return reflect.Value{}, inside(err, "["+strconv.Itoa(i)+"]")
+			}
+			v.Index(i).Set(element)
+		}
+	case reflect.Map:
+		h, ok := obj.(*object.Hash)
+		if !ok || t.Key().Kind() != reflect.String {
+			return reflect.Value{}, fail
+		}
+		v.Set(reflect.MakeMapWithSize(t, h.Len()))
+		for _, pair := range h.Pairs() {
+			key, err := stringKey(pair.Key)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := toGo(pair.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, inside(err, "["+strconv.Quote(key)+"]")
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), value)
+		}
+	default:
+		return reflect.Value{}, fail
+	}
+	return v, nil
+}
+
+// inside returns err, a conversion error of the element at path of a value,
+// as the error of the value.
+func inside(err error, path string) error {
+	if ce, ok := err.(*ConversionError); ok {
+		ce.Path = path + ce.Path
+	}
+	return err
+}
+
+// stringKey returns key, a key of a hash converted to a Go map, as a string.
+func stringKey(key object.Hashable) (string, error) {
+	s, ok := key.(*object.String)
+	if !ok {
+		return "", &ConversionError{From: string(key.Type()), To: "string", Path: "[" + key.Inspect() + "]"}
+	}
+	return s.Value, nil
+}
+
+// newHostFunction returns a builtin calling fn, converting its arguments and
+// results as described by Register.
+func newHostFunction(name string, value interface{}) (*object.Builtin, error) {
+	fn := reflect.ValueOf(value)
+	if fn.Kind() != reflect.Func || fn.IsNil() {
+		return nil, &RegisterError{Name: name, Reason: fmt.Sprintf("%T is not a function", value)}
+	}
+	t := fn.Type()
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	numValues := t.NumOut()
+	if returnsError {
+		numValues--
+	}
+	if numValues > 1 {
+		return nil, &RegisterError{Name: name, Reason: fmt.Sprintf("%v returns more than one value", t)}
+	}
+
+	// params is the number of fixed parameters, which a variadic function
+	// may be given more arguments than.
+	params := t.NumIn()
+	if t.IsVariadic() {
+		params--
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		paramType := t.In(i)
+		if i == params {
+			paramType = paramType.Elem()
+		}
+		if !convertsToGo(paramType, map[reflect.Type]bool{}) {
+			return nil, &RegisterError{Name: name, Reason: fmt.Sprintf("cannot convert a Monkey value to %v, the type of parameter %d", paramType, i+1)}
+		}
+	}
+	if numValues == 1 && !convertsToObject(t.Out(0), map[reflect.Type]bool{}) {
+		return nil, &RegisterError{Name: name, Reason: fmt.Sprintf("cannot convert %v, the type of the result, to a Monkey value", t.Out(0))}
+	}
+
+	call := func(args ...object.Object) (result object.Object) {
+		// A panic in fn fails the call rather than the whole program.
+		defer func() {
+			if r := recover(); r != nil {
+				err, _ := r.(error)
+				result = &object.Error{Message: fmt.Sprintf("%s panicked: %v", name, r), Err: err}
+			}
+		}()
+		if len(args) < params || !t.IsVariadic() && len(args) > params {
+			return &object.Error{Message: object.ArityMessage(name, params, 0, t.IsVariadic(), len(args))}
+		}
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if i < params {
+				paramType = t.In(i)
+			} else {
+				paramType = t.In(params).Elem()
+			}
+			v, err := toGo(arg, paramType)
+			if err != nil {
+				return hostError(err, name, i+1)
+			}
+			in[i] = v
+		}
+		out := fn.Call(in)
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return &object.Error{Message: err.Error(), Err: err}
+			}
+		}
+		if numValues == 0 {
+			return evaluator.NULL
+		}
+		result, err := toObject(out[0])
+		if err != nil {
+			return hostError(err, name, 0)
+		}
+		return result
+	}
+	return &object.Builtin{Fn: call}, nil
+}
+
+// convertsToGo reports whether toGo can convert Monkey values to type t.
+// seen holds the types being checked, whose values may contain their own.
+func convertsToGo(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t == objectType || seen[t] {
+		return true
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Interface:
+		return t.NumMethod() == 0
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Slice:
+		return convertsToGo(t.Elem(), seen)
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && convertsToGo(t.Elem(), seen)
+	}
+	return false
+}
+
+// convertsToObject reports whether toObject can convert values of type t,
+// which it may still fail to do for some of them, such as interfaces holding
+// values of other types or integers too large for Monkey.
+func convertsToObject(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t.Implements(objectType) || seen[t] {
+		return true
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Interface, reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Slice, reflect.Array:
+		return convertsToObject(t.Elem(), seen)
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && convertsToObject(t.Elem(), seen)
+	}
+	return false
+}
+
+// hostError returns the runtime error for a failed conversion of argument
+// arg, or of the result if arg is 0, of the host function name.
+func hostError(err error, name string, arg int) *object.Error {
+	if ce, ok := err.(*ConversionError); ok {
+		ce.Func, ce.Arg = name, arg
+	}
+	return &object.Error{Message: err.Error(), Err: err}
+}
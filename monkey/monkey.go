@@ -0,0 +1,182 @@
+// Package monkey embeds the Monkey language in Go programs.
+//
+// An Interpreter evaluates source code in a global environment that persists
+// between evaluations. Go values become Monkey globals with Set, Go functions
+// become builtins with Register, and the values of programs come back as Go
+// values:
+//
+//	in := monkey.New()
+//	in.Set("limit", 10)
+//	in.Register("double", func(n int64) int64 { return 2 * n })
+//	v, err := in.Eval("double(limit) + 1") // int64(21), nil
+//
+// Values convert between the two languages as follows:
+//
+//	Monkey     Go
+//	INTEGER    int64 (any integer type as an argument or global)
+//	BOOLEAN    bool
+//	STRING     string
+//	NULL       nil
+//	ARRAY      []interface{} (any slice or array type as an argument or global)
+//	HASH       map[string]interface{} (any map with string keys as an argument or global)
+//
+// Only hashes whose keys are all strings convert to Go maps. Go maps become
+// hashes with their keys in sorted order.
+// Values of other types cannot be converted and yield a *ConversionError.
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/evaluator"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/limits"
+	"github.com/kellemNegasi/monkeylang/object"
+	"github.com/kellemNegasi/monkeylang/parser"
+)
+
+// Interpreter evaluates Monkey programs sharing a global environment. It runs
+// them with the evaluator and is not safe for concurrent use.
+type Interpreter struct {
+	env *object.Environment
+}
+
+// New returns an interpreter with an empty global environment.
+func New() *Interpreter {
+	return &Interpreter{env: object.NewEnvironment()}
+}
+
+// Set binds the global name to the conversion of value. A function value is
+// registered as with Register.
+func (in *Interpreter) Set(name string, value interface{}) error {
+	if reflect.ValueOf(value).Kind() == reflect.Func {
+		return in.Register(name, value)
+	}
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+	in.env.Set(name, obj)
+	return nil
+}
+
+// Register binds the global name to a builtin calling fn, which must be a Go
+// function. Its arguments are converted from the Monkey values the function is
+// called with, and its result back to a Monkey value. fn may return nothing, a
+// value, an error, or a value and an error; a non-nil error fails the call
+// with a runtime error wrapping it, and so does a panic in fn. Registering
+// anything else, or a function with a parameter or result of a type that does
+// not convert, fails with a *RegisterError.
+func (in *Interpreter) Register(name string, fn interface{}) error {
+	builtin, err := newHostFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	in.env.Set(name, builtin)
+	return nil
+}
+
+// SetOutput makes the puts builtin of the interpreter print to w rather than
+// to object.Output.
+func (in *Interpreter) SetOutput(w io.Writer) {
+	in.env.Set("puts", object.NewPuts(w))
+}
+
+// Eval evaluates src and returns the value of its last statement converted
+// to a Go value, or nil for a statement producing none.
+func (in *Interpreter) Eval(src string) (interface{}, error) {
+	return in.EvalContext(context.Background(), src, limits.Config{})
+}
+
+// EvalContext is like Eval but stops when ctx is done or the program exceeds
+// a limit of config, returning the error of package limits describing why.
+func (in *Interpreter) EvalContext(ctx context.Context, src string, config limits.Config) (interface{}, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+	result, err := evaluator.EvalContext(ctx, program, in.env, config)
+	if err != nil {
+		return nil, err
+	}
+	if failure, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Message: failure.Message, Err: failure.Err, Trace: failure.Trace}
+	}
+	return FromObject(result)
+}
+
+// ParseError reports syntax errors in the source of a program.
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + strings.Join(e.Errors, "; ")
+}
+
+// RuntimeError reports that a program failed while it was evaluated.
+type RuntimeError struct {
+	Message string
+	// Err is the error behind the failure if a host function reported one,
+	// such as a *ConversionError for an argument of the wrong type.
+	Err error
+	// Trace lists the Monkey function calls being evaluated when the error
+	// occurred, innermost first. The top level of the program is named
+	// object.MainFunction and functions not bound by let
+	// object.AnonymousFunction. A function whose last action is a call is
+	// replaced by the function it calls, so it is not part of the trace.
+	Trace []object.Frame
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+
+// StackTrace returns the message of the error followed by its trace, one
+// frame per line.
+func (e *RuntimeError) StackTrace() string { return object.FormatTrace(e.Message, e.Trace) }
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// RegisterError reports a Go value that cannot be registered as a builtin.
+type RegisterError struct {
+	Name   string // the name it was to be bound to
+	Reason string
+}
+
+func (e *RegisterError) Error() string {
+	return "monkey: cannot register " + e.Name + ": " + e.Reason
+}
+
+// ConversionError reports a value that cannot be converted between Monkey
+// and Go.
+type ConversionError struct {
+	From string // the Monkey type or Go type of the value
+	To   string // the type it was converted to
+	// Path locates the value inside the converted one, e.g. `[2]` or
+	// `["key"]`, if it is an element of an array or hash, or is a key of a
+	// hash that is not a string.
+	Path string
+	// Func is the host function whose argument or result was converted, if
+	// any, and Arg the 1-based index of the argument, or 0 for the result.
+	Func string
+	Arg  int
+}
+
+func (e *ConversionError) Error() string {
+	var out strings.Builder
+	switch {
+	case e.Func != "" && e.Arg > 0:
+		fmt.Fprintf(&out, "argument %d to %s: ", e.Arg, e.Func)
+	case e.Func != "":
+		fmt.Fprintf(&out, "result of %s: ", e.Func)
+	}
+	if e.Path != "" {
+		fmt.Fprintf(&out, "element %s: ", e.Path)
+	}
+	fmt.Fprintf(&out, "cannot convert %s to %s", e.From, e.To)
+	return out.String()
+}
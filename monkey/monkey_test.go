@@ -0,0 +1,315 @@
+package monkey_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kellemNegasi/monkeylang/limits"
+	"github.com/kellemNegasi/monkeylang/monkey"
+	"github.com/kellemNegasi/monkeylang/object"
+)
+
+func TestGlobals(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{42, int64(42)},
+		{uint8(7), int64(7)},
+		{"hello", "hello"},
+		{[]int{1, 2}, []interface{}{int64(1), int64(2)}},
+		{[2]string{"a", "b"}, []interface{}{"a", "b"}},
+		{map[string]interface{}{"n": 1, "list": []bool{true}},
+			map[string]interface{}{"n": int64(1), "list": []interface{}{true}}},
+	}
+	for _, tt := range tests {
+		in := monkey.New()
+		if err := in.Set("x", tt.value); err != nil {
+			t.Fatalf("Set(%#v) failed: %v", tt.value, err)
+		}
+		got, err := in.Eval("x")
+		if err != nil {
+			t.Fatalf("Eval failed for %#v: %v", tt.value, err)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("wrong value for %#v. want=%#v, got=%#v", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestGlobalsPersist(t *testing.T) {
+	in := monkey.New()
+	if _, err := in.Eval("let add = fn(a, b) { a + b };"); err != nil {
+		t.Fatal(err)
+	}
+	in.Set("n", 2)
+	got, err := in.Eval("add(n, 40)")
+	if err != nil || got != int64(42) {
+		t.Errorf("wrong result. want=42, got=%#v (%v)", got, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	in := monkey.New()
+	register := func(name string, fn interface{}) {
+		t.Helper()
+		if err := in.Register(name, fn); err != nil {
+			t.Fatalf("Register(%s) failed: %v", name, err)
+		}
+	}
+	register("double", func(n int64) int64 { return 2 * n })
+	register("small", func(n int8) int8 { return n })
+	register("join", func(sep string, parts ...string) string { return strings.Join(parts, sep) })
+	register("sum", func(xs []int) int {
+		total := 0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	})
+	register("keys", func(m map[string]int) int { return len(m) })
+	register("not", func(b bool) bool { return !b })
+	register("nothing", func() {})
+	register("check", func(n int) (int, error) {
+		if n < 0 {
+			return 0, errors.New("negative input")
+		}
+		return n, nil
+	})
+	register("range", func(n int) []int {
+		xs := make([]int, n)
+		for i := range xs {
+			xs[i] = i
+		}
+		return xs
+	})
+	register("describe", func(v interface{}) string { return fmt.Sprintf("%T", v) })
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"double(21)", int64(42)},
+		{"small(-128)", int64(-128)},
+		{`join(", ", "a", "b", "c")`, "a, b, c"},
+		{`join("-")`, ""},
+		{"sum(range(5))", int64(10)},
+		{"not(1 > 2)", true},
+		{"nothing()", nil},
+		{"check(3)", int64(3)},
+		{"describe(range(1))", "[]interface {}"},
+		{"let f = fn(g) { g(1) }; f(double)", int64(2)},
+	}
+	for _, tt := range tests {
+		got, err := in.Eval(tt.input)
+		if err != nil {
+			t.Errorf("Eval(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Eval(%q) wrong. want=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestConversionErrors(t *testing.T) {
+	in := monkey.New()
+	in.Register("double", func(n int64) int64 { return 2 * n })
+	in.Register("small", func(n int8) int8 { return n })
+	in.Register("sum", func(xs []int) int { return len(xs) })
+	in.Register("lookup", func(m map[string]string) int { return len(m) })
+	in.Register("channel", func() interface{} { return make(chan int) })
+	in.Set("ints", []int{1, 2})
+	in.Set("hash", map[string]interface{}{"a": "x", "b": 2})
+
+	tests := []struct {
+		input    string
+		expected monkey.ConversionError
+		message  string
+	}{
+		{`double("x")`, monkey.ConversionError{From: "STRING", To: "int64", Func: "double", Arg: 1},
+			"argument 1 to double: cannot convert STRING to int64"},
+		{"small(128)", monkey.ConversionError{From: "INTEGER", To: "int8", Func: "small", Arg: 1},
+			"argument 1 to small: cannot convert INTEGER to int8"},
+		{"sum(true)", monkey.ConversionError{From: "BOOLEAN", To: "[]int", Func: "sum", Arg: 1},
+			"argument 1 to sum: cannot convert BOOLEAN to []int"},
+		{"lookup(hash)", monkey.ConversionError{From: "INTEGER", To: "string", Path: `["b"]`, Func: "lookup", Arg: 1},
+			`argument 1 to lookup: element ["b"]: cannot convert INTEGER to string`},
+		{"double(fn() {})", monkey.ConversionError{From: "FUNCTION", To: "int64", Func: "double", Arg: 1},
+			"argument 1 to double: cannot convert FUNCTION to int64"},
+		{"channel()", monkey.ConversionError{From: "chan int", To: "Monkey value", Func: "channel"},
+			"result of channel: cannot convert chan int to Monkey value"},
+		{"fn() {}", monkey.ConversionError{From: "FUNCTION", To: "Go value"},
+			"cannot convert FUNCTION to Go value"},
+	}
+	for _, tt := range tests {
+		_, err := in.Eval(tt.input)
+		var ce *monkey.ConversionError
+		if !errors.As(err, &ce) {
+			t.Errorf("Eval(%q) error is not a *ConversionError: %#v", tt.input, err)
+			continue
+		}
+		if *ce != tt.expected {
+			t.Errorf("Eval(%q) wrong error. want=%+v, got=%+v", tt.input, tt.expected, *ce)
+		}
+		if err.Error() != tt.message {
+			t.Errorf("Eval(%q) wrong message. want=%q, got=%q", tt.input, tt.message, err.Error())
+		}
+	}
+
+	if err := in.Set("c", make(chan int)); err == nil || err.Error() != "cannot convert chan int to Monkey value" {
+		t.Errorf("Set of a channel gave wrong error: %v", err)
+	}
+	if err := in.Set("m", map[int]int{1: 1}); err == nil {
+		t.Errorf("Set of a map with integer keys succeeded")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	in := monkey.New()
+	in.Register("double", func(n int64) int64 { return 2 * n })
+	failure := errors.New("negative input")
+	in.Register("check", func(n int) error {
+		if n < 0 {
+			return failure
+		}
+		return nil
+	})
+
+	_, err := in.Eval("double(1, 2)")
+	var re *monkey.RuntimeError
+	if !errors.As(err, &re) || re.Message != "wrong number of arguments to double: want=1, got=2" {
+		t.Errorf("wrong arity error: %v", err)
+	}
+	if _, err := in.Eval("check(-1)"); !errors.Is(err, failure) {
+		t.Errorf("host function error not returned: %v", err)
+	}
+	if _, err := in.Eval("1 + true"); !errors.As(err, &re) || re.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong runtime error: %v", err)
+	}
+	_, err = in.Eval("let half = fn(n) { n / 0 };\nlet f = fn() { 1 + half(4) };\nf()")
+	trace := []object.Frame{
+		{Function: "half", Line: 1, Column: 22},
+		{Function: "f", Line: 2, Column: 24},
+		{Function: object.MainFunction, Line: 3, Column: 2},
+	}
+	if !errors.As(err, &re) || !reflect.DeepEqual(re.Trace, trace) {
+		t.Errorf("wrong trace: %#v", err)
+	}
+	if expected := "division by zero\n\tat half (1:22)\n\tat f (2:24)\n\tat <main> (3:2)"; re.StackTrace() != expected {
+		t.Errorf("wrong stack trace.\nwant=%q\ngot= %q", expected, re.StackTrace())
+	}
+	var pe *monkey.ParseError
+	if _, err := in.Eval("let = 1"); !errors.As(err, &pe) || len(pe.Errors) == 0 {
+		t.Errorf("wrong parse error: %v", err)
+	}
+	for _, tt := range []struct {
+		fn      interface{}
+		message string
+	}{
+		{1, "monkey: cannot register f: int is not a function"},
+		{func() (int, int) { return 0, 0 }, "monkey: cannot register f: func() (int, int) returns more than one value"},
+		{func(*int) {}, "monkey: cannot register f: cannot convert a Monkey value to *int, the type of parameter 1"},
+		{func(int, ...[2]int) {}, "monkey: cannot register f: cannot convert a Monkey value to [2]int, the type of parameter 2"},
+		{func(map[int]string) {}, "monkey: cannot register f: cannot convert a Monkey value to map[int]string, the type of parameter 1"},
+		{func() float64 { return 0 }, "monkey: cannot register f: cannot convert float64, the type of the result, to a Monkey value"},
+		{func() ([]chan int, error) { return nil, nil }, "monkey: cannot register f: cannot convert []chan int, the type of the result, to a Monkey value"},
+	} {
+		err := in.Register("f", tt.fn)
+		var re *monkey.RegisterError
+		if !errors.As(err, &re) || re.Name != "f" || err.Error() != tt.message {
+			t.Errorf("Register of %T gave wrong error. want=%q, got=%v", tt.fn, tt.message, err)
+		}
+	}
+	type tree []tree
+	if err := in.Register("f", func(t tree) tree { return t }); err != nil {
+		t.Errorf("Register of a recursive type failed: %v", err)
+	}
+
+	panicking := errors.New("boom")
+	in.Register("pan", func(n int) int {
+		if n > 0 {
+			panic(panicking)
+		}
+		panic("no")
+	})
+	if _, err := in.Eval("pan(1)"); !errors.As(err, &re) || re.Message != "pan panicked: boom" || !errors.Is(err, panicking) {
+		t.Errorf("wrong error from a panicking host function: %v", err)
+	}
+	if v, err := in.Eval(`try { pan(0) } catch (e) { e.message }`); err != nil || v != "pan panicked: no" {
+		t.Errorf("panic in a host function not caught: %v, %v", v, err)
+	}
+
+	_, err = in.EvalContext(context.Background(), "let f = fn() { f() }; f()", limits.Config{MaxSteps: 100})
+	var se *limits.StepError
+	if !errors.As(err, &se) {
+		t.Errorf("step limit not enforced: %v", err)
+	}
+	for _, input := range []string{
+		`let f = fn(s) { f(str([s, s])) }; f("a")`,
+		`let f = fn(xs) { f(push(xs, xs)) }; f([])`,
+	} {
+		_, err = in.EvalContext(context.Background(), input, limits.Config{MaxAlloc: 1 << 20})
+		var ae *limits.AllocError
+		if !errors.As(err, &ae) {
+			t.Errorf("allocation limit not enforced for %q: %v", input, err)
+		}
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	in := monkey.New()
+	var out strings.Builder
+	in.SetOutput(&out)
+	if _, err := in.Eval(`puts("hello", [1, 2])`); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello\n[1, 2]\n" {
+		t.Errorf("puts wrote %q", out.String())
+	}
+}
+
+func TestArrays(t *testing.T) {
+	in := monkey.New()
+	in.Set("xs", []int{3, 4})
+	got, err := in.Eval("push(xs, xs[0] + xs[1])")
+	if err != nil || !reflect.DeepEqual(got, []interface{}{int64(3), int64(4), int64(7)}) {
+		t.Errorf("wrong result: %#v (%v)", got, err)
+	}
+}
+
+func TestHashes(t *testing.T) {
+	in := monkey.New()
+	in.Set("m", map[string]int{"b": 2, "a": 1, "c": 3})
+	got, err := in.Eval(`puts(m); m["a"] + m["c"]`)
+	if err != nil || got != int64(4) {
+		t.Errorf("wrong result: %#v (%v)", got, err)
+	}
+
+	in.Register("size", func(m map[string]int) int { return len(m) })
+	_, err = in.Eval(`size({"a": 1, 2: 2})`)
+	var ce *monkey.ConversionError
+	if !errors.As(err, &ce) || err.Error() != "argument 1 to size: element [2]: cannot convert INTEGER to string" {
+		t.Errorf("wrong error for an integer key: %v", err)
+	}
+}
+
+func Example() {
+	in := monkey.New()
+	in.Set("limit", 10)
+	in.Register("double", func(n int64) int64 { return 2 * n })
+	v, err := in.Eval("double(limit) + 1")
+	fmt.Println(v, err)
+
+	_, err = in.Eval(`double("ten")`)
+	fmt.Println(err)
+	// Output:
+	// 21 <nil>
+	// argument 1 to double: cannot convert STRING to int64
+}
@@ -0,0 +1,200 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Output is the writer puts prints to.
+var Output io.Writer = os.Stdout
+
+// Builtins lists the builtin functions shared by the evaluator and the
+// virtual machine. The compiler refers to them by their index, so new
+// builtins must be appended.
+//
+// Builtins never modify their arguments: first, last, rest and push return
+// new values. Those returning null return nil, which each engine turns into
+// its null value.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{Fn: func(args ...Object) Object {
+			if err := checkArity("len", args, 1); err != nil {
+				return err
+			}
+			switch arg := args[0].(type) {
+			case *String:
+				return &Integer{Value: int64(len(arg.Value))}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *Hash:
+				return &Integer{Value: int64(arg.Len())}
+			default:
+				return argumentError("len", 1, "STRING, ARRAY or HASH", arg)
+			}
+		}},
+	},
+	{
+		"puts",
+		metered(func(m Meter, args ...Object) (Object, error) {
+			return puts(Output, m, args)
+		}),
+	},
+	{
+		"first",
+		&Builtin{Fn: func(args ...Object) Object {
+			array, err := arrayArgument("first", args)
+			if err != nil {
+				return err
+			}
+			if len(array.Elements) == 0 {
+				return nil
+			}
+			return array.Elements[0]
+		}},
+	},
+	{
+		"last",
+		&Builtin{Fn: func(args ...Object) Object {
+			array, err := arrayArgument("last", args)
+			if err != nil {
+				return err
+			}
+			if len(array.Elements) == 0 {
+				return nil
+			}
+			return array.Elements[len(array.Elements)-1]
+		}},
+	},
+	{
+		"rest",
+		&Builtin{Fn: func(args ...Object) Object {
+			array, err := arrayArgument("rest", args)
+			if err != nil {
+				return err
+			}
+			if len(array.Elements) == 0 {
+				return nil
+			}
+			elements := make([]Object, len(array.Elements)-1)
+			copy(elements, array.Elements[1:])
+			return &Array{Elements: elements}
+		}},
+	},
+	{
+		"push",
+		&Builtin{Fn: func(args ...Object) Object {
+			if err := checkArity("push", args, 2); err != nil {
+				return err
+			}
+			array, ok := args[0].(*Array)
+			if !ok {
+				return argumentError("push", 1, "ARRAY", args[0])
+			}
+			elements := make([]Object, len(array.Elements)+1)
+			copy(elements, array.Elements)
+			elements[len(array.Elements)] = args[1]
+			return &Array{Elements: elements}
+		}},
+	},
+	{
+		"type",
+		&Builtin{Fn: func(args ...Object) Object {
+			if err := checkArity("type", args, 1); err != nil {
+				return err
+			}
+			return &String{Value: string(args[0].Type())}
+		}},
+	},
+	{
+		"str",
+		metered(func(m Meter, args ...Object) (Object, error) {
+			if err := checkArity("str", args, 1); err != nil {
+				return err, nil
+			}
+			if s, ok := args[0].(*String); ok {
+				return s, nil
+			}
+			text, err := InspectMetered(args[0], m)
+			if err != nil {
+				return nil, err
+			}
+			return &String{Value: text}, nil
+		}),
+	},
+}
+
+// NewPuts returns a puts builtin printing to w instead of Output.
+func NewPuts(w io.Writer) *Builtin {
+	return metered(func(m Meter, args ...Object) (Object, error) {
+		return puts(w, m, args)
+	})
+}
+
+// puts prints each of args on its own line, inspecting them with m.
+func puts(w io.Writer, m Meter, args []Object) (Object, error) {
+	for _, arg := range args {
+		text, err := InspectMetered(arg, m)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(w, text)
+	}
+	return nil, nil
+}
+
+// metered returns a builtin calling fn, whose Fn calls it without a meter.
+func metered(fn MeteredFunction) *Builtin {
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			result, _ := fn(nil, args...)
+			return result
+		},
+		Metered: fn,
+	}
+}
+
+// GetBuiltinByName returns the builtin called name, or nil if there is none.
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// checkArity returns an error if the builtin name was not called with want
+// arguments.
+func checkArity(name string, args []Object, want int) *Error {
+	if len(args) != want {
+		return newError("wrong number of arguments to %s: want=%d, got=%d", name, want, len(args))
+	}
+	return nil
+}
+
+// argumentError reports that argument number n, counting from 1, of the
+// builtin name does not have one of the types described by want.
+func argumentError(name string, n int, want string, got Object) *Error {
+	return newError("argument %d to %s must be %s, got %s", n, name, want, got.Type())
+}
+
+// arrayArgument returns the single array argument of the builtin name.
+func arrayArgument(name string, args []Object) (*Array, *Error) {
+	if err := checkArity(name, args, 1); err != nil {
+		return nil, err
+	}
+	array, ok := args[0].(*Array)
+	if !ok {
+		return nil, argumentError(name, 1, "ARRAY", args[0])
+	}
+	return array, nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
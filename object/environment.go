@@ -0,0 +1,43 @@
+package object
+
+// Environment binds names to values. Environments nest: a name not found
+// in an environment is looked up in the one enclosing it.
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+}
+
+// NewEnvironment returns an empty top-level environment.
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+// NewEnclosedEnvironment returns an empty environment nested in outer.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Get returns the value bound to name in env or in an enclosing environment.
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Set binds name to val in env.
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// SetAll binds in env the names bound in other itself, not in the
+// environments enclosing it, to their values there.
+func (e *Environment) SetAll(other *Environment) {
+	for name, val := range other.store {
+		e.store[name] = val
+	}
+}
@@ -0,0 +1,93 @@
+package object
+
+import "strings"
+
+// inspectChunk is the number of bytes written between two checks of the
+// meter while inspecting a value.
+const inspectChunk = 4096
+
+// Meter is the part of an execution's meter that bounds the conversion of
+// values to strings. A *limits.Meter is one.
+type Meter interface {
+	// Alloc counts the allocation of n bytes.
+	Alloc(n int64) error
+	// Canceled reports the cancellation of the execution.
+	Canceled() error
+}
+
+// InspectMetered returns obj.Inspect(), charging m for the string as it
+// grows and checking m for cancellation, so that inspecting a value whose
+// text is too large to build stops with the error m returns. A nil m
+// checks nothing.
+func InspectMetered(obj Object, m Meter) (string, error) {
+	in := inspector{meter: m}
+	in.inspect(obj)
+	if in.err != nil {
+		return "", in.err
+	}
+	return in.out.String(), nil
+}
+
+// inspector builds the text of a value, arrays and hashes included, without
+// building the text of their elements separately. It keeps the parts left to
+// write on a stack of its own, so that values nested however deep do not
+// overflow the Go stack.
+type inspector struct {
+	out     strings.Builder
+	meter   Meter
+	charged int // the length of out already charged to meter
+	err     error
+}
+
+// part is text to write, or if obj is not nil a value to inspect.
+type part struct {
+	text string
+	obj  Object
+}
+
+func (in *inspector) inspect(obj Object) {
+	todo := []part{{obj: obj}}
+	for len(todo) > 0 && in.err == nil {
+		next := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		switch obj := next.obj.(type) {
+		case nil:
+			in.write(next.text)
+		case *Array:
+			in.write("[")
+			todo = append(todo, part{text: "]"})
+			for i := len(obj.Elements) - 1; i >= 0; i-- {
+				todo = append(todo, part{obj: obj.Elements[i]})
+				if i > 0 {
+					todo = append(todo, part{text: ", "})
+				}
+			}
+		case *Hash:
+			in.write("{")
+			todo = append(todo, part{text: "}"})
+			for i := len(obj.pairs) - 1; i >= 0; i-- {
+				todo = append(todo, part{obj: obj.pairs[i].Value}, part{text: ": "}, part{obj: obj.pairs[i].Key})
+				if i > 0 {
+					todo = append(todo, part{text: ", "})
+				}
+			}
+		default:
+			in.write(obj.Inspect())
+		}
+	}
+}
+
+func (in *inspector) write(s string) {
+	if in.err != nil {
+		return
+	}
+	in.out.WriteString(s)
+	if in.meter == nil || in.out.Len()-in.charged < inspectChunk {
+		return
+	}
+	if in.err = in.meter.Alloc(int64(in.out.Len() - in.charged)); in.err != nil {
+		return
+	}
+	in.charged = in.out.Len()
+	in.err = in.meter.Canceled()
+}
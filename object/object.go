@@ -0,0 +1,371 @@
+// Package object defines the runtime values of Monkey programs, shared by the
+// evaluator and the virtual machine.
+package object
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/code"
+)
+
+// ObjectType names the type of a runtime value.
+type ObjectType string
+
+// Definitions of object types.
+const (
+	INTEGER_OBJ           = "INTEGER"
+	BOOLEAN_OBJ           = "BOOLEAN"
+	STRING_OBJ            = "STRING"
+	NULL_OBJ              = "NULL"
+	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	ERROR_OBJ             = "ERROR" // the type of both Error and ErrorValue
+	FUNCTION_OBJ          = "FUNCTION"
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	BUILTIN_OBJ           = "BUILTIN"
+	ARRAY_OBJ             = "ARRAY"
+	HASH_OBJ              = "HASH"
+	MODULE_OBJ            = "MODULE"
+)
+
+// Object is the interface implemented by every runtime value.
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+// Integer represents integer values.
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+// Boolean represents boolean values.
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+// String represents string values.
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// Null represents the absence of a value.
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+// ReturnValue wraps the value of a return statement while it unwinds the
+// enclosing blocks.
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+// Error represents a runtime error. It stops evaluation as it propagates.
+type Error struct {
+	Message string
+	Err     error // the Go error behind the failure, if a host function reported one
+	// Trace lists the calls being executed when the error occurred,
+	// innermost first. Calls replaced by tail calls are not part of it.
+	Trace []Frame
+	// Value is the value thrown by the throw statement that raised the
+	// error, if one did and the value was not an ErrorValue.
+	Value Object
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// ErrorValue is a runtime error caught by a try expression. Unlike Error it is
+// an ordinary value: programs can store it, read its "message" and "trace"
+// members by indexing it, and throw it again.
+type ErrorValue struct {
+	Message string
+	Err     error
+	// Trace lists the calls from the one the error occurred in to the one
+	// that caught it, innermost first.
+	Trace []Frame
+}
+
+func (e *ErrorValue) Type() ObjectType { return ERROR_OBJ }
+func (e *ErrorValue) Inspect() string  { return "ERROR: " + e.Message }
+
+// Member returns the member of e called name: its message as a string, or
+// its trace as an array of strings such as "add (main.mk:2:16)".
+func (e *ErrorValue) Member(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: e.Message}, true
+	case "trace":
+		frames := make([]Object, len(e.Trace))
+		for i, f := range e.Trace {
+			frames[i] = &String{Value: f.String()}
+		}
+		return &Array{Elements: frames}, true
+	}
+	return nil, false
+}
+
+// UncaughtMessage returns the message of the error raised by throwing value,
+// which is not an ErrorValue, inspecting value with m as InspectMetered does.
+func UncaughtMessage(value Object, m Meter) (string, error) {
+	text, err := InspectMetered(value, m)
+	if err != nil {
+		return "", err
+	}
+	return "uncaught exception: " + text, nil
+}
+
+// ArityMessage returns the message of the error raised by calling the
+// function bound to name, or an anonymous function if name is empty, with got
+// arguments. The function has parameters parameters, the last defaults of
+// which have defaults, and if variadic it takes any number of arguments after
+// them.
+func ArityMessage(name string, parameters, defaults int, variadic bool, got int) string {
+	if name == "" {
+		name = AnonymousFunction
+	}
+	want := strconv.Itoa(parameters - defaults)
+	switch {
+	case variadic:
+		want += "+"
+	case defaults > 0:
+		want += ".." + strconv.Itoa(parameters)
+	}
+	return fmt.Sprintf("wrong number of arguments to %s: want=%s, got=%d", name, want, got)
+}
+
+// Names of frames that do not execute a named function.
+const (
+	MainFunction      = "<main>"      // the top level of the program
+	ModuleFunction    = "<module>"    // the top level of an imported file
+	AnonymousFunction = "<anonymous>" // a function not bound by let
+)
+
+// Frame is an entry of a stack trace: a function being executed and the
+// source position it was executing.
+type Frame struct {
+	Function string // the name the function was bound to by let, or one of the names above
+	File     string // empty if the source has no file
+	Line     int
+	Column   int
+}
+
+// String returns the frame as `name (file:line:column)`.
+func (f Frame) String() string {
+	pos := fmt.Sprintf("%d:%d", f.Line, f.Column)
+	if f.File != "" {
+		pos = f.File + ":" + pos
+	}
+	return f.Function + " (" + pos + ")"
+}
+
+// FormatTrace returns the message of an error followed by its frames, one
+// per line, innermost first:
+//
+//	type mismatch: INTEGER + BOOLEAN
+//		at add (main.mk:2:16)
+//		at <main> (main.mk:4:4)
+func FormatTrace(message string, trace []Frame) string {
+	var out strings.Builder
+	out.WriteString(message)
+	for _, f := range trace {
+		out.WriteString("\n\tat " + f.String())
+	}
+	return out.String()
+}
+
+// inspectFunction is how every function prints. The VM keeps no source for
+// its functions, so neither engine shows parameters or bodies, and both print
+// the same text.
+const inspectFunction = "fn(...) {...}"
+
+// Function is a function literal evaluated in, and closing over, Env.
+type Function struct {
+	Parameters []*ast.Parameter
+	Rest       *ast.Identifier // binds the arguments after Parameters, if set
+	Body       *ast.BlockStatement
+	Env        *Environment
+	Name       string // the name the function is bound to by let, if any
+	File       string // the file the function was defined in, if any
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string  { return inspectFunction }
+
+// CompiledFunction is a function compiled to bytecode.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	NumDefaults   int            // the number of the last parameters that have defaults
+	Variadic      bool           // whether the local after the parameters holds an array of the extra arguments
+	Lines         code.LineTable // source positions of Instructions
+	Name          string         // the name the function is bound to by let, if any
+	File          string         // the file the function was compiled from, if any
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string  { return inspectFunction }
+
+// Closure is a compiled function together with the values of the free
+// variables it captured when it was created. It is the VM's counterpart of
+// Function and has the same type.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string  { return inspectFunction }
+
+// BuiltinFunction is the Go implementation of a builtin. It reports failures
+// by returning an *Error.
+type BuiltinFunction func(args ...Object) Object
+
+// MeteredFunction is the Go implementation of a builtin that converts values
+// to strings, which it meters with m as InspectMetered does. It returns the
+// error of m when m stops it, and reports other failures by returning an
+// *Error.
+type MeteredFunction func(m Meter, args ...Object) (Object, error)
+
+// Builtin is a function implemented in Go. The engines call Metered, if set,
+// with the meter of the execution, and Fn otherwise.
+type Builtin struct {
+	Fn      BuiltinFunction
+	Metered MeteredFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+// Array represents an ordered list of values.
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	s, _ := InspectMetered(a, nil)
+	return s
+}
+
+// HashKey identifies a hashable value in a Hash. Keys of values of different
+// types differ, and so do keys of different values of the same type: the
+// key holds the value itself rather than a digest of it, so keys never
+// collide.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64 // the value of an integer, or 1 for true
+	Text  string // the value of a string
+}
+
+// Hashable is implemented by the values usable as hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey { return HashKey{Type: i.Type(), Value: uint64(i.Value)} }
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey { return HashKey{Type: s.Type(), Text: s.Value} }
+
+// HashPair is an entry of a Hash.
+type HashPair struct {
+	Key   Hashable
+	Value Object
+}
+
+// Hash represents a map from hashable values to values. It remembers the
+// order its keys were first set in and iterates in that order. The zero
+// value is an empty hash.
+type Hash struct {
+	pairs []HashPair
+	index map[HashKey]int // position of each key in pairs
+}
+
+// NewHash returns an empty hash with room for size pairs.
+func NewHash(size int) *Hash {
+	return &Hash{pairs: make([]HashPair, 0, size), index: make(map[HashKey]int, size)}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+
+// Inspect returns the pairs of the hash in insertion order.
+func (h *Hash) Inspect() string {
+	s, _ := InspectMetered(h, nil)
+	return s
+}
+
+// Len returns the number of pairs in the hash.
+func (h *Hash) Len() int { return len(h.pairs) }
+
+// Get returns the value of key, and whether the hash has one.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	i, ok := h.index[key.HashKey()]
+	if !ok {
+		return nil, false
+	}
+	return h.pairs[i].Value, true
+}
+
+// Set sets the value of key. A key that is already present keeps its
+// position.
+func (h *Hash) Set(key Hashable, value Object) {
+	k := key.HashKey()
+	if i, ok := h.index[k]; ok {
+		h.pairs[i].Value = value
+		return
+	}
+	if h.index == nil {
+		h.index = map[HashKey]int{}
+	}
+	h.index[k] = len(h.pairs)
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+}
+
+// Pairs returns the pairs of the hash in insertion order. The caller must
+// not modify the slice.
+func (h *Hash) Pairs() []HashPair { return h.pairs }
+
+// Module is the value an import statement binds: the names exported by the
+// imported file and their values, in the order they were exported.
+type Module struct {
+	Path    string // the file the module was read from
+	Exports *Hash  // maps each exported name, as a string, to its value
+}
+
+// NewModule returns a module of the file path exporting nothing yet.
+func NewModule(path string) *Module {
+	return &Module{Path: path, Exports: NewHash(0)}
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "<module " + m.Path + ">" }
+
+// Member returns the value m exports as name.
+func (m *Module) Member(name string) (Object, bool) {
+	return m.Exports.Get(&String{Value: name})
+}
@@ -0,0 +1,136 @@
+package object
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHashKey(t *testing.T) {
+	tests := []struct {
+		a, b  Hashable
+		equal bool
+	}{
+		{&String{Value: "Hello World"}, &String{Value: "Hello World"}, true},
+		{&String{Value: "a"}, &String{Value: "b"}, false},
+		{&Integer{Value: 1}, &Integer{Value: 1}, true},
+		{&Integer{Value: -1}, &Integer{Value: 1}, false},
+		{&Boolean{Value: true}, &Boolean{Value: true}, true},
+		{&Integer{Value: 1}, &Boolean{Value: true}, false},
+		{&Integer{Value: 1}, &String{Value: "1"}, false},
+		{&Integer{Value: 0}, &Boolean{Value: false}, false},
+		{&String{Value: ""}, &Boolean{Value: false}, false},
+	}
+	for _, tt := range tests {
+		if equal := tt.a.HashKey() == tt.b.HashKey(); equal != tt.equal {
+			t.Errorf("%s %s and %s %s: keys equal=%t, want %t",
+				tt.a.Type(), tt.a.Inspect(), tt.b.Type(), tt.b.Inspect(), equal, tt.equal)
+		}
+	}
+}
+
+func TestFormatTrace(t *testing.T) {
+	trace := []Frame{
+		{Function: "add", File: "main.mk", Line: 2, Column: 16},
+		{Function: MainFunction, Line: 4, Column: 4},
+	}
+	expected := "type mismatch: INTEGER + BOOLEAN\n\tat add (main.mk:2:16)\n\tat <main> (4:4)"
+	if got := FormatTrace("type mismatch: INTEGER + BOOLEAN", trace); got != expected {
+		t.Errorf("wrong trace.\nwant=%q\ngot= %q", expected, got)
+	}
+	if got := FormatTrace("division by zero", nil); got != "division by zero" {
+		t.Errorf("wrong trace without frames: %q", got)
+	}
+}
+
+func TestErrorValueMember(t *testing.T) {
+	err := &ErrorValue{Message: "division by zero", Trace: []Frame{{Function: "div", Line: 1, Column: 5}}}
+	if m, ok := err.Member("message"); !ok || m.Inspect() != "division by zero" {
+		t.Errorf("wrong message member: %v", m)
+	}
+	if m, ok := err.Member("trace"); !ok || m.Inspect() != "[div (1:5)]" {
+		t.Errorf("wrong trace member: %v", m)
+	}
+	if m, ok := err.Member("code"); ok {
+		t.Errorf("unknown member found: %v", m)
+	}
+}
+
+func TestModuleMember(t *testing.T) {
+	m := NewModule("lib.mk")
+	m.Exports.Set(&String{Value: "pi"}, &Integer{Value: 3})
+	if v, ok := m.Member("pi"); !ok || v.Inspect() != "3" {
+		t.Errorf("wrong pi member: %v", v)
+	}
+	if v, ok := m.Member("e"); ok {
+		t.Errorf("unknown member found: %v", v)
+	}
+	if m.Inspect() != "<module lib.mk>" {
+		t.Errorf("wrong Inspect(): %q", m.Inspect())
+	}
+}
+
+func TestHash(t *testing.T) {
+	var h Hash
+	if _, ok := h.Get(&String{Value: "x"}); ok || h.Len() != 0 || h.Inspect() != "{}" {
+		t.Fatalf("zero hash is not empty: %s", h.Inspect())
+	}
+	h.Set(&String{Value: "b"}, &Integer{Value: 1})
+	h.Set(&Integer{Value: 2}, &Integer{Value: 2})
+	h.Set(&String{Value: "a"}, &Integer{Value: 3})
+	h.Set(&String{Value: "b"}, &Integer{Value: 4})
+	if got := h.Inspect(); got != "{b: 4, 2: 2, a: 3}" {
+		t.Errorf("wrong pairs: %s", got)
+	}
+	if v, ok := h.Get(&Integer{Value: 2}); !ok || v.Inspect() != "2" {
+		t.Errorf("Get(2) = %v, %t", v, ok)
+	}
+	if _, ok := h.Get(&String{Value: "2"}); ok {
+		t.Errorf("string key found an integer key")
+	}
+}
+
+// budget is a Meter allowing a number of bytes.
+type budget struct {
+	left int64
+}
+
+var errBudget = errors.New("over budget")
+
+func (b *budget) Alloc(n int64) error {
+	b.left -= n
+	if b.left < 0 {
+		return errBudget
+	}
+	return nil
+}
+
+func (b *budget) Canceled() error { return nil }
+
+func TestInspectMetered(t *testing.T) {
+	hash := NewHash(1)
+	hash.Set(&String{Value: "a"}, &Array{Elements: []Object{&Integer{Value: 1}, NewHash(0)}})
+	value := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "s"}, hash}}
+	const want = "[1, s, {a: [1, {}]}]"
+	if got := value.Inspect(); got != want {
+		t.Errorf("wrong Inspect. want=%q, got=%q", want, got)
+	}
+	if got, err := InspectMetered(value, &budget{left: 10}); got != want || err != nil {
+		t.Errorf("wrong InspectMetered. want=%q, got=%q (%v)", want, got, err)
+	}
+
+	nested := Object(&Integer{Value: 1})
+	for i := 0; i < 40; i++ {
+		nested = &Array{Elements: []Object{nested, nested}}
+	}
+	if _, err := InspectMetered(nested, &budget{left: 1 << 16}); err != errBudget {
+		t.Errorf("InspectMetered did not stop when over budget. got=%v", err)
+	}
+
+	deep := Object(NewHash(0))
+	for i := 0; i < 1000000; i++ {
+		deep = &Array{Elements: []Object{deep}}
+	}
+	if got := len(deep.Inspect()); got != 2000002 {
+		t.Errorf("wrong length of a deeply nested value. want=2000002, got=%d", got)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/astdump"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/parser"
+)
+
+// dumpers maps the values accepted by `monkey parse -format` to the functions
+// writing a tree in that format.
+var dumpers = map[string]func(io.Writer, ast.Node) error{
+	"sexpr": astdump.SExpr,
+	"dot":   astdump.DOT,
+	"json": func(w io.Writer, node ast.Node) error {
+		data, err := ast.MarshalJSON(node)
+		if err == nil {
+			_, err = fmt.Fprintf(w, "%s\n", data)
+		}
+		return err
+	},
+}
+
+// parseMain implements `monkey parse [-format sexpr|dot|json] [file]`, which
+// prints the syntax tree of a file or of standard input.
+func parseMain(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	format := flags.String("format", "sexpr", "output format: sexpr, dot or json")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey parse [-format sexpr|dot|json] [file]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	dump, ok := dumpers[*format]
+	if !ok || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var src []byte
+	var err error
+	if flags.NArg() == 0 {
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey parse: %v\n", err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		fmt.Fprintf(os.Stderr, "monkey parse: %s\n", strings.Join(p.Errors(), "\n"))
+		return 1
+	}
+	if err := dump(os.Stdout, program); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey parse: %v\n", err)
+		return 1
+	}
+	return 0
+}
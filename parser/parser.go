@@ -12,14 +12,23 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	PIPE        // |>
+	CONDITIONAL // c ? a : b
+	COALESCE    // ??
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
-	PREFIX      // -X or !XCALL
+	PREFIX      // -X or !X
+	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
+	token.PIPE:     PIPE,
+	token.QUESTION: CONDITIONAL,
+	token.NULLISH:  COALESCE,
+	token.OPTIONAL: INDEX,
 	token.EQ:       EQUALS,
 	token.NOTEQ:    EQUALS,
 	token.LT:       LESSGREATER,
@@ -28,8 +37,14 @@ var precedences = map[token.TokenType]int{
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
+// DefaultMaxDepth is the default maximum nesting depth of expressions.
+const DefaultMaxDepth = 1000
+
 // Parser reprsents the parser object.
 type Parser struct {
 	lexer        *lexer.Lexer
@@ -37,6 +52,28 @@ type Parser struct {
 	peekToken    token.Token
 	errors       []string // for holding the errors.
 
+	// depth is the number of expressions being parsed, nested in each other.
+	depth    int
+	maxDepth int
+	// tooDeep holds the diagnostic once maxDepth has been exceeded, and
+	// errorsBefore the number of errors reported until then.
+	tooDeep      string
+	errorsBefore int
+
+	// blocks is the number of blocks being parsed, nested in each other.
+	blocks int
+
+	// brackets is the number of parentheses, brackets and braces opened up
+	// to currentToken and not closed yet. guardBrackets is its value inside
+	// a parenthesis at the top level of the match guard being parsed, where
+	// `(x) =>` is the guard followed by the arm's arrow rather than an arrow
+	// function, and 0 outside guards.
+	brackets      int
+	guardBrackets int
+
+	// spans records the first and last token of every parsed node.
+	spans map[ast.Node]Span
+
 	// maps associating infix and prefix operator tokens to appropriate parser functions
 	infixParseFns  map[token.TokenType]infixParseFn
 	prefixParseFns map[token.TokenType]prefixParseFn
@@ -45,14 +82,29 @@ type Parser struct {
 // New initializes a Parser.
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		lexer:  l,
-		errors: []string{},
+		lexer:    l,
+		errors:   []string{},
+		spans:    map[ast.Node]Span{},
+		maxDepth: DefaultMaxDepth,
 	}
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefixParser(token.IDENT, p.parseIdentifier)
 	p.registerPrefixParser(token.INT, p.parseIntegerLiteral)
+	p.registerPrefixParser(token.STRING, p.parseStringLiteral)
+	p.registerPrefixParser(token.TEMPLATE, p.parseTemplateLiteral)
+	p.registerPrefixParser(token.TEMPLATE_HEAD, p.parseTemplateLiteral)
 	p.registerPrefixParser(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixParser(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefixParser(token.TRUE, p.parseBoolean)
+	p.registerPrefixParser(token.FALSE, p.parseBoolean)
+	p.registerPrefixParser(token.NULL, p.parseNullLiteral)
+	p.registerPrefixParser(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefixParser(token.IF, p.parseIfExpression)
+	p.registerPrefixParser(token.TRY, p.parseTryExpression)
+	p.registerPrefixParser(token.MATCH, p.parseMatchExpression)
+	p.registerPrefixParser(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefixParser(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefixParser(token.LBRACE, p.parseHashLiteral)
 
 	// register infix parsing functions
 
@@ -65,6 +117,13 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfixParser(token.NOTEQ, p.parseInfixExpression)
 	p.registerInfixParser(token.LT, p.parseInfixExpression)
 	p.registerInfixParser(token.GT, p.parseInfixExpression)
+	p.registerInfixParser(token.LPAREN, p.parseCallExpression)
+	p.registerInfixParser(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfixParser(token.DOT, p.parseMemberExpression)
+	p.registerInfixParser(token.PIPE, p.parsePipeExpression)
+	p.registerInfixParser(token.QUESTION, p.parseConditionalExpression)
+	p.registerInfixParser(token.NULLISH, p.parseCoalesceExpression)
+	p.registerInfixParser(token.OPTIONAL, p.parseOptionalExpression)
 
 	// warm start the parser with two tokens i.e one for currentToken and the next for peekToken.
 	p.nextToken()
@@ -97,13 +156,32 @@ func (p *Parser) ParseExpressionStatment() *ast.ExpressionStatement {
 	return stmt
 }
 
+// SetMaxDepth sets the maximum nesting depth of expressions, which bounds
+// the recursion of the parser on hostile input such as thousands of opening
+// parentheses. Deeper input is reported with a single error.
+func (p *Parser) SetMaxDepth(depth int) {
+	p.maxDepth = depth
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	if p.tooDeep != "" {
+		return nil
+	}
+	if p.depth >= p.maxDepth {
+		p.abortTooDeep()
+		return nil
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	start := p.currentToken
 	prefix := p.prefixParseFns[p.currentToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.currentToken.Type)
 		return nil
 	}
 	leftExp := prefix()
+	p.recordSpan(leftExp, start)
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
@@ -111,6 +189,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		}
 		p.nextToken()
 		leftExp = infix(leftExp)
+		p.recordSpan(leftExp, start)
 	}
 	return leftExp
 }
@@ -124,14 +203,38 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	val, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.currentToken, fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal))
 		return nil
 	}
 	lit.Value = val
 	return lit
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+}
+
+// parseTemplateLiteral parses a template literal: its text up to the first
+// hole, then the expression of each hole followed by the text after it.
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	template := &ast.TemplateLiteral{Token: p.currentToken, Strings: []string{p.currentToken.Literal}}
+	for !p.curTokenIs(token.TEMPLATE) && !p.curTokenIs(token.TEMPLATE_TAIL) {
+		if p.peekTokenIs(token.TEMPLATE_MIDDLE) || p.peekTokenIs(token.TEMPLATE_TAIL) {
+			p.errorAt(p.peekToken, "empty template hole")
+			return nil
+		}
+		p.nextToken()
+		template.Expressions = append(template.Expressions, p.parseExpression(LOWEST))
+		if !p.peekTokenIs(token.TEMPLATE_MIDDLE) && !p.peekTokenIs(token.TEMPLATE_TAIL) {
+			p.peekError(token.RBRACE)
+			return nil
+		}
+		p.nextToken()
+		template.Strings = append(template.Strings, p.currentToken.Literal)
+	}
+	return template
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{
 		Token:    p.currentToken,
@@ -144,6 +247,70 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parsePipeExpression parses `left |> right`. Pipes have the lowest
+// precedence and associate to the left, so `x |> f |> g` is `g(f(x))`.
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	expression := &ast.PipeExpression{Token: p.currentToken, Left: left}
+	p.nextToken()
+	expression.Right = p.parseExpression(PIPE)
+	return expression
+}
+
+// parseConditionalExpression parses `condition ? consequence : alternative`.
+// Conditionals associate to the right, so `a ? b : c ? d : e` is
+// `a ? b : (c ? d : e)`, and bind more tightly than pipes only.
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{Token: p.currentToken, Condition: condition}
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+	p.nextToken()
+	expression.Alternative = p.parseExpression(CONDITIONAL - 1)
+	return expression
+}
+
+// parseCoalesceExpression parses `left ?? right`, which associates to the
+// left.
+func (p *Parser) parseCoalesceExpression(left ast.Expression) ast.Expression {
+	expression := &ast.CoalesceExpression{Token: p.currentToken, Left: left}
+	p.nextToken()
+	expression.Right = p.parseExpression(COALESCE)
+	return expression
+}
+
+// parseOptionalExpression parses the optional member access, index or call
+// following `?.`: `a?.b`, `a?.[i]` or `f?.(x)`.
+func (p *Parser) parseOptionalExpression(left ast.Expression) ast.Expression {
+	optional := p.currentToken
+	switch p.peekToken.Type {
+	case token.LPAREN:
+		p.nextToken()
+		return &ast.CallExpression{
+			Token:     optional,
+			Function:  left,
+			Arguments: p.parseExpressionList(token.RPAREN),
+			Optional:  true,
+		}
+	case token.LBRACKET:
+		p.nextToken()
+		expression, ok := p.parseIndexExpression(left).(*ast.IndexExpression)
+		if !ok {
+			return nil
+		}
+		expression.Token = optional
+		expression.Optional = true
+		return expression
+	}
+	expression, ok := p.parseMemberExpression(left).(*ast.MemberExpression)
+	if !ok {
+		return nil
+	}
+	expression.Optional = true
+	return expression
+}
+
 // Errors returns the parser errors.
 func (p *Parser) Errors() []string {
 	return p.errors
@@ -153,6 +320,12 @@ func (p *Parser) Errors() []string {
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
 	p.peekToken = p.lexer.NextToken()
+	switch p.currentToken.Type {
+	case token.LPAREN, token.LBRACKET, token.LBRACE, token.TEMPLATE_HEAD:
+		p.brackets++
+	case token.RPAREN, token.RBRACKET, token.RBRACE, token.TEMPLATE_TAIL:
+		p.brackets--
+	}
 }
 
 // ParseProgram parses the program
@@ -166,40 +339,239 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 		p.nextToken()
 	}
+	if p.tooDeep != "" {
+		// The errors reported while unwinding the nested expressions only
+		// follow from the abandoned input.
+		p.errors = append(p.errors[:p.errorsBefore], p.tooDeep)
+	}
 	return &program
 }
 
+// abortTooDeep reports that the expression at currentToken exceeds the
+// maximum depth and skips the rest of the input, which ends the parse.
+func (p *Parser) abortTooDeep() {
+	p.tooDeep = fmt.Sprintf("line %d, column %d: expression nested too deeply (maximum depth %d)",
+		p.currentToken.Line, p.currentToken.Column, p.maxDepth)
+	p.errorsBefore = len(p.errors)
+	for !p.curTokenIs(token.EOF) {
+		p.nextToken()
+	}
+}
+
 // ParseStatment parses a given statemnt.
 func (p *Parser) ParseStatment() ast.Statement {
+	start := p.currentToken
+	var statement ast.Statement
 	switch p.currentToken.Type {
 	case token.LET:
-		return p.ParseLetStatement()
+		if s := p.ParseLetStatement(); s != nil {
+			statement = s
+		}
 	case token.RETURN:
-		return p.ParseReturnStatement()
+		statement = p.ParseReturnStatement()
+	case token.THROW:
+		statement = p.parseThrowStatement()
+	case token.IMPORT:
+		p.topLevelOnly()
+		if s := p.parseImportStatement(); s != nil {
+			statement = s
+		}
+	case token.EXPORT:
+		p.topLevelOnly()
+		if s := p.parseExportStatement(); s != nil {
+			statement = s
+		}
 	default:
-		return p.ParseExpressionStatment()
+		statement = p.ParseExpressionStatment()
 	}
+	p.recordSpan(statement, start)
+	return statement
 }
 
 // ParseLetStatment is a specific statment parser that is dedicated to parsing a `let` statment.
+// A `let` followed by `[` or `{` destructures its value with a pattern.
 func (p *Parser) ParseLetStatement() *ast.LetStatement {
 	statement := &ast.LetStatement{Token: p.currentToken}
-	// after the `let` keyword check the next token's type is an Identifier
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		if statement.Pattern = p.parsePattern(false); statement.Pattern == nil {
+			return nil
+		}
+		p.checkBindings(statement.Names())
+	} else {
+		// after the `let` keyword check the next token's type is an Identifier
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		// if identifier is found in the next token the construct an Identifier object.
+		statement.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		p.recordSpan(statement.Name, p.currentToken)
 	}
-	// if identifier is found in the next token the construct an Identifier object.
-	statement.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
-	// If the next token is not a semicolon parse the experssion.
-	for !p.curTokenIs(token.SEMICOLON) {
+	p.nextToken()
+	statement.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return statement
 }
 
+// parsePattern parses the pattern starting at currentToken: an identifier,
+// the `_` wildcard, an array pattern or a hash pattern, or with literals set,
+// as in the arms of a match expression, an integer, string or boolean
+// literal. Patterns nest like expressions and count towards the same maximum
+// depth.
+func (p *Parser) parsePattern(literals bool) ast.Pattern {
+	if p.tooDeep != "" {
+		return nil
+	}
+	if p.depth >= p.maxDepth {
+		p.abortTooDeep()
+		return nil
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	start := p.currentToken
+	var pattern ast.Pattern
+	switch {
+	case p.curTokenIs(token.IDENT) && p.currentToken.Literal == "_":
+		// `_` is an ordinary identifier everywhere but in a pattern.
+		pattern = &ast.WildcardPattern{Token: p.currentToken}
+	case p.curTokenIs(token.IDENT):
+		pattern = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	case p.curTokenIs(token.LBRACKET):
+		pattern = p.parseArrayPattern(literals)
+	case p.curTokenIs(token.LBRACE):
+		pattern = p.parseHashPattern(literals)
+	case literals && (p.curTokenIs(token.INT) || p.curTokenIs(token.MINUS) && p.peekTokenIs(token.INT)):
+		if lit := p.parseIntegerPattern(); lit != nil {
+			pattern = lit
+		}
+	case literals && p.curTokenIs(token.STRING):
+		pattern = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+	case literals && (p.curTokenIs(token.TRUE) || p.curTokenIs(token.FALSE)):
+		pattern = &ast.Boolean{Token: p.currentToken, Value: p.curTokenIs(token.TRUE)}
+	case literals && p.curTokenIs(token.NULL):
+		pattern = &ast.NullLiteral{Token: p.currentToken}
+	default:
+		p.errorAt(p.currentToken, fmt.Sprintf("expected a pattern, got %s instead", p.currentToken.Type))
+	}
+	p.recordSpan(pattern, start)
+	return pattern
+}
+
+// parseArrayPattern parses an array pattern such as `[a, [b, c], ...rest]`.
+func (p *Parser) parseArrayPattern(literals bool) ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.currentToken, Elements: []ast.Pattern{}}
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+			p.recordSpan(pattern.Rest, p.currentToken)
+			if !p.peekTokenIs(token.RBRACKET) {
+				p.errorAt(p.peekToken, "the rest element must be the last in an array pattern")
+				return nil
+			}
+			break
+		}
+		element := p.parsePattern(literals)
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return pattern
+}
+
+// parseHashPattern parses a hash pattern such as `{name, "age": years}`.
+func (p *Parser) parseHashPattern(literals bool) ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.currentToken, Pairs: []ast.HashPatternPair{}}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		var pair ast.HashPatternPair
+		start := p.currentToken
+		switch {
+		case p.curTokenIs(token.IDENT):
+			pair.Key = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		case p.curTokenIs(token.STRING):
+			pair.Key = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+		case p.curTokenIs(token.TRUE) || p.curTokenIs(token.FALSE):
+			pair.Key = &ast.Boolean{Token: p.currentToken, Value: p.curTokenIs(token.TRUE)}
+		case p.curTokenIs(token.INT) || p.curTokenIs(token.MINUS) && p.peekTokenIs(token.INT):
+			lit := p.parseIntegerPattern()
+			if lit == nil {
+				return nil
+			}
+			pair.Key = lit
+		default:
+			p.errorAt(p.currentToken, fmt.Sprintf("expected a hash pattern key, got %s instead", p.currentToken.Type))
+			return nil
+		}
+		p.recordSpan(pair.Key, start)
+		if key, ok := pair.Key.(*ast.Identifier); ok && !p.peekTokenIs(token.COLON) {
+			// `name` is short for `name: name`.
+			pair.Value = &ast.Identifier{Token: key.Token, Value: key.Value}
+			p.recordSpan(pair.Value, key.Token)
+		} else {
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+			if pair.Value = p.parsePattern(literals); pair.Value == nil {
+				return nil
+			}
+		}
+		pattern.Pairs = append(pattern.Pairs, pair)
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return pattern
+}
+
+// parseIntegerPattern parses an integer literal in a pattern. A leading `-`
+// makes the literal negative: patterns hold no other expressions, so `-1` is
+// a single literal there rather than a prefix expression.
+func (p *Parser) parseIntegerPattern() *ast.IntegerLiteral {
+	tok := p.currentToken
+	if p.curTokenIs(token.MINUS) {
+		p.nextToken()
+		tok.Type, tok.Literal = token.INT, "-"+p.currentToken.Literal
+	}
+	val, err := strconv.ParseInt(tok.Literal, 0, 64)
+	if err != nil {
+		p.errorAt(tok, fmt.Sprintf("could not parse %q as integer", tok.Literal))
+		return nil
+	}
+	return &ast.IntegerLiteral{Token: tok, Value: val}
+}
+
+// checkBindings reports the names bound more than once by a pattern.
+func (p *Parser) checkBindings(names []*ast.Identifier) {
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name.Value] {
+			p.errorAt(name.Token, fmt.Sprintf("duplicate binding %s in pattern", name.Value))
+		}
+		seen[name.Value] = true
+	}
+}
+
 // curTokenIs checks the currentToken is the same as `t`.
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.currentToken.Type == t
@@ -220,27 +592,85 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	return false
 }
 
+// errorAt adds the error msg about tok to errors, after the position of tok.
+func (p *Parser) errorAt(tok token.Token, msg string) {
+	p.errors = append(p.errors, fmt.Sprintf("line %d, column %d: %s", tok.Line, tok.Column, msg))
+}
+
 // peekError adds an error to errors when the type of peekToken doesn’t match the expectation.
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken, msg)
 }
+
+// ParseReturnStatement parses a `return <expression>;` statement.
 func (p *Parser) ParseReturnStatement() *ast.ReturnStatement {
 	statement := &ast.ReturnStatement{Token: p.currentToken}
 	p.nextToken()
+	statement.ReturnValue = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+// parseThrowStatement parses a `throw <expression>;` statement.
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	statement := &ast.ThrowStatement{Token: p.currentToken}
+	p.nextToken()
+	statement.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
 
-	// TODO: We're skipping the expression parsing
-	// If not a semicolon get the next token.
-	for !p.curTokenIs(token.SEMICOLON) {
+// parseImportStatement parses an `import "path" as name;` statement.
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	statement := &ast.ImportStatement{Token: p.currentToken}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	statement.Path = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.recordSpan(statement.Path, p.currentToken)
+	if !p.expectPeek(token.AS) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	statement.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.recordSpan(statement.Name, p.currentToken)
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return statement
 }
 
+// parseExportStatement parses an `export let name = value;` statement.
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	statement := &ast.ExportStatement{Token: p.currentToken}
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+	start := p.currentToken
+	if statement.Statement = p.ParseLetStatement(); statement.Statement == nil {
+		return nil
+	}
+	p.recordSpan(statement.Statement, start)
+	return statement
+}
+
+// topLevelOnly reports an error if the statement at currentToken is inside
+// a block. Imports and exports belong to the top level of a file.
+func (p *Parser) topLevelOnly() {
+	if p.blocks > 0 {
+		msg := fmt.Sprintf("%s statements are only allowed at the top level", p.currentToken.Literal)
+		p.errorAt(p.currentToken, msg)
+	}
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.currentToken, msg)
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -266,3 +696,385 @@ func (p *Parser) curPrecedence() int {
 	}
 	return LOWEST
 }
+
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.currentToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.currentToken}
+}
+
+// parseGroupedExpression parses an expression wrapped in parentheses, or an
+// arrow function if the parenthesis opens its parameters. The parentheses
+// only influence precedence and leave no node of their own.
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	arrow := p.brackets != p.guardBrackets
+	if arrow && (p.peekTokenIs(token.RPAREN) || p.peekTokenIs(token.ELLIPSIS)) {
+		literal := &ast.FunctionLiteral{}
+		if !p.parseFunctionParameters(literal, nil) {
+			return nil
+		}
+		return p.parseArrowFunction(literal)
+	}
+	first := p.peekToken
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+	// A lone name may be the first parameter of an arrow function.
+	ident, ok := exp.(*ast.Identifier)
+	arrow = arrow && ok && ident.Token == first
+	if arrow && (p.peekTokenIs(token.COMMA) || p.peekTokenIs(token.ASSIGN)) {
+		literal := &ast.FunctionLiteral{}
+		if !p.parseFunctionParameters(literal, ident) {
+			return nil
+		}
+		return p.parseArrowFunction(literal)
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if arrow && p.peekTokenIs(token.ARROW) {
+		param := &ast.Parameter{Name: ident}
+		p.recordSpan(param, ident.Token)
+		literal := &ast.FunctionLiteral{Parameters: []*ast.Parameter{param}}
+		return p.parseArrowFunction(literal)
+	}
+	return exp
+}
+
+// parseArrowFunction parses the `=> expression` of an arrow function whose
+// parameters are in literal. The body ends before a pipe, so that
+// `xs |> (x) => x * 2 |> f` passes the function's result on to f.
+func (p *Parser) parseArrowFunction(literal *ast.FunctionLiteral) ast.Expression {
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	literal.Token = p.currentToken
+	literal.Arrow = true
+	p.nextToken()
+	start := p.currentToken
+	statement := &ast.ExpressionStatement{Token: start, Expression: p.parseExpression(PIPE)}
+	if statement.Expression == nil {
+		return nil
+	}
+	p.recordSpan(statement, start)
+	literal.Body = &ast.BlockStatement{Token: start, Statements: []ast.Statement{statement}}
+	p.recordSpan(literal.Body, start)
+	return literal
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.currentToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Consequence = p.parseBlockStatement()
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Alternative = p.parseBlockStatement()
+	}
+	return expression
+}
+
+// parseTryExpression parses a try block followed by a catch block, a finally
+// block or both.
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.currentToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+	if !p.peekTokenIs(token.CATCH) && !p.peekTokenIs(token.FINALLY) {
+		msg := fmt.Sprintf("expected next token to be %s or %s, got %s instead",
+			token.CATCH, token.FINALLY, p.peekToken.Type)
+		p.errorAt(p.peekToken, msg)
+		return nil
+	}
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Parameter = p.parseParameter()
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+	return expression
+}
+
+// parseMatchExpression parses a match expression such as
+// `match (x) { 0 => "zero", [a, b] if a > b => a, _ => b }`. The last arm
+// may be followed by a comma.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.currentToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Arms = []ast.MatchArm{}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		var arm ast.MatchArm
+		if arm.Pattern = p.parsePattern(true); arm.Pattern == nil {
+			return nil
+		}
+		p.checkBindings(ast.PatternNames(arm.Pattern))
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			outer := p.guardBrackets
+			p.guardBrackets = p.brackets + 1
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+			p.guardBrackets = outer
+		}
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.nextToken()
+		arm.Body = p.parseExpression(LOWEST)
+		expression.Arms = append(expression.Arms, arm)
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return expression
+}
+
+// parseBlockStatement parses statements up to the closing brace.
+// On return currentToken is the `}` token (or EOF for an unterminated block).
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.currentToken}
+	block.Statements = []ast.Statement{}
+	p.blocks++
+	defer func() { p.blocks-- }()
+	p.nextToken()
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		statement := p.ParseStatment()
+		if statement != nil {
+			block.Statements = append(block.Statements, statement)
+		}
+		p.nextToken()
+	}
+	p.recordSpan(block, block.Token)
+	return block
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	literal := &ast.FunctionLiteral{Token: p.currentToken}
+	if !p.expectPeek(token.LPAREN) || !p.parseFunctionParameters(literal, nil) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	literal.Body = p.parseBlockStatement()
+	return literal
+}
+
+// parseFunctionParameters parses the parameters of literal up to the closing
+// parenthesis: names, each optionally followed by `= default`, and last an
+// optional `...rest`. If first is set, it is the name of the first parameter,
+// already parsed and at currentToken.
+func (p *Parser) parseFunctionParameters(literal *ast.FunctionLiteral, first *ast.Identifier) bool {
+	literal.Parameters = []*ast.Parameter{}
+	if first == nil && p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return true
+	}
+	for {
+		if first == nil && p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			literal.Rest = p.parseParameter()
+			if p.peekTokenIs(token.COMMA) {
+				p.errorAt(p.peekToken, "the rest parameter must be the last")
+				return false
+			}
+			break
+		}
+		if first == nil && !p.expectPeek(token.IDENT) {
+			return false
+		}
+		param := &ast.Parameter{Name: first}
+		if first == nil {
+			param.Name = p.parseParameter()
+		}
+		first = nil
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			param.Default = p.parseExpression(LOWEST)
+		} else if n := len(literal.Parameters); n > 0 && literal.Parameters[n-1].Default != nil {
+			msg := fmt.Sprintf("parameter %s without a default follows one with a default", param.Name.Value)
+			p.errorAt(param.Name.Token, msg)
+		}
+		p.recordSpan(param, param.Name.Token)
+		literal.Parameters = append(literal.Parameters, param)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	return p.expectPeek(token.RPAREN)
+}
+
+func (p *Parser) parseParameter() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.recordSpan(ident, p.currentToken)
+	return ident
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	expression := &ast.CallExpression{Token: p.currentToken, Function: function}
+	expression.Arguments = p.parseExpressionList(token.RPAREN)
+	return expression
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currentToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currentToken, Pairs: []ast.HashPair{}}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return hash
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	expression := &ast.IndexExpression{Token: p.currentToken, Left: left}
+	p.nextToken()
+	expression.Index = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return expression
+}
+
+// parseMemberExpression parses a member access such as `lib.name`.
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	expression := &ast.MemberExpression{Token: p.currentToken, Object: left}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Member = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.recordSpan(expression.Member, p.currentToken)
+	return expression
+}
+
+// parseExpressionList parses comma-separated expressions up to the end
+// token, as in call arguments and array literals.
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+	p.nextToken()
+	list = append(list, p.parseElement())
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseElement())
+	}
+	if !p.expectPeek(end) {
+		return nil
+	}
+	return list
+}
+
+// parseElement parses an element of an expression list, which may be an
+// array spread into the list, as in `f(...args)`.
+func (p *Parser) parseElement() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadElement{Token: p.currentToken}
+	p.nextToken()
+	if spread.Value = p.parseExpression(LOWEST); spread.Value == nil {
+		return nil
+	}
+	p.recordSpan(spread, spread.Token)
+	return spread
+}
+
+// Precedence returns the binding power of the infix operator t, or LOWEST if
+// t is not an infix operator. Tools printing expressions use it to decide
+// where parentheses are needed.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+// Span is the range of tokens a node was parsed from. Start is the first token
+// of the node and End the last one.
+type Span struct {
+	Start token.Token
+	End   token.Token
+}
+
+// Span returns the tokens node was parsed from. It reports false for nodes
+// this parser did not produce.
+func (p *Parser) Span(node ast.Node) (Span, bool) {
+	span, ok := p.spans[node]
+	return span, ok
+}
+
+// recordSpan records that node was parsed from start up to the current token.
+// A node keeps the first, innermost span recorded for it, so a parenthesized
+// expression does not include its parentheses.
+func (p *Parser) recordSpan(node ast.Node, start token.Token) {
+	if node == nil {
+		return
+	}
+	if _, ok := p.spans[node]; !ok {
+		p.spans[node] = Span{Start: start, End: p.currentToken}
+	}
+}
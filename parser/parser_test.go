@@ -2,10 +2,13 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/kellemNegasi/monkeylang/ast"
 	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -74,6 +77,70 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	t.FailNow()
 }
 
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		names    []string
+	}{
+		{"let [a, b] = pair;", "let [a, b] = pair;", []string{"a", "b"}},
+		{"let [head, ...tail] = xs", "let [head, ...tail] = xs;", []string{"head", "tail"}},
+		{"let [] = xs;", "let [] = xs;", nil},
+		{"let {name, age: years} = person;", "let {name, age: years} = person;", []string{"name", "years"}},
+		{`let {"k": [x, {y}], z} = h;`, "let {k: [x, {y}], z} = h;", []string{"x", "y", "z"}},
+		{"let [[a], {b: [c, ...d]}] = v;", "let [[a], {b: [c, ...d]}] = v;", []string{"a", "c", "d"}},
+		{"let [_, b, {c: _}] = v;", "let [_, b, {c: _}] = v;", []string{"b"}},
+		{"let {1: a, -2: b, true: c} = h;", "let {1: a, -2: b, true: c} = h;", []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name != nil || stmt.Pattern == nil {
+			t.Errorf("%q: destructuring let has Name=%v, Pattern=%v", tt.input, stmt.Name, stmt.Pattern)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expected, stmt.String())
+		}
+		var names []string
+		for _, name := range stmt.Names() {
+			names = append(names, name.Value)
+		}
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("%q: wrong names. want=%q, got=%q", tt.input, tt.names, names)
+		}
+	}
+}
+
+func TestDestructuringLetErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, a] = xs;", "line 1, column 9: duplicate binding a in pattern"},
+		{"let {a, b: [c, a]} = h;", "line 1, column 16: duplicate binding a in pattern"},
+		{"let [a, ...a] = xs;", "line 1, column 12: duplicate binding a in pattern"},
+		{"let [...rest, a] = xs;", "line 1, column 13: the rest element must be the last in an array pattern"},
+		{"let [a, 1] = xs;", "line 1, column 9: expected a pattern, got INT instead"},
+		{"let {[1]: a} = h;", "line 1, column 6: expected a hash pattern key, got [ instead"},
+		{`let {"a"} = h;`, "line 1, column 9: expected next token to be :, got } instead"},
+		{"let [a b] = xs;", "line 1, column 8: expected next token to be ,, got IDENT instead"},
+		{"let [a, ...] = xs;", "line 1, column 12: expected next token to be IDENT, got ] instead"},
+		{`let {a: "b"} = h;`, "line 1, column 9: expected a pattern, got STRING instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errors := p.Errors(); len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong first error. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestParseReturnStatement(t *testing.T) {
 	input := `
 	return 5;
@@ -312,6 +379,70 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
 		},
+		{
+			"3 > 5 == false",
+			"((3 > 5) == false)",
+		},
+		{
+			"!(true == true)",
+			"(!(true == true))",
+		},
+		{
+			"(5 + 5) * 2",
+			"((5 + 5) * 2)",
+		},
+		{
+			"-(5 + 5)",
+			"(-(5 + 5))",
+		},
+		{
+			"a + add(b * c) + d",
+			"((a + add((b * c))) + d)",
+		},
+		{
+			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+		},
+		{
+			"a |> f(b) |> g",
+			"((a |> f(b)) |> g)",
+		},
+		{
+			"a + b |> f == c",
+			"((a + b) |> (f == c))",
+		},
+		{
+			"a |> (b |> c)",
+			"(a |> (b |> c))",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"a == b ? c + d : e |> f",
+			"(((a == b) ? (c + d) : e) |> f)",
+		},
+		{
+			"a ?? b ?? c == d",
+			"((a ?? b) ?? (c == d))",
+		},
+		{
+			"a ?? b ? c : d ?? e",
+			"((a ?? b) ? c : (d ?? e))",
+		},
+		{
+			"-a?.b?.[c]?.(d).e",
+			"(-(((a?.b)?.[c])?.(d).e))",
+		},
+		{
+			"a?.b ?? null",
+			"((a?.b) ?? null)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -325,3 +456,718 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestLetAndReturnValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5 * y;", "let x = (5 * y);"},
+		{"let f = fn(a) { a };", "let f = fn(a) a;"},
+		{"return x + 1;", "return (x + 1);"},
+		{"return true", "return true;"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { y; z }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+	if exp.Condition.String() != "(x < y)" {
+		t.Errorf("exp.Condition wrong. got=%q", exp.Condition.String())
+	}
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statement. got=%d", len(exp.Consequence.Statements))
+	}
+	if exp.Alternative == nil || len(exp.Alternative.Statements) != 2 {
+		t.Fatalf("alternative is not 2 statements. got=%+v", exp.Alternative)
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input               string
+		catch, finally      bool
+		parameter, expected string
+	}{
+		{"try { f(x) } catch (e) { e }", true, false, "e", "try f(x) catch(e) e"},
+		{"try { f(x) } finally { g() }", false, true, "", "try f(x) finally g()"},
+		{"try { f(x); } catch (err) {} finally { g(); }", true, true, "err", "try f(x) catch(err)  finally g()"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+		if (exp.Catch != nil) != tt.catch || (exp.Finally != nil) != tt.finally {
+			t.Errorf("%q: wrong blocks. catch=%v, finally=%v", tt.input, exp.Catch != nil, exp.Finally != nil)
+		}
+		if tt.catch && exp.Parameter.Value != tt.parameter {
+			t.Errorf("%q: wrong parameter. want=%q, got=%q", tt.input, tt.parameter, exp.Parameter.Value)
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expected, exp.String())
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	p := New(lexer.New(`throw {"code": 1}; throw x`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	for i, expected := range []string{"{code: 1}", "x"} {
+		stmt, ok := program.Statements[i].(*ast.ThrowStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[i])
+		}
+		if stmt.Value.String() != expected {
+			t.Errorf("wrong value. want=%q, got=%q", expected, stmt.Value.String())
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { x }", "line 1, column 10: expected next token to be CATCH or FINALLY, got EOF instead"},
+		{"try { x } catch { y }", "line 1, column 17: expected next token to be (, got { instead"},
+		{"try { x } catch (1) { y }", "line 1, column 18: expected next token to be IDENT, got INT instead"},
+		{"try x", "line 1, column 5: expected next token to be {, got IDENT instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errors := p.Errors(); len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong first error. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		arms     int
+		expected string
+	}{
+		{`match (x) { 0 => "zero", _ => "other" }`, 2, "match (x) { 0 => zero, _ => other }"},
+		{"match (f(x)) { [a, b] if a > b => a, [a, ...b] => b, }", 2,
+			"match (f(x)) { [a, b] if (a > b) => a, [a, ...b] => b }"},
+		{`match (h) { {"k": v, ok: true} => v + 1 }`, 1, "match (h) { {k: v, ok: true} => (v + 1) }"},
+		{"match (x) {}", 0, "match (x) {}"},
+		{"match (x) { -1 => a, - 0x2 => b, {-1: c, false: d} => c }", 3, "match (x) { -1 => a, -0x2 => b, {-1: c, false: d} => c }"},
+		{"match (x) { null => 0, [null, a] => a }", 2, "match (x) { null => 0, [null, a] => a }"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.MatchExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+		}
+		if len(exp.Arms) != tt.arms {
+			t.Errorf("%q: wrong number of arms. want=%d, got=%d", tt.input, tt.arms, len(exp.Arms))
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expected, exp.String())
+		}
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { _ => 1 }", "line 1, column 7: expected next token to be (, got IDENT instead"},
+		{"match (x) _ => 1", "line 1, column 11: expected next token to be {, got IDENT instead"},
+		{"match (x) { 1 }", "line 1, column 15: expected next token to be =>, got } instead"},
+		{"match (x) { 1 => 2 3 => 4 }", "line 1, column 20: expected next token to be ,, got INT instead"},
+		{"match (x) { [a, a] => a }", "line 1, column 17: duplicate binding a in pattern"},
+		{"match (x) { -a => a }", "line 1, column 13: expected a pattern, got - instead"},
+		{"match (x) { a + 1 => a }", "line 1, column 15: expected next token to be =>, got + instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errors := p.Errors(); len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong first error. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestUnderscore(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let _ = 3;", "let _ = 3;"},
+		{"fn(_) { 1 }", "fn(_) 1"},
+		{"(_) => 1", "(_) => 1"},
+		{"let [_, a] = xs;", "let [_, a] = xs;"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("match (x) { _ => 1 }")).ParseProgram()
+	match := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	if _, ok := match.Arms[0].Pattern.(*ast.WildcardPattern); !ok {
+		t.Errorf("`_` in a match arm is not a wildcard. got=%T", match.Arms[0].Pattern)
+	}
+}
+
+func TestModuleStatements(t *testing.T) {
+	p := New(lexer.New(`import "lib/math.mk" as math; export let y = math.pi.digits(2);`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	imp, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if imp.Path.Value != "lib/math.mk" || imp.Name.Value != "math" {
+		t.Errorf("wrong import. path=%q, name=%q", imp.Path.Value, imp.Name.Value)
+	}
+	exp, ok := program.Statements[1].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ExportStatement. got=%T", program.Statements[1])
+	}
+	if exp.Statement.Name.Value != "y" {
+		t.Errorf("wrong export name. got=%q", exp.Statement.Name.Value)
+	}
+	call, ok := exp.Statement.Value.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("export value not *ast.CallExpression. got=%T", exp.Statement.Value)
+	}
+	if _, ok := call.Function.(*ast.MemberExpression); !ok {
+		t.Fatalf("callee not *ast.MemberExpression. got=%T", call.Function)
+	}
+	if got := exp.String(); got != "export let y = ((math.pi).digits)(2);" {
+		t.Errorf("wrong String(). got=%q", got)
+	}
+}
+
+func TestModuleStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import lib as lib;`, "line 1, column 8: expected next token to be STRING, got IDENT instead"},
+		{`import "lib.mk";`, "line 1, column 16: expected next token to be AS, got ; instead"},
+		{`import "lib.mk" as "lib";`, "line 1, column 20: expected next token to be IDENT, got STRING instead"},
+		{`export fn() {};`, "line 1, column 8: expected next token to be LET, got FUNCTION instead"},
+		{`a.1`, "line 1, column 3: expected next token to be IDENT, got INT instead"},
+		{`fn() { import "lib.mk" as lib; }`, "line 1, column 8: import statements are only allowed at the top level"},
+		{`if (x) { export let y = 1; }`, "line 1, column 10: export statements are only allowed at the top level"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errors := p.Errors(); len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong first error. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{"fn() {};", []string{}},
+		{"fn(x) {};", []string{"x"}},
+		{"fn(x, y, z) { x + y; };", []string{"x", "y", "z"}},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			if function.Parameters[i].Name.Value != ident {
+				t.Errorf("parameter %d wrong. want %q, got=%q", i, ident, function.Parameters[i].Name.Value)
+			}
+		}
+	}
+}
+
+func TestFunctionParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		defaults int
+		rest     string
+		expected string
+	}{
+		{"fn(a, b = 2) { a + b }", 1, "", "fn(a, b = 2) (a + b)"},
+		{"fn(a = 1, b = a * 2) { b }", 2, "", "fn(a = 1, b = (a * 2)) b"},
+		{"fn(a, ...rest) { rest }", 0, "rest", "fn(a, ...rest) rest"},
+		{"fn(...xs) { xs }", 0, "xs", "fn(...xs) xs"},
+		{"fn(a, b = [1], ...c) { c }", 1, "c", "fn(a, b = [1], ...c) c"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+		defaults := 0
+		for _, param := range function.Parameters {
+			if param.Default != nil {
+				defaults++
+			}
+		}
+		if defaults != tt.defaults {
+			t.Errorf("%q: wrong number of defaults. want=%d, got=%d", tt.input, tt.defaults, defaults)
+		}
+		if rest := function.Rest; rest == nil && tt.rest != "" || rest != nil && rest.Value != tt.rest {
+			t.Errorf("%q: wrong rest parameter. want=%q, got=%v", tt.input, tt.rest, rest)
+		}
+		if function.String() != tt.expected {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expected, function.String())
+		}
+	}
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) { b }", "line 1, column 11: parameter b without a default follows one with a default"},
+		{"fn(...a, b) { b }", "line 1, column 8: the rest parameter must be the last"},
+		{"fn(...a = []) { a }", "line 1, column 9: expected next token to be ), got = instead"},
+		{"fn(...) { 1 }", "line 1, column 7: expected next token to be IDENT, got ) instead"},
+		{"fn(1) { 1 }", "line 1, column 4: expected next token to be IDENT, got INT instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errors := p.Errors(); len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong first error. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestSpreadElements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f(...xs)", "f(...xs)"},
+		{"f(a, ...g(b), c)", "f(a, ...g(b), c)"},
+		{"[...a, ...b]", "[...a, ...b]"},
+		{"[0, ...a + b]", "[0, ...(a + b)]"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestArrowFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(x) => x * 2", "(x) => (x * 2)"},
+		{"() => 1", "() => 1"},
+		{"(a, b = 1, ...c) => [a, b, c]", "(a, b = 1, ...c) => [a, b, c]"},
+		{"(...xs) => len(xs)", "(...xs) => len(xs)"},
+		{"(a) => (b) => a + b", "(a) => (b) => (a + b)"},
+		{"xs |> (x) => x + 1 |> f", "((xs |> (x) => (x + 1)) |> f)"},
+		{"((x) => x)(1)", "(x) => x(1)"},
+		{"(x)", "x"},
+		{"((x)) + 1", "(x + 1)"},
+		{"match (v) { x if (x) => x }", "match (v) { x if x => x }"},
+		{"match (v) { x if f((y) => y) => x }", "match (v) { x if f((y) => y) => x }"},
+		{"match (v) { _ => (y) => y }", "match (v) { _ => (y) => y }"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []struct {
+		input       string
+		strings     []string
+		expressions []string
+	}{
+		{"`plain`", []string{"plain"}, nil},
+		{"``", []string{""}, nil},
+		{"`a ${x} b`", []string{"a ", " b"}, []string{"x"}},
+		{"`${x}${y + 1}`", []string{"", "", ""}, []string{"x", "(y + 1)"}},
+		{"`${ {\"a\": `}`}[\"a\"] }!`", []string{"", "!"}, []string{"({a: `}`}[a])"}},
+		{"`${(x) => x}`", []string{"", ""}, []string{"(x) => x"}},
+		{"`${`${`${x}`}`}`", []string{"", ""}, []string{"`${`${x}`}`"}},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		template, ok := stmt.Expression.(*ast.TemplateLiteral)
+		if !ok {
+			t.Fatalf("%q: expression is not *ast.TemplateLiteral. got=%T", tt.input, stmt.Expression)
+		}
+		if !reflect.DeepEqual(template.Strings, tt.strings) {
+			t.Errorf("%q: wrong strings. want=%q, got=%q", tt.input, tt.strings, template.Strings)
+		}
+		var expressions []string
+		for _, e := range template.Expressions {
+			expressions = append(expressions, e.String())
+		}
+		if !reflect.DeepEqual(expressions, tt.expressions) {
+			t.Errorf("%q: wrong expressions. want=%q, got=%q", tt.input, tt.expressions, expressions)
+		}
+	}
+
+	// Templates are operands like any other literal.
+	p := New(lexer.New("`a${1}` + f(`b`)[0] == `c`"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if got := program.String(); got != "((`a${1}` + (f(`b`)[0])) == `c`)" {
+		t.Errorf("wrong String(). got=%q", got)
+	}
+}
+
+func TestTemplateLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"`a ${} b`", "line 1, column 6: empty template hole"},
+		{"`a ${x} ${\n}`", "line 2, column 1: empty template hole"},
+		{"`a ${x y} b`", "line 1, column 8: expected next token to be }, got IDENT instead"},
+		{"`a ${x", "line 1, column 7: expected next token to be }, got EOF instead"},
+		{"`a ${1 +} b`", "line 1, column 9: no prefix parse function for TEMPLATE_TAIL found"},
+		{"`a ${x} b", "line 1, column 7: expected next token to be }, got ILLEGAL instead"},
+		{"`a ${\n  f(1,\n  ]) } b`", "line 3, column 3: no prefix parse function for ] found"},
+		{"`${`${[1, {}}`} ${fn(x) { let = x }}`", "line 1, column 13: expected next token to be ], got TEMPLATE_TAIL instead"},
+		{"`a ${fn(x) { let = x }}`", "line 1, column 18: expected next token to be IDENT, got = instead"},
+		{"`${match (x) { -y => 1 }}`", "line 1, column 16: expected a pattern, got - instead"},
+		{"`a", "line 1, column 1: no prefix parse function for ILLEGAL found"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errors := p.Errors(); len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong first error. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestNullishOperators(t *testing.T) {
+	p := New(lexer.New("a?.b ?? c ? null : d?.(1)?.[2]"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	cond, ok := stmt.Expression.(*ast.ConditionalExpression)
+	if !ok {
+		t.Fatalf("expression is not *ast.ConditionalExpression. got=%T", stmt.Expression)
+	}
+	coalesce, ok := cond.Condition.(*ast.CoalesceExpression)
+	if !ok {
+		t.Fatalf("condition is not *ast.CoalesceExpression. got=%T", cond.Condition)
+	}
+	if member, ok := coalesce.Left.(*ast.MemberExpression); !ok || !member.Optional || member.Token.Type != token.OPTIONAL {
+		t.Errorf("left of ?? is not an optional member access. got=%#v", coalesce.Left)
+	}
+	if _, ok := cond.Consequence.(*ast.NullLiteral); !ok {
+		t.Errorf("consequence is not *ast.NullLiteral. got=%T", cond.Consequence)
+	}
+	index, ok := cond.Alternative.(*ast.IndexExpression)
+	if !ok || !index.Optional {
+		t.Fatalf("alternative is not an optional index. got=%#v", cond.Alternative)
+	}
+	if call, ok := index.Left.(*ast.CallExpression); !ok || !call.Optional || len(call.Arguments) != 1 {
+		t.Errorf("indexed value is not an optional call. got=%#v", index.Left)
+	}
+}
+
+func TestNullishOperatorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a ? b", "line 1, column 6: expected next token to be :, got EOF instead"},
+		{"a ? b ; c", "line 1, column 7: expected next token to be :, got ; instead"},
+		{"a ?? ", "line 1, column 6: no prefix parse function for EOF found"},
+		{"a?.1", "line 1, column 4: expected next token to be IDENT, got INT instead"},
+		{"a?.[1", "line 1, column 6: expected next token to be ], got EOF instead"},
+		{"let null = 1;", "line 1, column 5: expected next token to be IDENT, got NULL instead"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errors := p.Errors(); len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong first error. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestArrowFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"() + 1", "line 1, column 4: expected next token to be =>, got + instead"},
+		{"(a, 1) => a", "line 1, column 5: expected next token to be IDENT, got INT instead"},
+		{"(a = 1, b) => a", "line 1, column 9: parameter b without a default follows one with a default"},
+		{"(a + b) => a", "line 1, column 9: no prefix parse function for => found"},
+		{"(x) => ", "line 1, column 8: no prefix parse function for EOF found"},
+		{"match (v) { x if () => x }", "line 1, column 19: no prefix parse function for ) found"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if errors := p.Errors(); len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong first error. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+	if exp.Function.String() != "add" {
+		t.Errorf("exp.Function wrong. got=%q", exp.Function.String())
+	}
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	testIntegerLiteral(t, exp.Arguments[0], 1)
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	p := New(lexer.New("[1, 2 * 2, 3 + 3]"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("expression is not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+	testIntegerLiteral(t, array.Elements[0], 1)
+	if array.Elements[1].String() != "(2 * 2)" || array.Elements[2].String() != "(3 + 3)" {
+		t.Errorf("wrong elements: %s", array.String())
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{}", "{}"},
+		{`{"one": 1, "two": 2}`, `{one: 1, two: 2}`},
+		{`{1: a + b, true: f(x), "k": [1]}`, `{1: (a + b), true: f(x), k: [1]}`},
+		{`{"a": {"b": 1}}["a"]["b"]`, `(({a: {b: 1}}[a])[b])`},
+		{`let h = {"x": 1};`, `let h = {x: 1};`},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+
+	p := New(lexer.New(`{"one": 1, 2 + 3: "five"}`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	hash, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("expression is not ast.HashLiteral. got=%T", program.Statements[0])
+	}
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("hash has wrong number of pairs. got=%d", len(hash.Pairs))
+	}
+	// Pairs keep their source order.
+	if hash.Pairs[0].Key.String() != "one" || hash.Pairs[1].Key.String() != "(2 + 3)" {
+		t.Errorf("wrong keys: %s", hash.String())
+	}
+	testIntegerLiteral(t, hash.Pairs[0].Value, 1)
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"myArray[1 + 1]", "(myArray[(1 + 1)])"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"f(x)[0]", "(f(x)[0])"},
+		{"-a[0]", "(-(a[0]))"},
+		{"a[0][1]", "((a[0])[1])"},
+		{"a.b(1)[2].c", "(((a.b)(1)[2]).c)"},
+		{"-a.b * c.d", "((-(a.b)) * (c.d))"},
+		{"a.b.c + f(x).y", "(((a.b).c) + (f(x).y))"},
+		{"[]", "[]"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + -x", ""},
+		{"--x", ""},
+		{"---x", "line 1, column 4: expression nested too deeply (maximum depth 3)"},
+		{"let a = (1); let b = ((\n(2)));", "line 2, column 2: expression nested too deeply (maximum depth 3)"},
+		{"if (a) { if (b) { c } }", ""},
+		{"if (a) { if (b) { if (c) { d } } }", "line 1, column 23: expression nested too deeply (maximum depth 3)"},
+		{"f(g(h(1)))", "line 1, column 7: expression nested too deeply (maximum depth 3)"},
+		{"let = 1; !!!!x", "line 1, column 5: expected next token to be IDENT, got = instead"},
+		{"let [[a]] = x;", ""},
+		{"let [[{b: [c]}]] = x;", "line 1, column 11: expression nested too deeply (maximum depth 3)"},
+		{"`a ${f(1)}`", ""},
+		{"`a\n ${ f(g(h(1))) }`", "line 2, column 9: expression nested too deeply (maximum depth 3)"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.SetMaxDepth(3)
+		p.ParseProgram()
+		errors := p.Errors()
+		if tt.expected == "" {
+			if len(errors) != 0 {
+				t.Errorf("%q: unexpected errors %q", tt.input, errors)
+			}
+			continue
+		}
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong first error. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+// TestPathologicalNesting checks that deeply nested input is reported with a
+// single error instead of exhausting the stack.
+func TestPathologicalNesting(t *testing.T) {
+	const n = 100000
+	inputs := []string{
+		strings.Repeat("-", n) + "1",
+		strings.Repeat("(", n) + "1" + strings.Repeat(")", n),
+		strings.Repeat("(", n),
+		strings.Repeat("!(", n),
+		strings.Repeat("fn() { ", n),
+		strings.Repeat("if (x) { ", n),
+		strings.Repeat("f(", n),
+		strings.Repeat("`${", n),
+		"let " + strings.Repeat("[", n),
+		"let " + strings.Repeat("{a: ", n),
+	}
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != 1 || !strings.Contains(errors[0], "expression nested too deeply (maximum depth 1000)") {
+			t.Errorf("%.10q...: wrong errors %.200q", input, errors)
+		}
+	}
+}
@@ -3,31 +3,113 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
-	"github.com/kellemNegasi/monkeylang/token"
-
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/astdump"
+	"github.com/kellemNegasi/monkeylang/compiler"
 	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/object"
+	"github.com/kellemNegasi/monkeylang/parser"
+	"github.com/kellemNegasi/monkeylang/vm"
 )
 
 // PROMPT defines an entry point that prompts the user to enter input.
 const PROMPT = ">>"
 
-// Start starts the repl.
+// commands are REPL commands that print the syntax tree of the rest of the line.
+var commands = map[string]func(io.Writer, ast.Node) error{
+	":sexpr": astdump.SExpr,
+	":dot":   astdump.DOT,
+}
+
+// Start starts the repl. Each line is compiled and run on the virtual
+// machine; definitions carry over to the following lines.
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTableWithBuiltins()
+
 	for {
-		fmt.Printf(PROMPT)
+		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
 		line := scanner.Text()
-		l := lexer.New(line)
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+		if name, rest, _ := strings.Cut(line, " "); strings.HasPrefix(name, ":") {
+			runCommand(out, name, rest)
+			continue
+		}
+		p := parser.New(lexer.New(line))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			printParserErrors(out, p.Errors())
+			continue
 		}
+
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(program); err != nil {
+			fmt.Fprintf(out, "compilation failed: %s\n", err)
+			continue
+		}
+		code := comp.Bytecode()
+		constants = code.Constants
+
+		machine := vm.NewWithGlobalsStore(code, globals)
+		if err := machine.Run(); err != nil {
+			var re *vm.RuntimeError
+			if errors.As(err, &re) {
+				fmt.Fprintf(out, "ERROR: %s\n", re.StackTrace())
+			} else {
+				fmt.Fprintf(out, "ERROR: %s\n", err)
+			}
+			continue
+		}
+		if producesValue(program) {
+			fmt.Fprintf(out, "%s\n", machine.LastPoppedStackElem().Inspect())
+		}
+	}
+}
+
+// producesValue reports whether program ends with a statement that has a
+// value to print.
+func producesValue(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	switch program.Statements[len(program.Statements)-1].(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		return true
+	}
+	return false
+}
+
+func printParserErrors(out io.Writer, errors []string) {
+	for _, msg := range errors {
+		fmt.Fprintf(out, "\t%s\n", msg)
+	}
+}
+
+// runCommand parses input and prints its tree with the named command.
+func runCommand(out io.Writer, name, input string) {
+	dump, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(out, "unknown command %s (available: :sexpr, :dot)\n", name)
+		return
+	}
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		printParserErrors(out, p.Errors())
+		return
+	}
+	if err := dump(out, program); err != nil {
+		fmt.Fprintf(out, "%v\n", err)
 	}
 }
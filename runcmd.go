@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/compiler"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/mkc"
+	"github.com/kellemNegasi/monkeylang/parser"
+	"github.com/kellemNegasi/monkeylang/vm"
+)
+
+// runMain implements `monkey run file`, which runs a source file or a
+// compiled .mkc file on the virtual machine. A runtime error is printed with
+// its stack trace.
+func runMain(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: monkey run file\n")
+		return 2
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey run: %v\n", err)
+		return 1
+	}
+	bytecode, err := load(args[0], data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey run: %s: %v\n", args[0], err)
+		return 1
+	}
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		var re *vm.RuntimeError
+		if errors.As(err, &re) {
+			fmt.Fprintf(os.Stderr, "monkey run: %s\n", re.StackTrace())
+		} else {
+			fmt.Fprintf(os.Stderr, "monkey run: %v\n", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+// buildMain implements `monkey build [-o output] file`, which compiles a
+// source file to a .mkc file. The output defaults to the source path with
+// its extension replaced by .mkc.
+func buildMain(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	output := flags.String("o", "", "write the compiled program to `file`")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: monkey build [-o output] file\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := flags.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+	}
+	if *output == path {
+		fmt.Fprintf(os.Stderr, "monkey build: output would overwrite the source file %s\n", path)
+		return 1
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey build: %v\n", err)
+		return 1
+	}
+	bytecode, err := compileSource(path, src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey build: %s: %v\n", path, err)
+		return 1
+	}
+	data, err := mkc.Encode(bytecode)
+	if err == nil {
+		err = os.WriteFile(*output, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey build: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// load returns the bytecode of data, the contents of the file path, which is
+// either Monkey source or a .mkc file.
+func load(path string, data []byte) (*compiler.Bytecode, error) {
+	if mkc.IsCompiled(data) {
+		return mkc.Decode(data)
+	}
+	return compileSource(path, data)
+}
+
+// compileSource parses and compiles Monkey source read from the file path,
+// which may be empty for standard input.
+func compileSource(path string, src []byte) (*compiler.Bytecode, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+	program.File = path
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	return comp.Bytecode(), nil
+}
@@ -0,0 +1,4 @@
+// want: 37
+let a = 5 * (2 + 3);
+let b = 0x10 - 0b11;
+a - b / 2 + 18
@@ -0,0 +1,5 @@
+// want: [1, 4, [3, 2], 6, null, null]
+let double = fn(x) { x * 2 };
+let xs = [1, double(2), [3, 2]];
+let nested = xs[2];
+[xs[0], xs[1], nested, nested[0] * nested[1], xs[3], xs[-1]]
@@ -0,0 +1,2 @@
+// want: false
+!!0 == !true
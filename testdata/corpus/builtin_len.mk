@@ -0,0 +1,3 @@
+// want: 5
+let size = fn(s) { len(s) };
+size("hello")
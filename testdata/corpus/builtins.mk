@@ -0,0 +1,5 @@
+// want: [3, 1, 3, [2, 3], [1, 2, 3, 4], [1, 2, 3], null, null, INTEGER, FUNCTION, BUILTIN, ARRAY, 42, true]
+let xs = [1, 2, 3];
+let ys = push(xs, 4);
+[len(xs), first(xs), last(xs), rest(xs), ys, xs, first([]), rest([]),
+  type(1), type(fn() {}), type(len), type(xs), str(42), str(true) == "true"]
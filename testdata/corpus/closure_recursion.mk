@@ -0,0 +1,6 @@
+// want: 21
+let wrapper = fn() {
+  let countDown = fn(x) { if (x == 0) { 0 } else { x + countDown(x - 1) } };
+  countDown(6)
+};
+wrapper()
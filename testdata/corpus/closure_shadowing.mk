@@ -0,0 +1,4 @@
+// want: 3
+let x = 1;
+let f = fn() { let x = x + 1; fn() { x + 1 } };
+f()()
@@ -0,0 +1,5 @@
+// want: 10
+let adder = fn(x) { fn(y) { x + y } };
+let addFive = adder(5);
+let nest = fn(a) { fn(b) { fn(c) { a + b * c } } };
+addFive(nest(1)(2)(4) - 4)
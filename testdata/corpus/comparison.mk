@@ -0,0 +1,4 @@
+// want: true
+let small = 1 < 2;
+let big = 3 > 2;
+(small == big) != (1 == 2)
@@ -0,0 +1,3 @@
+// want: null
+let choose = fn(x) { if (x > 10) { "big" } };
+choose(3)
@@ -0,0 +1,10 @@
+// want: [1, 2, [3, 4], Monkey, 3, x, [], 5, 7, [8, 9]]
+let [a, b, ...rest] = [1, 2, 3, 4];
+let person = {"name": "Monkey", "age": 3, "tags": ["x"]};
+let {name, age: years, "tags": [tag, ...none]} = person;
+let sum = fn(pair) {
+  let [x, y] = pair;
+  x + y
+};
+let [[p], {"q": [q, ...qs]}] = [[7], {"q": [7, 8, 9]}];
+[a, b, rest, name, years, tag, none, sum([2, 3]), p, qs]
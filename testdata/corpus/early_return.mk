@@ -0,0 +1,3 @@
+// want: 7
+let f = fn() { if (true) { if (true) { return 7; } return 8; } 9 };
+f()
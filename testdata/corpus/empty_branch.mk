@@ -0,0 +1,3 @@
+// want: 10
+let f = fn(x) { if (x) { let y = 2; } else { 5 } };
+if (f(true)) { 0 } else { f(false) * 2 }
@@ -0,0 +1,3 @@
+// error: wrong number of arguments to add: want=2, got=1
+let add = fn(a, b) { a + b };
+add(1)
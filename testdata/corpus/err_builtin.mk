@@ -0,0 +1,2 @@
+// error: argument 1 to len must be STRING, ARRAY or HASH, got INTEGER
+len(1)
@@ -0,0 +1,3 @@
+// error: wrong number of arguments to pad: want=1..2, got=3
+let pad = fn(s, width = 10) { s };
+pad("a", 1, 2)
@@ -0,0 +1,6 @@
+// error: wrong number of array elements: want=2, got=3
+let swap = fn(pair) {
+  let [a, b] = pair;
+  [b, a]
+};
+swap([1, 2, 3])
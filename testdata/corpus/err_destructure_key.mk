@@ -0,0 +1,3 @@
+// error: hash has no key email
+let {name, email} = {"name": "Monkey", "age": 3};
+name
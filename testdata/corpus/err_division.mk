@@ -0,0 +1,3 @@
+// error: division by zero
+let f = fn(n) { 10 / n };
+f(0)
@@ -0,0 +1,2 @@
+// error: wrong number of arguments to first: want=1, got=2
+first([1], [2])
@@ -0,0 +1,3 @@
+// error: unusable as hash key: ARRAY
+let h = {"a": 1};
+h[[1]]
@@ -0,0 +1,3 @@
+// error: type mismatch: STRING == INTEGER
+let f = fn(s) { if (s == 1) { 1 } else { 2 } };
+f("one")
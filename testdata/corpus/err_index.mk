@@ -0,0 +1,3 @@
+// error: index operator not supported: INTEGER[INTEGER]
+let x = 5;
+x[0]
@@ -0,0 +1,4 @@
+// error: identifier not found: later
+let f = fn() { later };
+f();
+let later = 1;
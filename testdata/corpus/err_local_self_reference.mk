@@ -0,0 +1,3 @@
+// error: identifier not found: x
+let f = fn() { let x = x + 1; x };
+f()
@@ -0,0 +1,5 @@
+// error: non-exhaustive match: no arm matches [1, 2, 3]
+let first = fn(xs) {
+  match (xs) { [] => 0, [x] => x, [x, y] => x }
+};
+first([1, 2, 3])
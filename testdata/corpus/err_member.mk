@@ -0,0 +1,3 @@
+// error: hash has no member email
+let user = {"name": "Monkey"};
+user.email
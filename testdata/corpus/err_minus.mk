@@ -0,0 +1,2 @@
+// error: unknown operator: -BOOLEAN
+-true
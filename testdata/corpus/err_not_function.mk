@@ -0,0 +1,3 @@
+// error: not a function: INTEGER
+let x = 1;
+x(2)
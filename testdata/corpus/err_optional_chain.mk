@@ -0,0 +1,3 @@
+// error: member access not supported: NULL.name
+let user = {"boss": null};
+user?.boss.name
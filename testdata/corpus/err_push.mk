@@ -0,0 +1,2 @@
+// error: argument 1 to push must be ARRAY, got STRING
+push("abc", 1)
@@ -0,0 +1,4 @@
+// error: division by zero
+let divide = fn(a, b) { a / b };
+let logged = fn(a, b) { try { divide(a, b) } catch (e) { throw e; } finally { 0 } };
+logged(1, 0) + 1
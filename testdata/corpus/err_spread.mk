@@ -0,0 +1,3 @@
+// error: cannot spread INTEGER
+let f = fn(...xs) { xs };
+f(1, ...2)
@@ -0,0 +1,3 @@
+// error: stack overflow: call depth limit of 1024 exceeded
+let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } };
+sum(1023) + sum(1024)
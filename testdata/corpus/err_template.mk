@@ -0,0 +1,3 @@
+// error: type mismatch: INTEGER + STRING
+let count = 3;
+`${count} items, ${count + "s"}`
@@ -0,0 +1,2 @@
+// error: type mismatch: INTEGER + BOOLEAN
+1 + true
@@ -0,0 +1,3 @@
+// error: identifier not found: missing
+let f = fn() { missing };
+f()
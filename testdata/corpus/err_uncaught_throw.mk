@@ -0,0 +1,4 @@
+// error: uncaught exception: {reason: not found}
+let find = fn(key) { throw {"reason": "not found"}; };
+let lookup = fn(key) { let value = find(key); value };
+lookup("x")
@@ -0,0 +1,2 @@
+// error: unknown operator: STRING - STRING
+"a" - "b"
@@ -0,0 +1,3 @@
+// error: identifier not found: w
+if (false) { let w = 1; };
+w
@@ -0,0 +1,7 @@
+// error: identifier not found: v
+let f = fn() {
+  let t = fn() { throw 1 };
+  try { let v = t(); } catch (e) { 0 };
+  v
+};
+f()
@@ -0,0 +1,4 @@
+// want: [fn(...) {...}, fn(...) {...}, f is fn(...) {...}, fn(...) {...}]
+let add = fn(a, b) { a + b };
+let adder = fn(x) { fn(y) { x + y } };
+[add, str(adder(1)), `f is ${(x) => x}`, [add][0]]
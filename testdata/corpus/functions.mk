@@ -0,0 +1,4 @@
+// want: 120
+let mul = fn(a, b) { a * b };
+let apply = fn(f, a, b) { f(a, b) };
+apply(mul, apply(mul, 2, 3), apply(mul, 4, 5))
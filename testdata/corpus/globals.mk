@@ -0,0 +1,12 @@
+// want: [2, FUNCTION, 10, 3, [1, 2]]
+let x = 1;
+let f = fn() { x };
+let x = 2;
+let never = fn() { missing };
+let twice = fn(n) { helper(n) * 2 };
+let helper = fn(n) { n + 3 };
+let count = fn() { counter };
+let counter = 3;
+let [a, b] = [x, x];
+let [a, b] = [1, 2];
+[f(), type(never), twice(2), count(), [a, b]]
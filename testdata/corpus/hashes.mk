@@ -0,0 +1,5 @@
+// want: [{name: Monkey, 1: one, true: yes}, Monkey, one, yes, null, 3, {b: 2, a: 3}]
+let key = "name";
+let h = {key: "Monkey", 1: "one", 1 > 0: "yes"};
+let count = fn(h) { len(h) };
+[h, h["name"], h[2 - 1], h[true], h["1"], count(h), {"b": 1, "a": 3, "b": 2}]
@@ -0,0 +1,13 @@
+// want: [minus one, min, [1, 2], b, [x, y], other, -0x10]
+let name = fn(v) {
+  match (v) {
+    -1 => "minus one",
+    -9223372036854775808 => "min",
+    {1: a, -2: b} => [a, b],
+    {true: t} => t,
+    _ => "other",
+  }
+};
+let {0: first, false: second} = {0: "x", false: "y"};
+[name(-1), name(-9223372036854775807 - 1), name({1: 1, -2: 2}), name({true: "b"}),
+ [first, second], name(1), match (-16) { -0x10 => "-0x10" }]
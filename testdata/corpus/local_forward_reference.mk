@@ -0,0 +1,7 @@
+// want: 2
+let f = fn() {
+  let g = fn() { b };
+  let b = 2;
+  g()
+};
+f()
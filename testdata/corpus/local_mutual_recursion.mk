@@ -0,0 +1,7 @@
+// want: false
+let f = fn() {
+  let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+  let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+  even(7)
+};
+f()
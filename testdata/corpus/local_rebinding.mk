@@ -0,0 +1,7 @@
+// want: 9
+let f = fn(n) {
+  let g = fn() { n };
+  let n = 9;
+  g()
+};
+f(1)
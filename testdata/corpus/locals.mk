@@ -0,0 +1,4 @@
+// want: 33
+let g = 10;
+let f = fn(a) { let b = a * 2; let c = b + g; c + 1 };
+f(11)
@@ -0,0 +1,22 @@
+// want: [zero, 3, 5, other, [3, 4], other, yes, other, [], 10000, [neg, pos, ten]]
+let describe = fn(v) {
+  match (v) {
+    0 => "zero",
+    [x, y] => x + y,
+    {"k": v} if v > 1 => v,
+    [1, [_, 2], ...rest] => rest,
+    true => "yes",
+    _ => "other",
+  }
+};
+let tail = fn(xs) { match (xs) { [_, ...rest] => rest } };
+let count = fn(n, acc) {
+  match (n) {
+    0 => acc,
+    _ => count(n - 1, acc + 1)
+  }
+};
+let sign = fn(n) { match (n) { 10 => "ten", x if x < 0 => "neg", _ => "pos" } };
+[describe(0), describe([1, 2]), describe({"k": 5}), describe({"k": 1}),
+ describe([1, [7, 2], 3, 4]), describe([1, [7, 3], 3, 4]), describe(true),
+ describe("0"), tail([1]), count(10000, 0), [sign(-1), sign(3), sign(10)]]
@@ -0,0 +1,12 @@
+// want: [1, 1, 6, 9]
+let x = 1;
+let a = match ([5, 3]) { [x, 2] => 0, _ => x };
+let b = match (5) { x if x > 9 => 0, _ => x };
+let f = fn() {
+  let y = 1;
+  match (5) { y if y > 9 => 0, z => y + z }
+};
+let g = fn(n) {
+  match (n) { m if (if (m > 1) { let k = m * 3; true } else { false }) => k }
+};
+[a, b, f(), g(3)]
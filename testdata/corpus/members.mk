@@ -0,0 +1,6 @@
+// want: [Monkey, 3, 90, 4, true, division by zero]
+let user = {"name": "Monkey", "age": 3, 1: "one"};
+let shapes = {"square": fn(n) { [n * n, {"area": n * n * 10}] }};
+let counter = {"tags": [{"size": 1}, {"size": 4}]};
+let caught = try { 1 / 0 } catch (e) { e };
+[user.name, user.age, shapes.square(user.age)[1].area, counter.tags[1].size, user.name == user["name"], caught.message]
@@ -0,0 +1,7 @@
+// want: true
+let isEven = fn(n) {
+  let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+  if (n == 0) { return true; }
+  isOdd(n - 1)
+};
+isEven(5000)
@@ -0,0 +1,3 @@
+// want: null
+let f = fn() { };
+f()
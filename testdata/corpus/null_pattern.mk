@@ -0,0 +1,10 @@
+// want: [none, [2], zero, other, other]
+let describe = fn(v) {
+  match (v) {
+    null => "none",
+    [null, x] => [x],
+    0 => "zero",
+    _ => "other",
+  }
+};
+[describe(null), describe([null, 2]), describe(0), describe(false), describe([0, 2])]
@@ -0,0 +1,17 @@
+// want: [yes, 0, [1, 3], null, 7, null, null, 3, no, b, c, 10000]
+let boom = fn() { throw "evaluated" };
+let user = {"name": "ada", "tags": ["x", "y"], "greet": fn(n) { n * 2 }, "boss": null};
+let count = (n, acc) => n == 0 ? acc : count(n - 1, acc + 1);
+let grade = (n) => n > 90 ? "a" : n > 80 ? "b" : "c";
+[true ? "yes" : boom(),
+ null ?? 0 ?? boom(),
+ [1 ?? boom(), false ?? 2 == 2 ? 2 : 3],
+ user.boss?.name,
+ user?.greet?.(3) + (user.boss?.(boom()) ?? 1),
+ user.boss?.[boom()],
+ user["missing"]?.(boom()),
+ user?.tags?.[1] == "y" ? 3 : 4,
+ null ? "yes" : "no",
+ grade(85),
+ grade(10),
+ count(10000, 0)]
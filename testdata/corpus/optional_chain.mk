@@ -0,0 +1,6 @@
+// want: [null, null, null, 7, 3, none]
+let h = null;
+let user = {"tags": [fn(x) { [x] }], "boss": null};
+let get = fn(v) { v?.name.first };
+[h?.a.b.c, h?.a(1)[0], get(null), user?.tags[0](7)[0],
+ [h?.a.b][0] ?? 3, user.boss?.name.first ?? "none"]
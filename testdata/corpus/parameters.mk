@@ -0,0 +1,12 @@
+// want: [3, 11, [1, 10, []], [1, 2, [3, 4]], [1, 10, 20, 30], [0, 1, 2, 3, 4], 10, [1, null], 3]
+let add = fn(a, b = 1) { a + b };
+let scaled = fn(a, b = a * 10, ...rest) { [a, b, rest] };
+let sum = fn(...xs) {
+  let go = fn(xs, acc) { if (len(xs) == 0) { acc } else { go(rest(xs), acc + first(xs)) } };
+  go(xs, 0)
+};
+let order = fn(a = b, b = 1) { [b, a] };
+let count = fn(n, ...acc) { if (n == 0) { len(acc) } else { count(n - 1, ...acc, n) } };
+let xs = [1, 2];
+[add(2), add(1, 10), scaled(1), scaled(1, 2, 3, 4), [1, ...[10, 20], 30], [0, ...xs, ...[], ...[3, 4]],
+ sum(...[1, 2, 3, 4]), order(), count(3)]
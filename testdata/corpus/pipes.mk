@@ -0,0 +1,17 @@
+// want: [[4, 8], 12, 6, [2, 3], 7, 10000, 3]
+let map = (xs, f, acc = []) => if (len(xs) == 0) { acc } else { map(rest(xs), f, push(acc, f(first(xs)))) };
+let filter = fn(xs, keep) {
+  let go = (xs, acc) => if (len(xs) == 0) { acc } else { go(rest(xs), if (keep(first(xs))) { push(acc, first(xs)) } else { acc }) };
+  go(xs, [])
+};
+let sum = (xs) => if (len(xs) == 0) { 0 } else { first(xs) + sum(rest(xs)) };
+let add = (a) => (b) => a + b;
+let sub = (a, b) => a - b;
+let count = (n, acc) => if (n == 0) { acc } else { n - 1 |> count(acc + 1) };
+[[1, 2, 3, 4] |> filter((x) => x / 2 * 2 == x) |> map((x) => x * 2),
+ [1, 2, 3, 4] |> filter((x) => x > 1) |> map((x) => x + 1) |> sum,
+ [1, 2, 3] |> (xs) => sum(xs),
+ [1, 2] |> map(add(1)),
+ 10 |> sub(3),
+ count(10000, 0),
+ (...xs) => len(xs) |> (f) => f(1, 2, 3)]
@@ -0,0 +1,3 @@
+// want: 55
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+fib(10)
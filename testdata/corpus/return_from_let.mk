@@ -0,0 +1,3 @@
+// want: 7
+let f = fn(c) { let x = if (c) { return 7; }; 8 };
+f(true)
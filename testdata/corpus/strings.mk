@@ -0,0 +1,3 @@
+// want: hello, world
+let greet = fn(name) { "hello, " + name };
+if (greet("x") == "hello, x") { greet("world") } else { "mismatch" }
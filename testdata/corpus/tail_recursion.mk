@@ -0,0 +1,3 @@
+// want: 50005000
+let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } };
+sum(10000, 0)
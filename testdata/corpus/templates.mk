@@ -0,0 +1,10 @@
+// want: [hello, hello, Monkey!, 1 + 2 = 3, [1, two] {k: true} null, nested: <a: 3>, } ${x} `, ]
+let name = "Monkey";
+let item = fn(k, v) { `<${k}: ${v}>` };
+[`hello`,
+ `${"hello"}, ${name}!`,
+ `${1} + ${2} = ${1 + 2}`,
+ `${[1, "two"]} ${{"k": true}} ${null}`,
+ `nested: ${item(`${"a"}`, {"n": 3}["n"])}`,
+ `${"}"} \${x} \``,
+ ``]
@@ -0,0 +1,12 @@
+// want: [boom, {code: 404}, [1, 2], null, 4, uncaught exception: 2]
+let catchAll = fn(f) { try { f() } catch (e) { e } };
+let rethrow = fn() { try { throw 2; } catch (e) { throw e * 2; } };
+let wrapped = fn() { try { throw 2; } catch (e) { throw "again"; } };
+[
+	catchAll(fn() { throw "boom"; }),
+	catchAll(fn() { throw {"code": 404}; }),
+	catchAll(fn() { throw [1, 2]; }),
+	catchAll(fn() { throw if (false) { 1 }; }),
+	catchAll(rethrow),
+	try { throw 2; } catch (e) { try { throw e; } catch (inner) { "uncaught exception: " + str(inner) } }
+]
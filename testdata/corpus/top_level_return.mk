@@ -0,0 +1,4 @@
+// want: 3
+let x = 1;
+return x + 2;
+x
@@ -0,0 +1,7 @@
+// want: [5, 0, argument 1 to len must be STRING, ARRAY or HASH, got INTEGER, [check (5:32), <main> (7:55)], ERROR]
+let divide = fn(a, b) { a / b };
+let safe = fn(a, b) { try { divide(a, b) } catch (e) { 0 } };
+let message = fn(e) { e["message"] };
+let check = fn(x) { let n = len(x); n };
+let caught = try { check(1) } catch (e) { e };
+[safe(10, 2), safe(1, 0), message(caught), try { check(1) } catch (e) { e["trace"] }, type(caught)]
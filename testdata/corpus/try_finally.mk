@@ -0,0 +1,7 @@
+// want: [1, 2, 3, 10, 7]
+let a = fn() { try { return 1; } finally { 100 } };
+let b = fn() { try { return 1; } finally { return 2; } };
+let c = fn() { try { 1 + true } catch (e) { return 3; } finally { 4 } };
+let d = fn(x) { try { try { return x; } finally { 20 } } finally { 30 } };
+let e = fn() { try { throw 1; } finally { return 7; } };
+[a(), b(), c(), d(10), e()]
@@ -0,0 +1,6 @@
+// want: [3, 1, 4, other, 2]
+let _ = 3;
+let one = fn(_) { 1 };
+let inc = (_) => _ + 1;
+let [_, b] = [1, 2];
+[_, one(9), inc(_), match (5) { 0 => "zero", _ => "other" }, b]
@@ -8,18 +8,29 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // 1-based line of the first character of the token
+	Column  int // 1-based column (in bytes) of the first character of the token
 }
 
 // keywords defiens map of keywords in the language.
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
-	"if":     IF,
-	"else":   ELSE,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"null":    NULL,
+	"return":  RETURN,
+	"if":      IF,
+	"else":    ELSE,
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"match":   MATCH,
 }
 
 // LookupIdent checks a given keyword wether it is an identifier or a keyword.
@@ -41,6 +52,22 @@ const (
 	IDENT = "IDENT" // variables and function names
 	// INT token represents integre variables i.e 123456789.
 	INT = "INT"
+	// STRING token represents string literals i.e "hello". Its literal holds the unquoted value.
+	STRING = "STRING"
+	// TEMPLATE is a backtick template literal without holes, such as
+	// `hello`. Like that of STRING, its literal holds the unquoted value.
+	TEMPLATE = "TEMPLATE"
+	// TEMPLATE_HEAD is the text of a template literal from its opening
+	// backtick up to its first `${` hole, TEMPLATE_MIDDLE the text from the
+	// `}` closing a hole up to the `${` opening the next and TEMPLATE_TAIL
+	// the text from the `}` closing the last hole up to the closing backtick.
+	// The tokens of the holes' expressions come between them.
+	TEMPLATE_HEAD   = "TEMPLATE_HEAD"
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE"
+	TEMPLATE_TAIL   = "TEMPLATE_TAIL"
+	// COMMENT represents a `//` line comment. The lexer skips comments and
+	// only reports them through Lexer.Comments.
+	COMMENT = "COMMENT"
 
 	// ASSIGN and other operators
 	ASSIGN   = "="
@@ -53,19 +80,38 @@ const (
 	GT       = ">"
 	EQ       = "=="
 	NOTEQ    = "!="
+	ARROW    = "=>"
+	PIPE     = "|>"
+	QUESTION = "?"
+	NULLISH  = "??"
+	OPTIONAL = "?."
 	// COMMA and other delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	DOT       = "."
+	ELLIPSIS  = "..."
 	LPAREN    = "("
 	RPAREN    = ")"
 	LBRACE    = "{"
 	RBRACE    = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
 	// FUNCTION and other keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
+	NULL     = "NULL"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	MATCH    = "MATCH"
 )
@@ -0,0 +1,25 @@
+package vm
+
+import (
+	"github.com/kellemNegasi/monkeylang/code"
+	"github.com/kellemNegasi/monkeylang/object"
+)
+
+// Frame is the activation record of a function call.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+	passed      int // the number of parameters the call passed arguments for
+}
+
+// NewFrame returns a frame for calling cl with its locals starting at
+// basePointer on the stack.
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+// Instructions returns the instructions of the function the frame executes.
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
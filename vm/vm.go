@@ -0,0 +1,1243 @@
+// Package vm implements the stack-based virtual machine that executes the
+// bytecode produced by the compiler.
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kellemNegasi/monkeylang/code"
+	"github.com/kellemNegasi/monkeylang/compiler"
+	"github.com/kellemNegasi/monkeylang/limits"
+	"github.com/kellemNegasi/monkeylang/object"
+)
+
+// Sizes of the machine. The stack and the frames grow past their initial
+// sizes as needed; the call depth is bounded by limits.Config.
+const (
+	StackSize   = 2048 // initial size of the stack
+	GlobalsSize = 65536
+	MaxFrames   = 1024 // initial number of frames
+)
+
+// The values of true, false and null are shared singletons.
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Null  = &object.Null{}
+)
+
+// VM executes bytecode. Runtime errors are reported with the same messages
+// the evaluator uses.
+type VM struct {
+	constants []object.Object
+	globals   []object.Object
+
+	stack []object.Object
+	sp    int // Always points to the next value. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler // installed by try expressions, innermost last
+
+	// modules holds the modules imported so far, by the function loading
+	// each.
+	modules map[*object.CompiledFunction]*object.Module
+
+	meter *limits.Meter
+}
+
+// handler catches the runtime errors raised inside a try expression.
+type handler struct {
+	frames  int  // the number of frames when it was installed
+	sp      int  // the stack pointer then
+	target  int  // the offset of the instructions handling the error
+	finally bool // whether it runs a finally block rather than a catch block
+}
+
+// New returns a machine ready to run bytecode.
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines, File: bytecode.File}
+	mainClosure := &object.Closure{Fn: mainFn}
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = NewFrame(mainClosure, 0)
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		stack:       make([]object.Object, StackSize),
+		frames:      frames,
+		framesIndex: 1,
+		modules:     map[*object.CompiledFunction]*object.Module{},
+		meter:       limits.NewMeter(context.Background(), limits.Config{}),
+	}
+}
+
+// NewWithGlobalsStore returns a machine sharing its globals with earlier
+// runs, as the REPL does between lines.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// LastPoppedStackElem returns the value of the last expression statement
+// executed, which is the result of the program.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if err := vm.meter.Enter(); err != nil {
+		return err
+	}
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, make([]*Frame, len(vm.frames))...)
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+// popFrame removes the current frame, with the handlers it installed.
+func (vm *VM) popFrame() *Frame {
+	vm.dropHandlers()
+	vm.meter.Leave()
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// RunContext is like Run but stops when ctx is done or the program exceeds
+// one of the limits of config, returning one of the error types of package
+// limits. A step is the execution of one instruction.
+func (vm *VM) RunContext(ctx context.Context, config limits.Config) error {
+	vm.meter = limits.NewMeter(ctx, config)
+	if err := vm.meter.Canceled(); err != nil {
+		return err
+	}
+	return vm.Run()
+}
+
+// RuntimeError is a runtime failure of a program.
+type RuntimeError struct {
+	Message string
+	Err     error // the Go error behind the failure, if a host function reported one
+	// Trace lists the calls being executed when the error occurred,
+	// innermost first. Calls replaced by tail calls are not part of it.
+	Trace []object.Frame
+	// Value is the value thrown by the throw statement that raised the
+	// error, if one did and the value was not an *object.ErrorValue.
+	Value object.Object
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// StackTrace returns the message of the error followed by its trace, one
+// frame per line.
+func (e *RuntimeError) StackTrace() string { return object.FormatTrace(e.Message, e.Trace) }
+
+// Run executes the program until its last instruction or a top-level return
+// statement. Unless RunContext set other limits, calls may nest at most
+// limits.DefaultMaxDepth deep.
+//
+// Runtime failures of the program are returned as *RuntimeError values and
+// exceeded limits as the error types of package limits. Try expressions
+// catch the former but not the latter.
+func (vm *VM) Run() error {
+	for {
+		err := vm.run()
+		switch err.(type) {
+		case nil, *limits.StepError, *limits.DepthError, *limits.AllocError, *limits.CanceledError:
+			return err
+		}
+		re, ok := err.(*RuntimeError)
+		if !ok {
+			re = &RuntimeError{Message: err.Error()}
+		}
+		if re.Trace == nil {
+			re.Trace = vm.trace()
+		}
+		if !vm.catch(re) {
+			return re
+		}
+	}
+}
+
+// catch hands re to the innermost handler, unwinding the frames and the
+// stack to where the handler was installed. It reports false if there is no
+// handler.
+func (vm *VM) catch(re *RuntimeError) bool {
+	if len(vm.handlers) == 0 {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	for vm.framesIndex > h.frames {
+		vm.popFrame()
+	}
+	vm.sp = h.sp
+	var caught object.Object
+	switch {
+	case h.finally:
+		caught = &pendingError{re}
+	case re.Value != nil:
+		caught = re.Value
+	default:
+		// The frames below the one catching the error are not part of the
+		// caught trace.
+		trace := re.Trace[:len(re.Trace)-(h.frames-1)]
+		caught = &object.ErrorValue{Message: re.Message, Err: re.Err, Trace: trace}
+	}
+	vm.push(caught)
+	vm.currentFrame().ip = h.target - 1
+	return true
+}
+
+// pendingErrorObj is the type of pendingError values.
+const pendingErrorObj = "PENDING_ERROR"
+
+// cellObj is the type of cell values.
+const cellObj = "CELL"
+
+// cell holds a local captured by a closure, in place of its value in the
+// frame of its function and among the free variables of the closure, so that
+// each sees the values the other sets. Its value is nil until the local is
+// set.
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return cellObj }
+func (c *cell) Inspect() string         { return "cell" }
+
+// deref returns the value of the local or free variable held by slot, which
+// may be a cell.
+func deref(slot object.Object) object.Object {
+	if c, ok := slot.(*cell); ok {
+		return c.value
+	}
+	return slot
+}
+
+// pendingError is an error caught by the handler of a finally block, which
+// OpThrow raises again after the block.
+type pendingError struct {
+	err *RuntimeError
+}
+
+func (pe *pendingError) Type() object.ObjectType { return pendingErrorObj }
+func (pe *pendingError) Inspect() string         { return "pending error: " + pe.err.Message }
+
+// throw returns the error raised by throwing value. Throwing an
+// *object.ErrorValue raises the error it was caught from again, with the
+// frames it had gone through then.
+func (vm *VM) throw(value object.Object) error {
+	switch value := value.(type) {
+	case *pendingError:
+		return value.err
+	case *object.ErrorValue:
+		trace := append([]object.Frame{}, value.Trace...)
+		trace = append(trace, vm.trace()[1:]...)
+		return &RuntimeError{Message: value.Message, Err: value.Err, Trace: trace}
+	}
+	message, err := object.UncaughtMessage(value, vm.meter)
+	if err != nil {
+		return err
+	}
+	return &RuntimeError{Message: message, Value: value}
+}
+
+// trace returns the stack trace of the frames being executed.
+func (vm *VM) trace() []object.Frame {
+	trace := make([]object.Frame, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+		line, column := fn.Lines.Lookup(frame.ip)
+		name := fn.Name
+		switch {
+		case i == 0:
+			name = object.MainFunction
+		case name == "":
+			name = object.AnonymousFunction
+		}
+		trace = append(trace, object.Frame{Function: name, File: fn.File, Line: line, Column: column})
+	}
+	return trace
+}
+
+func (vm *VM) run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if err := vm.meter.Step(); err != nil {
+			return err
+		}
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			if err := vm.executeComparison(op); err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			operand := vm.pop()
+			if err := vm.push(nativeBoolToBooleanObject(!isTruthy(operand))); err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			operand := vm.pop()
+			integer, ok := operand.(*object.Integer)
+			if !ok {
+				return fmt.Errorf("unknown operator: -%s", operand.Type())
+			}
+			if err := vm.pushNew(&object.Integer{Value: -integer.Value}); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpJumpIfNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			if vm.stack[vm.sp-1].Type() == object.NULL_OBJ {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			if vm.globals[globalIndex] == nil {
+				return fmt.Errorf("global %d read before it is set", globalIndex)
+			}
+			if err := vm.push(vm.globals[globalIndex]); err != nil {
+				return err
+			}
+
+		case code.OpGetLateGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			name := vm.constants[code.ReadUint16(ins[ip+3:])].(*object.String)
+			vm.currentFrame().ip += 4
+			if vm.globals[globalIndex] == nil {
+				return fmt.Errorf("identifier not found: %s", name.Value)
+			}
+			if err := vm.push(vm.globals[globalIndex]); err != nil {
+				return err
+			}
+
+		case code.OpGetGlobalIfSet:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			global := vm.globals[code.ReadUint16(ins[ip+3:])]
+			vm.currentFrame().ip += 4
+			if err := vm.pushIfSet(global, target); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if c, ok := (*slot).(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			frame := vm.currentFrame()
+			local := deref(vm.stack[frame.basePointer+int(localIndex)])
+			if local == nil {
+				return fmt.Errorf("local %d read before it is set", localIndex)
+			}
+			if err := vm.push(local); err != nil {
+				return err
+			}
+
+		case code.OpGetLocalIfSet:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			localIndex := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			frame := vm.currentFrame()
+			if err := vm.pushIfSet(deref(vm.stack[frame.basePointer+int(localIndex)]), target); err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			definition := object.Builtins[builtinIndex]
+			if err := vm.push(definition.Builtin); err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			currentClosure := vm.currentFrame().cl
+			if err := vm.push(deref(currentClosure.Free[freeIndex])); err != nil {
+				return err
+			}
+
+		case code.OpGetFreeIfSet:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			freeIndex := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			if err := vm.pushIfSet(deref(vm.currentFrame().cl.Free[freeIndex]), target); err != nil {
+				return err
+			}
+
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			slot := &vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			if _, ok := (*slot).(*cell); !ok {
+				*slot = &cell{value: *slot}
+			}
+			if err := vm.push(*slot); err != nil {
+				return err
+			}
+
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			if err := vm.push(vm.currentFrame().cl.Free[freeIndex]); err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			if err := vm.push(vm.currentFrame().cl); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			if err := vm.executeTailCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpCallSpread, code.OpTailCallSpread:
+			numArgs, err := vm.spreadArguments()
+			if err != nil {
+				return err
+			}
+			if op == code.OpTailCallSpread {
+				err = vm.executeTailCall(numArgs)
+			} else {
+				err = vm.executeCall(numArgs)
+			}
+			if err != nil {
+				return err
+			}
+
+		case code.OpJumpIfPassed:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			param := int(code.ReadUint8(ins[ip+3:]))
+			frame := vm.currentFrame()
+			frame.ip += 3
+			if param < frame.passed {
+				frame.ip = pos - 1
+			}
+
+		case code.OpSpread:
+			if value := vm.stack[vm.sp-1]; value.Type() != object.ARRAY_OBJ {
+				return fmt.Errorf("cannot spread %s", value.Type())
+			}
+
+		case code.OpConcat:
+			numArrays := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			elements := []object.Object{}
+			for _, value := range vm.stack[vm.sp-numArrays : vm.sp] {
+				array, ok := value.(*object.Array)
+				if !ok {
+					return fmt.Errorf("cannot spread %s", value.Type())
+				}
+				elements = append(elements, array.Elements...)
+			}
+			vm.sp = vm.sp - numArrays
+			if err := vm.pushNew(&object.Array{Elements: elements}); err != nil {
+				return err
+			}
+
+		case code.OpTemplate:
+			numValues := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			var out strings.Builder
+			for _, value := range vm.stack[vm.sp-numValues : vm.sp] {
+				text, err := object.InspectMetered(value, vm.meter)
+				if err != nil {
+					return err
+				}
+				out.WriteString(text)
+			}
+			vm.sp = vm.sp - numValues
+			if err := vm.pushNew(&object.String{Value: out.String()}); err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+			if err := vm.pushNew(&object.Array{Elements: elements}); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			hash, err := buildHash(vm.stack[vm.sp-numElements : vm.sp])
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+			if err := vm.pushNew(hash); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+
+		case code.OpTry, code.OpTryFinally:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			vm.handlers = append(vm.handlers, handler{
+				frames:  vm.framesIndex,
+				sp:      vm.sp,
+				target:  target,
+				finally: op == code.OpTryFinally,
+			})
+
+		case code.OpEndTry:
+			if n := len(vm.handlers); n > 0 && vm.handlers[n-1].frames == vm.framesIndex {
+				vm.handlers = vm.handlers[:n-1]
+			}
+
+		case code.OpThrow:
+			return vm.throw(vm.pop())
+
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			if err := vm.importModule(int(constIndex)); err != nil {
+				return err
+			}
+
+		case code.OpModule:
+			numExports := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			module, err := buildModule(vm.currentFrame().cl.Fn.File, vm.stack[vm.sp-2*numExports:vm.sp])
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - 2*numExports
+			vm.modules[vm.currentFrame().cl.Fn] = module
+			if err := vm.pushNew(module); err != nil {
+				return err
+			}
+
+		case code.OpMember:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			name, ok := vm.constants[constIndex].(*object.String)
+			if !ok {
+				return fmt.Errorf("not a member name: %+v", vm.constants[constIndex])
+			}
+			if err := vm.executeMemberExpression(vm.pop(), name.Value); err != nil {
+				return err
+			}
+
+		case code.OpArrayPattern:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+			if err := vm.destructureArray(vm.pop(), numElements, rest); err != nil {
+				return err
+			}
+
+		case code.OpHashPattern:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			keys := make([]object.Object, numKeys)
+			copy(keys, vm.stack[vm.sp-numKeys:vm.sp])
+			vm.sp = vm.sp - numKeys
+			if err := vm.destructureHash(vm.pop(), keys); err != nil {
+				return err
+			}
+
+		case code.OpMatchLiteral:
+			literal, value := vm.pop(), vm.pop()
+			matched := literal == value
+			if l, ok := literal.(object.Hashable); ok {
+				v, ok := value.(object.Hashable)
+				matched = ok && v.HashKey() == l.HashKey()
+			}
+			if err := vm.push(nativeBoolToBooleanObject(matched)); err != nil {
+				return err
+			}
+
+		case code.OpMatchArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+			if err := vm.matchArray(vm.pop(), numElements, rest); err != nil {
+				return err
+			}
+
+		case code.OpMatchHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			keys := make([]object.Object, numKeys)
+			copy(keys, vm.stack[vm.sp-numKeys:vm.sp])
+			vm.sp = vm.sp - numKeys
+			if err := vm.matchHash(vm.pop(), keys); err != nil {
+				return err
+			}
+
+		case code.OpNoMatch:
+			text, err := object.InspectMetered(vm.pop(), vm.meter)
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("non-exhaustive match: no arm matches %s", text)
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.framesIndex == 1 {
+				// A return statement at the top level ends the program.
+				vm.stack[vm.sp] = returnValue
+				return nil
+			}
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dropHandlers removes the handlers installed by the current frame. The
+// compiler removes every handler before its function returns; this keeps
+// the machine safe from bytecode that does not.
+func (vm *VM) dropHandlers() {
+	for n := len(vm.handlers); n > 0 && vm.handlers[n-1].frames >= vm.framesIndex; n-- {
+		vm.handlers = vm.handlers[:n-1]
+	}
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// executeTailCall calls a closure by reusing the current frame: the callee
+// and its arguments are moved down to where the current function's callee
+// and arguments are, and the frame restarts with the new closure. Other
+// callees are called like OpCall does.
+func (vm *VM) executeTailCall(numArgs int) error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || vm.framesIndex == 1 {
+		return vm.executeCall(numArgs)
+	}
+	passed, numArgs, err := vm.arguments(cl.Fn, numArgs)
+	if err != nil {
+		return err
+	}
+	if err := vm.meter.Alloc(limits.EnvironmentSize(cl.Fn.NumLocals)); err != nil {
+		return err
+	}
+	vm.dropHandlers()
+	frame := vm.currentFrame()
+	vm.growStack(frame.basePointer + cl.Fn.NumLocals)
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	frame.cl = cl
+	frame.ip = -1
+	frame.passed = passed
+	vm.clearLocals(frame.basePointer+numArgs, frame.basePointer+cl.Fn.NumLocals)
+	return nil
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	passed, numArgs, err := vm.arguments(cl.Fn, numArgs)
+	if err != nil {
+		return err
+	}
+	frame := NewFrame(cl, vm.sp-numArgs)
+	frame.passed = passed
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+	if err := vm.meter.Alloc(limits.EnvironmentSize(cl.Fn.NumLocals)); err != nil {
+		return err
+	}
+	vm.growStack(frame.basePointer + cl.Fn.NumLocals)
+	vm.clearLocals(vm.sp, frame.basePointer+cl.Fn.NumLocals)
+	return nil
+}
+
+// clearLocals unsets the locals from the stack slot from up to the slot to,
+// which is where the stack then starts, so that they do not hold the values
+// of an earlier call.
+func (vm *VM) clearLocals(from, to int) {
+	for i := from; i < to; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = to
+}
+
+// pushIfSet pushes value and jumps to the offset target, unless value is not
+// set.
+func (vm *VM) pushIfSet(value object.Object, target int) error {
+	if value == nil {
+		return nil
+	}
+	vm.currentFrame().ip = target - 1
+	return vm.push(value)
+}
+
+// arguments checks that fn takes numArgs arguments, which are on top of the
+// stack, and turns them into one value for each of its parameters: the extra
+// arguments of a variadic function are replaced by an array of them, and
+// missing ones by nulls for the function to replace by their defaults. It
+// returns how many parameters were passed and the number of values on the
+// stack for them.
+func (vm *VM) arguments(fn *object.CompiledFunction, numArgs int) (int, int, error) {
+	required := fn.NumParameters - fn.NumDefaults
+	if numArgs < required || numArgs > fn.NumParameters && !fn.Variadic {
+		return 0, 0, fmt.Errorf("%s", object.ArityMessage(fn.Name, fn.NumParameters, fn.NumDefaults, fn.Variadic, numArgs))
+	}
+	passed := numArgs
+	var rest []object.Object
+	if numArgs > fn.NumParameters {
+		passed = fn.NumParameters
+		rest = make([]object.Object, numArgs-passed)
+		copy(rest, vm.stack[vm.sp-len(rest):vm.sp])
+		vm.sp -= len(rest)
+	}
+	for i := passed; i < fn.NumParameters; i++ {
+		if err := vm.push(Null); err != nil {
+			return 0, 0, err
+		}
+	}
+	if !fn.Variadic {
+		return passed, fn.NumParameters, nil
+	}
+	if rest == nil {
+		rest = []object.Object{}
+	}
+	if err := vm.pushNew(&object.Array{Elements: rest}); err != nil {
+		return 0, 0, err
+	}
+	return passed, fn.NumParameters + 1, nil
+}
+
+// spreadArguments replaces the array of arguments on top of the stack by its
+// elements, and returns their number.
+func (vm *VM) spreadArguments() (int, error) {
+	value := vm.pop()
+	array, ok := value.(*object.Array)
+	if !ok {
+		return 0, fmt.Errorf("cannot spread %s", value.Type())
+	}
+	args := array.Elements
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return 0, err
+		}
+	}
+	return len(args), nil
+}
+
+// callBuiltin replaces the builtin and its arguments on the stack with its
+// result. A builtin reports failure by returning an error value, which ends
+// execution like any other runtime error.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	var result object.Object
+	if builtin.Metered != nil {
+		var err error
+		if result, err = builtin.Metered(vm.meter, args...); err != nil {
+			return err
+		}
+	} else {
+		result = builtin.Fn(args...)
+	}
+	vm.sp = vm.sp - numArgs - 1
+	if err, ok := result.(*object.Error); ok {
+		return &RuntimeError{Message: err.Message, Err: err.Err}
+	}
+	if result == nil {
+		result = Null
+	}
+	return vm.pushNew(result)
+}
+
+// pushClosure creates a closure over the function constant at constIndex,
+// capturing the numFree values on top of the stack.
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+	return vm.pushNew(&object.Closure{Fn: function, Free: free})
+}
+
+// importModule pushes the module loaded by the function constant at
+// constIndex. The first import calls the function, whose OpModule records
+// the module for later imports.
+func (vm *VM) importModule(constIndex int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+	if module, ok := vm.modules[function]; ok {
+		return vm.push(module)
+	}
+	cl := &object.Closure{Fn: function}
+	if err := vm.push(cl); err != nil {
+		return err
+	}
+	return vm.callClosure(cl, 0)
+}
+
+// buildModule returns the module of the file path exporting elements, which
+// alternate between names and values.
+func buildModule(path string, elements []object.Object) (*object.Module, error) {
+	module := object.NewModule(path)
+	for i := 0; i < len(elements); i += 2 {
+		name, ok := elements[i].(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("not an export name: %s", elements[i].Type())
+		}
+		module.Exports.Set(name, elements[i+1])
+	}
+	return module, nil
+}
+
+func (vm *VM) executeMemberExpression(obj object.Object, name string) error {
+	switch obj := obj.(type) {
+	case *object.Module:
+		value, ok := obj.Member(name)
+		if !ok {
+			return fmt.Errorf("module %s does not export %s", obj.Path, name)
+		}
+		return vm.push(value)
+	case *object.Hash:
+		value, ok := obj.Get(&object.String{Value: name})
+		if !ok {
+			return fmt.Errorf("hash has no member %s", name)
+		}
+		return vm.push(value)
+	case *object.ErrorValue:
+		value, ok := obj.Member(name)
+		if !ok {
+			return fmt.Errorf("error has no member %s", name)
+		}
+		return vm.push(value)
+	default:
+		return fmt.Errorf("member access not supported: %s.%s", obj.Type(), name)
+	}
+}
+
+// destructureArray pushes the elements of value, an array matched by an array
+// pattern of numElements elements, in reverse order. If the pattern has a
+// rest element, an array of the elements after them is pushed first.
+func (vm *VM) destructureArray(value object.Object, numElements int, rest bool) error {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s with an array pattern", value.Type())
+	}
+	elements := array.Elements
+	if rest && len(elements) < numElements {
+		return fmt.Errorf("wrong number of array elements: want>=%d, got=%d", numElements, len(elements))
+	}
+	if !rest && len(elements) != numElements {
+		return fmt.Errorf("wrong number of array elements: want=%d, got=%d", numElements, len(elements))
+	}
+	if rest {
+		remaining := append([]object.Object{}, elements[numElements:]...)
+		if err := vm.pushNew(&object.Array{Elements: remaining}); err != nil {
+			return err
+		}
+	}
+	for i := numElements - 1; i >= 0; i-- {
+		if err := vm.push(elements[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// destructureHash pushes the values of keys in value, a hash matched by a
+// hash pattern, in reverse order.
+func (vm *VM) destructureHash(value object.Object, keys []object.Object) error {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s with a hash pattern", value.Type())
+	}
+	values := make([]object.Object, len(keys))
+	for i, key := range keys {
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		if values[i], ok = hash.Get(hashable); !ok {
+			return fmt.Errorf("hash has no key %s", key.Inspect())
+		}
+	}
+	for i := len(values) - 1; i >= 0; i-- {
+		if err := vm.push(values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchArray is destructureArray for the pattern of a match arm. If value
+// is not an array of the right length, it pushes nulls in place of the
+// elements. It then pushes whether value is.
+func (vm *VM) matchArray(value object.Object, numElements int, rest bool) error {
+	array, matched := value.(*object.Array)
+	if matched {
+		n := len(array.Elements)
+		matched = n == numElements || rest && n >= numElements
+	}
+	if matched {
+		if err := vm.destructureArray(array, numElements, rest); err != nil {
+			return err
+		}
+	} else {
+		if rest {
+			numElements++
+		}
+		if err := vm.pushNulls(numElements); err != nil {
+			return err
+		}
+	}
+	return vm.push(nativeBoolToBooleanObject(matched))
+}
+
+// matchHash is destructureHash for the pattern of a match arm. If value is
+// not a hash holding every key, it pushes nulls in place of the values. It
+// then pushes whether value is.
+func (vm *VM) matchHash(value object.Object, keys []object.Object) error {
+	hash, matched := value.(*object.Hash)
+	for _, key := range keys {
+		if !matched {
+			break
+		}
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		_, matched = hash.Get(hashable)
+	}
+	if matched {
+		if err := vm.destructureHash(hash, keys); err != nil {
+			return err
+		}
+	} else if err := vm.pushNulls(len(keys)); err != nil {
+		return err
+	}
+	return vm.push(nativeBoolToBooleanObject(matched))
+}
+
+func (vm *VM) pushNulls(n int) error {
+	for i := 0; i < n; i++ {
+		if err := vm.push(Null); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildHash returns a hash of elements, which alternate between keys and
+// values.
+func buildHash(elements []object.Object) (*object.Hash, error) {
+	if len(elements)%2 != 0 {
+		return nil, fmt.Errorf("hash has a key without a value")
+	}
+	hash := object.NewHash(len(elements) / 2)
+	for i := 0; i < len(elements); i += 2 {
+		key, ok := elements[i].(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", elements[i].Type())
+		}
+		hash.Set(key, elements[i+1])
+	}
+	return hash, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(elements)) {
+			return vm.push(Null)
+		}
+		return vm.push(elements[i])
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		value, ok := left.(*object.Hash).Get(key)
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(value)
+	case left.Type() == object.ERROR_OBJ && index.Type() == object.STRING_OBJ:
+		value, ok := left.(*object.ErrorValue).Member(index.(*object.String).Value)
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(value)
+	default:
+		return fmt.Errorf("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ && op == code.OpAdd:
+		leftValue := left.(*object.String).Value
+		rightValue := right.(*object.String).Value
+		return vm.pushNew(&object.String{Value: leftValue + rightValue})
+	case leftType != rightType:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operators[op], rightType)
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", leftType, operators[op], rightType)
+	}
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	var result int64
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = leftValue / rightValue
+	}
+	return vm.pushNew(&object.Integer{Value: result})
+}
+
+func (vm *VM) executeComparison(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeIntegerComparison(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ && (op == code.OpEqual || op == code.OpNotEqual):
+		equal := left.(*object.String).Value == right.(*object.String).Value
+		return vm.push(nativeBoolToBooleanObject(equal == (op == code.OpEqual)))
+	case leftType != rightType:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operators[op], rightType)
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", leftType, operators[op], rightType)
+	}
+}
+
+func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	default:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	}
+}
+
+// operators maps the opcodes of binary operations to the source operators
+// named in error messages.
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+func (vm *VM) push(o object.Object) error {
+	vm.growStack(vm.sp)
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+// pushNew pushes o, a value just created, counting its allocation.
+func (vm *VM) pushNew(o object.Object) error {
+	if err := vm.meter.Alloc(limits.SizeOf(o)); err != nil {
+		return err
+	}
+	return vm.push(o)
+}
+
+// growStack makes the stack large enough to hold a value at index sp.
+func (vm *VM) growStack(sp int) {
+	for sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,755 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kellemNegasi/monkeylang/ast"
+	"github.com/kellemNegasi/monkeylang/compiler"
+	"github.com/kellemNegasi/monkeylang/evaluator"
+	"github.com/kellemNegasi/monkeylang/lexer"
+	"github.com/kellemNegasi/monkeylang/limits"
+	"github.com/kellemNegasi/monkeylang/object"
+	"github.com/kellemNegasi/monkeylang/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+	}
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!(if (false) { 5; })", true},
+		{`"a" == "a"`, true},
+	}
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let x = 1; }", Null},
+	}
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+	}
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"let f = fn() { [1, 2] }; f()[1]", 2},
+	}
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{}", "{}"},
+		{`{"b": 1, "a": 2, 3: 4}`, "{b: 1, a: 2, 3: 4}"},
+		{`{1 + 1: 2 * 2, true: "t", 2: 5}`, "{2: 5, true: t}"},
+		{`{"1": "string", 1: "integer", true: "boolean"}[1]`, "integer"},
+		{`{"a": 1}["a"]`, "1"},
+		{`{"a": 1}["b"]`, "null"},
+		{`{false: 0}[1 > 2]`, "0"},
+		{`let h = {"k": fn(x) { x * 2 }}; h["k"](21)`, "42"},
+		{`len({1: 1, 2: 2, 1: 3})`, "2"},
+	}
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2])`, 1},
+		{`last([1, 2])`, 2},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []int{1}},
+		{`type("a")`, "STRING"},
+		{`str([1, 2])`, "[1, 2]"},
+		{`puts("hello")`, Null},
+	}
+	var out bytes.Buffer
+	defer func(w io.Writer) { object.Output = w }(object.Output)
+	object.Output = &out
+	runVmTests(t, tests)
+	if out.String() != "hello\n" {
+		t.Errorf("puts wrote %q", out.String())
+	}
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn() { 5 + 10; }; f();", 15},
+		{"let f = fn() { return 99; 100; }; f();", 99},
+		{"let f = fn() { }; f();", Null},
+		{"let one = fn() { 1; }; let two = fn() { one() + one() }; two()", 2},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let g = 50; let f = fn(a) { let b = a * 2; b + g }; f(1) + f(2)", 106},
+		{"let f = fn(a, b = a + 1) { let c = a * b; c }; f(2) + f(2, 5)", 16},
+		{"let mk = fn(k) { fn(a = k) { a } }; mk(7)()", 7},
+		{"let g = fn(a, b = 5) { a + b }; let f = fn(x) { g(x) }; f(1)", 6},
+		{"let f = fn(a, ...b) { let c = len(b); c + a }; f(10, 1, 2)", 12},
+		{"let f = fn(a, b) { a - b }; let g = fn(xs) { f(...xs) }; g([5, 2])", 3},
+		{"let f = (a, b) => a - b; 10 |> f(3) |> f(2)", 5},
+		{"let add = (a) => (b) => a + b; 2 |> add(3)()", 5},
+		{"let f = () => 7; f()", 7},
+		{"[1, 2, 3] |> (xs) => len(xs) |> (n) => n * 2", 6},
+	}
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();", 99},
+		{"let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d } }; newAdder(1, 2)(8);", 11},
+		{`
+		let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+				let e = d + c;
+				fn(f) { e + f; };
+			};
+		};
+		newAdderOuter(1, 2)(3)(8);`, 14},
+		{`
+		let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+		};
+		newClosure(9, 90)();`, 99},
+		{`
+		let wrapper = fn() {
+			let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			countDown(1);
+		};
+		wrapper();`, 0},
+		{`len("four")`, 4},
+		{`let f = fn(g) { g("ab") }; f(len)`, 2},
+	}
+	runVmTests(t, tests)
+}
+
+// TestRecursiveClosureDoesNotCaptureItself checks that a closure refers to
+// itself through the frame executing it rather than through a reference
+// cycle in its free variables.
+func TestRecursiveClosureDoesNotCaptureItself(t *testing.T) {
+	input := `
+	let outer = fn(n) {
+		let loop = fn(x) { if (x == 0) { n } else { loop(x - 1) } };
+		loop
+	};
+	outer(5)`
+	vm := New(compile(t, input))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	loop, ok := vm.LastPoppedStackElem().(*object.Closure)
+	if !ok {
+		t.Fatalf("result is not a closure: %T", vm.LastPoppedStackElem())
+	}
+	for _, free := range loop.Free {
+		if free == loop {
+			t.Errorf("closure captures itself")
+		}
+	}
+}
+
+// TestTailRecursion runs a tail recursion far deeper than MaxFrames, which
+// only completes if each tail call reuses the frame of its caller.
+func TestTailRecursion(t *testing.T) {
+	tests := []vmTestCase{
+		{"let countDown = fn(n) { if (n == 0) { 0 } else { countDown(n - 1) } }; countDown(1000000)", 0},
+		{"let countDown = fn(n) { if (n > 0) { return countDown(n - 1); } n }; countDown(1000000)", 0},
+		{`let wrapper = fn() {
+			let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } };
+			count(1000000, 0)
+		};
+		wrapper()`, 1000000},
+		{`let add = fn(a, b) { a + b }; let f = fn(n) { add(n, 1) }; f(1)`, 2},
+		{`let f = fn(s) { len(s) }; f("abc")`, 3},
+	}
+	runVmTests(t, tests)
+
+	vm := New(compile(t, "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(1000000)"))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if vm.framesIndex != 1 || vm.sp != 0 {
+		t.Errorf("frames or stack not unwound: framesIndex=%d, sp=%d", vm.framesIndex, vm.sp)
+	}
+}
+
+// TestNullishOperators also checks that the operators short-circuit: the
+// divisions by zero are never evaluated.
+func TestNullishOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"null", Null},
+		{"true ? 1 : 1 / 0", 1},
+		{"false ? 1 / 0 : 2", 2},
+		{"null ? 1 : 2", 2},
+		{"let f = fn(n) { n > 0 ? n : -n }; f(-3) + f(4)", 7},
+		{"1 ?? 1 / 0", 1},
+		{"false ?? 1 / 0 == 0", false},
+		{"null ?? null ?? 3", 3},
+		{`let h = {"a": {"b": [5]}}; h?.a?.b?.[0]`, 5},
+		{`let h = {"a": null}; h.a?.b`, Null},
+		{`let h = {"a": null}; h.a?.[1 / 0]`, Null},
+		{`let h = {"a": null}; h.a?.(1 / 0)`, Null},
+		{`let h = {"f": fn(x) { x * 2 }}; h.f?.(4)`, 8},
+		{`let h = {}; h["f"]?.(1) ?? "none"`, "none"},
+		{"let h = null; h?.a.b.c", Null},
+		{"let h = null; h?.a(1)[0]", Null},
+		{`let h = {"a": [fn(x) { [x] }]}; h?.a[0](7)[0]`, 7},
+		{"let h = null; let f = fn(x) { [x] }; f(h?.a.b)[0] ?? 3", 3},
+		{"let g = fn(h) { h?.a.b(1) }; g(null)", Null},
+		{"let f = fn(n, acc) { n == 0 ? acc : f(n - 1, acc + 1) }; f(5000, 0)", 5000},
+		{"let g = fn() { null }; let f = fn(n) { g()?.(n) }; f(1)", Null},
+	}
+	runVmTests(t, tests)
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"`plain`", "plain"},
+		{"``", ""},
+		{"`${1}`", "1"},
+		{"let x = 2; `${x} + ${x} = ${x + x}`", "2 + 2 = 4"},
+		{"`${[1, \"a\"]}${null}${true}`", "[1, a]nulltrue"},
+		{"let f = fn(n) { `<${n}>` }; `${f(`${f(1)}`)}`", "<<1>>"},
+		{"`${ {\"}\": `}`}[\"}\"] }`", "}"},
+		{"`\\${x} \\``", "${x} `"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw 1; 2 } catch (e) { e + 10 }", 11},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+		{`let f = fn() { throw "boom"; }; try { f() } catch (e) { e }`, "boom"},
+		{"let f = fn(n) { try { return n; } finally { 0 } }; f(3)", 3},
+		{"let f = fn() { try { return 1; } finally { return 2; } }; f()", 2},
+		{"try { try { throw 1; } finally { 5 } } catch (e) { e }", 1},
+		{"try { try { throw 1; } catch (e) { throw e + 1; } } catch (e) { e }", 2},
+		{"let f = fn(n) { if (n == 0) { throw n; } try { f(n - 1) } catch (e) { throw e + 1; } }; try { f(5) } catch (e) { e }", 5},
+		{"let x = 0; try { 1 } finally { 2 }", 1},
+	}
+	runVmTests(t, tests)
+
+	// Handlers of a frame are dropped when it returns, so a later error is not
+	// caught by a try the frame has left.
+	vm := New(compile(t, "let f = fn() { try { return 1; } catch (e) { 2 } }; f(); 1 / 0"))
+	if err := vm.Run(); err == nil || err.Error() != "division by zero" {
+		t.Errorf("wrong error after leaving a try: %v", err)
+	}
+	if len(vm.handlers) != 0 {
+		t.Errorf("handlers not dropped: %d left", len(vm.handlers))
+	}
+
+	vm = New(compile(t, "let f = fn() { 1 + f() }; try { f() } catch (e) { 0 }"))
+	if err := vm.Run(); err == nil || err.Error() != "stack overflow: call depth limit of 1024 exceeded" {
+		t.Errorf("limit error was caught: %v", err)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5 / 0", "division by zero"},
+		{"1()", "not a function: INTEGER"},
+		{"fn(a) { a }()", "wrong number of arguments to <anonymous>: want=1, got=0"},
+		{`len("a", "b")`, "wrong number of arguments to len: want=1, got=2"},
+		{"{[1]: 2}", "unusable as hash key: ARRAY"},
+		{`{"a": 1}[fn() {}]`, "unusable as hash key: FUNCTION"},
+		{"let f = fn() { 1 + f() }; f()", "stack overflow: call depth limit of 1024 exceeded"},
+		{`throw "boom";`, "uncaught exception: boom"},
+		{"try { 1 / 0 } finally { 1 }", "division by zero"},
+		{`{"name": "Monkey"}.age`, "hash has no member age"},
+		{`try { 1 / 0 } catch (e) { e.code }`, "error has no member code"},
+		{`"abc".len`, "member access not supported: STRING.len"},
+		{"let [a] = 1;", "cannot destructure INTEGER with an array pattern"},
+		{"let [a, ...b] = [];", "wrong number of array elements: want>=1, got=0"},
+		{`let {a} = [1];`, "cannot destructure ARRAY with a hash pattern"},
+		{`let {"a": a, b} = {"b": 1};`, "hash has no key a"},
+		{`match ("a") { 1 => 1, [a] => a, {a} => a, true => 0 }`, "non-exhaustive match: no arm matches a"},
+		{"match (1) {}", "non-exhaustive match: no arm matches 1"},
+		{"let f = fn(a, b = 2) { a }; f()", "wrong number of arguments to f: want=1..2, got=0"},
+		{"let f = fn(a, ...b) { a }; f()", "wrong number of arguments to f: want=1+, got=0"},
+		{"let f = fn(a, ...b) { a }; f(...{})", "cannot spread HASH"},
+		{`[..."ab"]`, "cannot spread STRING"},
+	}
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		err := vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestCorpus runs every program of testdata/corpus with both the evaluator
+// and the virtual machine. Each program starts with a `// want: <value>` or
+// `// error: <message>` line, and both engines must produce it.
+func TestCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "testdata", "corpus", "*.mk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no corpus files found")
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, _, _ := strings.Cut(string(src), "\n")
+		expected := strings.TrimPrefix(header, "// want: ")
+		if expected == header {
+			expected = "ERROR: " + strings.TrimPrefix(header, "// error: ")
+		}
+		program := parse(t, string(src))
+		if got := evaluate(program); got != expected {
+			t.Errorf("%s: evaluator result wrong. want=%q, got=%q", file, expected, got)
+		}
+		if got := execute(program); got != expected {
+			t.Errorf("%s: vm result wrong. want=%q, got=%q", file, expected, got)
+		}
+		if evalTrace, vmTrace, ok := traces(program); ok && !reflect.DeepEqual(evalTrace, vmTrace) {
+			t.Errorf("%s: stack traces differ.\nevaluator: %v\nvm:        %v", file, evalTrace, vmTrace)
+		}
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"1 + true", []string{"<main> (t.mk:1:3)"}},
+		{
+			"let add = fn(a, b) {\n  a + b\n};\nlet twice = fn(f) { f(1, true) * 2 };\ntwice(add)",
+			[]string{"add (t.mk:2:5)", "twice (t.mk:4:22)", "<main> (t.mk:5:6)"},
+		},
+		{"let f = fn(x) { len(x) };\nf(1)", []string{"f (t.mk:1:20)", "<main> (t.mk:2:2)"}},
+		{"fn(x) { -x }(true)", []string{"<anonymous> (t.mk:1:9)", "<main> (t.mk:1:13)"}},
+		{"let f = fn() { [1][true] };\nlet g = fn() { 1 + f() };\ng()", []string{"f (t.mk:1:19)", "g (t.mk:2:21)", "<main> (t.mk:3:2)"}},
+		// f calls g last, so g replaces it and f is left out.
+		{"let g = fn(x) { x + true };\nlet f = fn(x) { g(x) };\nf(1)", []string{"g (t.mk:1:19)", "<main> (t.mk:3:2)"}},
+		{"let g = fn(x) { x };\nlet f = fn() { g() };\n1 + f()", []string{"f (t.mk:2:17)", "<main> (t.mk:3:6)"}},
+		{"let f = fn() { return len(); };\nf()", []string{"f (t.mk:1:26)", "<main> (t.mk:2:2)"}},
+		{"let f = fn(x) { x(1) };\nreturn f(2);", []string{"f (t.mk:1:18)", "<main> (t.mk:2:9)"}},
+		{"let [a, {b}] = [1, 2];", []string{"<main> (t.mk:1:9)"}},
+		{"let f = fn(p) {\n  let {x: [y, ...z]} = p;\n  y\n};\nf({\"x\": []})", []string{"f (t.mk:2:11)", "<main> (t.mk:5:2)"}},
+		{"let f = fn(x) {\n  match (x) { 1 => 2 }\n};\nf(3)", []string{"f (t.mk:2:3)", "<main> (t.mk:4:2)"}},
+		{"match (1) { x if x + true => 1 }", []string{"<main> (t.mk:1:20)"}},
+		{"let f = fn(a, b = a + true) { b };\nf(1)", []string{"f (t.mk:1:21)", "<main> (t.mk:2:2)"}},
+		{"let f = fn(x) {\n  [0, ...x]\n};\nf(1)", []string{"f (t.mk:2:7)", "<main> (t.mk:4:2)"}},
+		{"let f = fn(a, b = 1) { a };\nlet g = fn() { f(...[1, 2, 3]) };\ng()", []string{"g (t.mk:2:17)", "<main> (t.mk:3:2)"}},
+		{"let f = (x) => x + true;\n1 |> f", []string{"f (t.mk:1:18)", "<main> (t.mk:2:3)"}},
+		{"let h = {\"a\": 1};\nh?.a?.b", []string{"<main> (t.mk:2:5)"}},
+		{"let f = fn(x) {\n  `x is ${x}\n and ${x + true}`\n};\nf(1)", []string{"f (t.mk:3:10)", "<main> (t.mk:5:2)"}},
+		{"let f = fn(x) { x ? x + true : null };\nf(1) ?? 2", []string{"f (t.mk:1:23)", "<main> (t.mk:2:2)"}},
+		{"let f = (x) => x + true;\nlet g = fn(x) { x |> f };\ng(1)\n  |> f", []string{"f (t.mk:1:18)", "<main> (t.mk:3:2)"}},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		program.File = "t.mk"
+		evalTrace, vmTrace, ok := traces(program)
+		if !ok {
+			t.Fatalf("%q: no runtime error", tt.input)
+		}
+		for name, trace := range map[string][]object.Frame{"evaluator": evalTrace, "vm": vmTrace} {
+			got := make([]string, len(trace))
+			for i, f := range trace {
+				got[i] = f.String()
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("%q: wrong %s trace.\nwant=%q\ngot= %q", tt.input, name, tt.expected, got)
+			}
+		}
+	}
+
+	vm := New(compile(t, "let f = fn() { 1 + f() }; f()"))
+	var de *limits.DepthError
+	if err := vm.Run(); !errors.As(err, &de) {
+		t.Errorf("stack overflow is not a *limits.DepthError: %#v", err)
+	}
+}
+
+func TestModules(t *testing.T) {
+	tests := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{
+				"main.mk": `import "lib.mk" as lib; lib.double(lib.base)`,
+				"lib.mk":  "let hidden = 21;\nexport let base = hidden;\nexport let double = fn(x) { x * 2 };",
+			},
+			"42",
+		},
+		{
+			map[string]string{
+				"main.mk":  `import "sub/a.mk" as a; import "sub/b.mk" as b; a.name + b.name`,
+				"sub/a.mk": `import "b.mk" as b; export let name = "a" + b.name;`,
+				"sub/b.mk": `export let name = "b";`,
+			},
+			"abb",
+		},
+		{
+			map[string]string{
+				"main.mk": `import "lib.mk" as lib; [lib.x, lib.rest, lib.name]`,
+				"lib.mk":  `export let [x, ...rest] = [1, 2]; export let {name} = {"name": "lib"};`,
+			},
+			"[1, [2], lib]",
+		},
+		{
+			map[string]string{
+				"main.mk": `import "lib.mk" as lib; lib.hidden`,
+				"lib.mk":  "let hidden = 1;",
+			},
+			"ERROR: module lib.mk does not export hidden",
+		},
+		{
+			map[string]string{
+				"main.mk": `import "a.mk" as a; a.x`,
+				"a.mk":    `import "main.mk" as m; export let x = 1;`,
+			},
+			"ERROR: import cycle: main.mk -> a.mk -> main.mk",
+		},
+		{
+			map[string]string{"main.mk": `import "nope.mk" as nope; 1`},
+			"ERROR: cannot import nope.mk: no such file or directory",
+		},
+		{
+			map[string]string{
+				"main.mk": `import "lib.mk" as lib; 1`,
+				"lib.mk":  "return 1;",
+			},
+			"ERROR: cannot import lib.mk: return statement outside a function",
+		},
+		{
+			map[string]string{
+				"main.mk": `import "lib.mk" as lib; let missing = 1; lib.f()`,
+				"lib.mk":  "export let f = fn() { missing };",
+			},
+			"ERROR: identifier not found: missing",
+		},
+		{
+			map[string]string{"main.mk": "let x = 1; x.y"},
+			"ERROR: member access not supported: INTEGER.y",
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for name, src := range tt.files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		program := parse(t, tt.files["main.mk"])
+		program.File = "main.mk"
+		inDir(t, dir, func() {
+			if got := evaluate(program); got != tt.expected {
+				t.Errorf("%q: evaluator result wrong. want=%q, got=%q", tt.files["main.mk"], tt.expected, got)
+			}
+			if got := execute(program); got != tt.expected {
+				t.Errorf("%q: vm result wrong. want=%q, got=%q", tt.files["main.mk"], tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestModuleStackTraces(t *testing.T) {
+	tests := []struct {
+		lib      string
+		input    string
+		expected []string
+	}{
+		{
+			"export let f = fn(x) {\n  x + true\n};",
+			"import \"lib.mk\" as lib;\nlib.f(1)",
+			[]string{"f (lib.mk:2:5)", "<main> (main.mk:2:6)"},
+		},
+		{
+			"let x = 1;\nexport let y = x + true;",
+			"let a = 1;\nimport \"lib.mk\" as lib;",
+			[]string{"<module> (lib.mk:2:18)", "<main> (main.mk:2:1)"},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "lib.mk"), []byte(tt.lib), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		program := parse(t, tt.input)
+		program.File = "main.mk"
+		inDir(t, dir, func() {
+			evalTrace, vmTrace, ok := traces(program)
+			if !ok {
+				t.Fatalf("%q: no runtime error", tt.input)
+			}
+			for name, trace := range map[string][]object.Frame{"evaluator": evalTrace, "vm": vmTrace} {
+				got := make([]string, len(trace))
+				for i, f := range trace {
+					got[i] = f.String()
+				}
+				if !reflect.DeepEqual(got, tt.expected) {
+					t.Errorf("%q: wrong %s trace.\nwant=%q\ngot= %q", tt.input, name, tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+// inDir runs f with dir as the current directory.
+func inDir(t *testing.T, dir string, f func()) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	f()
+}
+
+// traces returns the stack traces of the runtime error program fails with
+// in the evaluator and in the vm. It reports false if either engine does
+// not fail at run time.
+func traces(program *ast.Program) (evalTrace, vmTrace []object.Frame, ok bool) {
+	failure, ok := evaluator.Eval(program, object.NewEnvironment()).(*object.Error)
+	if !ok {
+		return nil, nil, false
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, nil, false
+	}
+	var re *RuntimeError
+	if err := New(comp.Bytecode()).Run(); !errors.As(err, &re) {
+		return nil, nil, false
+	}
+	return failure.Trace, re.Trace, true
+}
+
+// evaluate returns the inspected result of running program with the evaluator.
+func evaluate(program *ast.Program) string {
+	result := evaluator.Eval(program, object.NewEnvironment())
+	if result == nil {
+		return "null"
+	}
+	return result.Inspect()
+}
+
+// execute returns the inspected result of running program on the vm, with
+// compile and runtime errors reported like evaluator errors.
+func execute(program *ast.Program) string {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return "ERROR: " + err.Error()
+	}
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		return "ERROR: " + err.Error()
+	}
+	return vm.LastPoppedStackElem().Inspect()
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.input, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+	switch expected := expected.(type) {
+	case int:
+		result, ok := actual.(*object.Integer)
+		if !ok || result.Value != int64(expected) {
+			t.Errorf("%q: want integer %d, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case bool:
+		result, ok := actual.(*object.Boolean)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: want boolean %t, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case string:
+		result, ok := actual.(*object.String)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: want string %q, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("%q: want array %v, got=%T (%+v)", input, expected, actual, actual)
+			return
+		}
+		for i, e := range expected {
+			testExpectedObject(t, input, e, array.Elements[i])
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%q: want null, got=%T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	loop := "let f = fn(n) { f(n + 1) }; f(0)"
+	// d(1, 40) is an array nesting 2^40 ones, built in 40 steps.
+	doubled := "let d = fn(a, n) { if (n == 0) { a } else { d([a, a], n - 1) } }; "
+	tests := []struct {
+		input    string
+		config   limits.Config
+		expected error
+	}{
+		{loop, limits.Config{MaxSteps: 1000}, &limits.StepError{Limit: 1000}},
+		{"let f = fn(n) { 1 + f(n) }; f(0)", limits.Config{MaxDepth: 10}, &limits.DepthError{Limit: 10}},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(3000)", limits.Config{MaxDepth: 5000}, nil},
+		{`let f = fn(s) { f(s + s) }; f("ab")`, limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "str(d(1, 40))", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "puts(d(1, 40))", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "`${d(1, 40)}`", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "try { throw d(1, 40) } catch (e) { 0 }", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{doubled + "match (d(1, 40)) { 0 => 0 }", limits.Config{MaxAlloc: 1 << 20}, &limits.AllocError{Limit: 1 << 20}},
+		{`let f = fn(s) { if (len(s) > 100) { s } else { f(s + s) } }; len(f("ab"))`, limits.Config{MaxAlloc: 1 << 20}, nil},
+	}
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		err := vm.RunContext(context.Background(), tt.config)
+		if !reflect.DeepEqual(err, tt.expected) {
+			t.Errorf("wrong error for %q. want=%v, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	for _, input := range []string{loop, doubled + "str(d(1, 40))"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := New(compile(t, input)).RunContext(ctx, limits.Config{})
+		cancel()
+		var canceled *limits.CanceledError
+		if !errors.As(err, &canceled) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("wrong error for a timed out run of %q: %v", input, err)
+		}
+	}
+}